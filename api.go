@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/antonyho/crhk-recorder/pkg/api"
+	"github.com/antonyho/crhk-recorder/pkg/daemon"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/web"
+)
+
+// APITokenEnv is the environment variable of the API token
+const APITokenEnv = "CRHK_API_TOKEN"
+
+// MediaTokenEnv is the environment variable of the read-only token
+// of the podcast feeds and recordings
+const MediaTokenEnv = "CRHK_MEDIA_TOKEN"
+
+// serveAPI exposes the JSON API and the web UI of the daemon on the address
+// trustProxy trusts the scheme told by a reverse proxy. allowCommands
+// permits setting the post-processing commands of the jobs.
+func serveAPI(addr, token string, trustProxy, allowCommands bool, d *daemon.Daemon) {
+	if token == "" {
+		panic("API token must be provided in " + APITokenEnv + " environment variable")
+	}
+	s := api.New(d, token)
+	s.MediaToken = os.Getenv(MediaTokenEnv)
+	s.TrustProxy = trustProxy
+	s.AllowCommands = allowCommands
+	mux := http.NewServeMux()
+	mux.Handle(api.Prefix+"/", s)
+	mux.Handle("/", web.Handler())
+	go func() {
+		slog.Info("Serving API", "address", addr+api.Prefix)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("API endpoint failed", logging.Err(err))
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/antonyho/crhk-recorder/pkg/daemon"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/metrics"
+	"github.com/antonyho/crhk-recorder/pkg/mqtt"
+)
+
+// MQTTPasswordEnv is the environment variable of the MQTT password
+const MQTTPasswordEnv = "CRHK_MQTT_PASSWORD"
+
+// runDaemon runs the recording jobs listed in a configuration file
+// SIGHUP reloads the configuration file. SIGINT or SIGTERM stops the
+// daemon after finalising the in-flight recordings.
+func runDaemon(args []string) {
+	var configPath, metricsAt, apiAt, liveAt, broker, mqttUser, mqttPrefix string
+	var trustProxy, apiCommands bool
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "crhkrecorder.yaml", "configuration file path")
+	flags.StringVar(&metricsAt, "metrics", "", "listen address of the Prometheus metrics endpoint [e.g. :9090]")
+	flags.StringVar(&apiAt, "api", "", "listen address of the JSON API and web UI [e.g. :8080] [token in "+APITokenEnv+" environment variable]")
+	flags.BoolVar(&apiCommands, "api-commands", false, "allow setting the post-processing and encoder commands of the jobs through the API")
+	flags.BoolVar(&trustProxy, "trust-proxy", false, "trust X-Forwarded-Proto of a reverse proxy in front of the API")
+	flags.StringVar(&liveAt, "live", "", "listen address to re-stream the recordings on HLS and progressive ADTS [e.g. :8000]")
+	flags.StringVar(&broker, "mqtt", "", "MQTT broker to publish the recorder state and receive commands [e.g. tcp://localhost:1883]")
+	flags.StringVar(&mqttUser, "mqtt-user", "", "MQTT username [password in "+MQTTPasswordEnv+" environment variable]")
+	flags.StringVar(&mqttPrefix, "mqtt-prefix", mqtt.DefaultTopicPrefix, "MQTT topic prefix")
+	logOpts := logFlags(flags)
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	d := daemon.New(configPath)
+	if metricsAt != "" {
+		collector := metrics.New()
+		serveMetrics(metricsAt, collector)
+		d.AddObserver(collector)
+	}
+	if liveAt != "" {
+		d.AddObserver(serveLive(liveAt))
+	}
+	if apiAt != "" {
+		serveAPI(apiAt, os.Getenv(APITokenEnv), trustProxy, apiCommands, d)
+	}
+	if broker != "" {
+		client, err := mqtt.Connect(mqtt.Options{
+			Broker:      broker,
+			Username:    mqttUser,
+			Password:    os.Getenv(MQTTPasswordEnv),
+			TopicPrefix: mqttPrefix,
+		})
+		if err != nil {
+			panic(err)
+		}
+		bridge := mqtt.NewBridge(client, d)
+		bridge.TopicPrefix = mqttPrefix
+		if err := bridge.Start(); err != nil {
+			panic(err)
+		}
+		d.AddObserver(bridge)
+	}
+	ctx, exitCode := gracefulShutdown()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := d.Reload(); err != nil {
+				slog.Error("Reload configuration failed", logging.Err(err))
+			}
+		}
+	}()
+
+	if err := d.Run(ctx); err != nil {
+		panic(err)
+	}
+	os.Exit(exitCode())
+}
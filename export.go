@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonyho/crhk-recorder/pkg/aac"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/wav"
+)
+
+// Export formats
+const (
+	ExportWAV = "wav" // 16-bit PCM in a WAV file
+	ExportPCM = "pcm" // raw 16-bit little-endian interleaved samples
+)
+
+// runExport decodes the recordings to uncompressed audio
+// The export is written next to each recording with the extension of
+// the format, or to -o.
+func runExport(args []string) {
+	var format, output string
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&format, "format", ExportWAV, "output format [wav|pcm]")
+	flags.StringVar(&output, "o", "", "output file or the standard output [-] of a single recording")
+	logOpts := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [flags] recording.aac...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	if format != ExportWAV && format != ExportPCM {
+		panic(fmt.Errorf("unknown export format [%s]", format))
+	}
+	if output != "" && flags.NArg() > 1 {
+		panic(errors.New("only one recording can be exported to -o"))
+	}
+	for _, path := range flags.Args() {
+		dst := output
+		if dst == "" {
+			dst = strings.TrimSuffix(path, filepath.Ext(path)) + "." + format
+		}
+		if err := export(path, dst, format); err != nil {
+			panic(err)
+		}
+		if dst != StdoutOutput {
+			fmt.Println(dst)
+		}
+	}
+}
+
+// export decodes the recording to the output of the format
+func export(path, output, format string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r := aac.NewReader(in)
+	f, err := r.Format()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var out *os.File
+	if output == StdoutOutput {
+		out = os.Stdout
+	} else {
+		if out, err = os.Create(output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	var w io.Writer = out
+	var wavWriter *wav.Writer
+	if format == ExportWAV {
+		if wavWriter, err = wav.NewWriter(out, f.SampleRate, f.Channels); err != nil {
+			return err
+		}
+		w = wavWriter
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if wavWriter != nil {
+		if err := wavWriter.Close(); err != nil {
+			return err
+		}
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+	slog.Info("Recording exported", logging.KeyFile, path, "output", output, "format", format,
+		"sample_rate", f.SampleRate, "channels", f.Channels, "bytes", n,
+		"corrupt_frames", r.Corrupt(), "skipped_bytes", r.Skipped())
+	return nil
+}
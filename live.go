@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/antonyho/crhk-recorder/pkg/live"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+)
+
+// serveLive re-streams the recordings on the address
+func serveLive(addr string) *live.Server {
+	s := live.New()
+	go func() {
+		slog.Info("Serving live streams", "address", addr+"/live/")
+		if err := http.ListenAndServe(addr, s); err != nil {
+			slog.Error("Live stream endpoint failed", logging.Err(err))
+		}
+	}()
+	return s
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+)
+
+// logFlags registers the logging flags on the flag set
+func logFlags(flags *flag.FlagSet) *logging.Options {
+	opts := &logging.Options{}
+	flags.StringVar(&opts.Format, "log-format", logging.FormatText, "log format [text|json]")
+	flags.StringVar(&opts.Level, "log-level", "info", "log level [debug|info|warn|error]")
+	flags.StringVar(&opts.File, "log-file", "", "log file path [logs to stderr when empty]")
+	flags.IntVar(&opts.MaxSize, "log-max-size", 100, "megabytes of the log file before it is rotated")
+	flags.IntVar(&opts.MaxBackups, "log-max-backups", 0, "number of rotated log files to keep [0 keeps all]")
+	flags.IntVar(&opts.MaxAge, "log-max-age", 0, "days to keep the rotated log files [0 keeps all]")
+	return opts
+}
+
+// setupLogging makes the logger of the options the default logger
+// The log file is written synchronously, so it is left open until the process exits.
+func setupLogging(opts *logging.Options) {
+	logger, _, err := logging.New(*opts)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(logger)
+}
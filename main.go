@@ -1,17 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // IANA timezones without relying on the host zoneinfo
 
 	"github.com/antonyho/crhk-recorder/pkg/dayofweek"
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/metrics"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+	"github.com/antonyho/crhk-recorder/pkg/stream/encoder"
 	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "timeshift":
+			runTimeshift(os.Args[2:])
+			return
+		case "prune":
+			runPrune(os.Args[2:])
+			return
+		case "upload":
+			runUpload(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		}
+	}
+
 	var (
 		channel   string
 		startTime string
@@ -19,16 +54,58 @@ func main() {
 		duration  time.Duration
 		weekdays  string
 		repeat    bool
+		timezone  string
+		cronExpr  string
+		downloads int
+		metricsAt string
+		liveAt    string
+		hookURL   string
+		hookGaps  int
+		smtpAddr  string
+		smtpUser  string
+		mailFrom  string
+		mailTo    string
+		minFree   string
+		refuse    bool
+		mirror    string
+		output    string
+		encode    string
+		encodeCmd string
+		replace   bool
 	)
-	flag.StringVar(&channel, "c", "881", "channel name in abbreviation")
-	flag.StringVar(&startTime, "s", "", "start time with timezone abbreviation")
-	flag.StringVar(&endTime, "e", "", "end time with timezone abbreviation")
+	flag.StringVar(&channel, "c", "881", "channel name in abbreviation [comma seperated for simultaneous recording]")
+	flag.StringVar(&startTime, "s", "", "start time [15:04:05]")
+	flag.StringVar(&endTime, "e", "", "end time [15:04:05]")
 	flag.DurationVar(&duration, "d", 0, "record duration [don't do this over 24 hours]")
 	flag.StringVar(&weekdays, "w", "", "day of week on scheduled recording [comma seperated] [Sunday=0]")
 	flag.BoolVar(&repeat, "r", false, "repeat recording at scheduled time on next day")
+	flag.StringVar(&cronExpr, "cron", "", "cron expression of recurring schedule with -d duration [e.g. \"0 7 * * 1-5\"]")
+	flag.StringVar(&timezone, "z", schedule.DefaultTimezone, "timezone of start and end time in IANA name")
+	flag.IntVar(&downloads, "max-downloads", resolver.DefaultMaxConcurrentDownloads, "maximum concurrent media downloads")
+	flag.StringVar(&metricsAt, "metrics", "", "listen address of the Prometheus metrics endpoint [e.g. :9090]")
+	flag.StringVar(&liveAt, "live", "", "listen address to re-stream the recordings on HLS and progressive ADTS [e.g. :8000]")
+	flag.StringVar(&hookURL, "webhook", "", "URL to post the recording lifecycle events [HMAC-SHA256 secret in "+WebhookSecretEnv+" environment variable]")
+	flag.IntVar(&hookGaps, "webhook-gap-threshold", DefaultGapThreshold, "gaps of a completed recording before it is posted as degraded")
+	flag.StringVar(&smtpAddr, "smtp", "", "SMTP server to email the recording reports [host:port]")
+	flag.StringVar(&smtpUser, "smtp-user", "", "SMTP username [password in "+SMTPPasswordEnv+" environment variable]")
+	flag.StringVar(&mailFrom, "mail-from", "", "sender address of the recording reports")
+	flag.StringVar(&mailTo, "mail-to", "", "recipient addresses of the recording reports [comma seperated]")
+	flag.StringVar(&minFree, "min-free", "100MB", "free disk space kept while recording, the recording stops below it [0 keeps none]")
+	flag.BoolVar(&refuse, "require-space", false, "refuse to record without free disk space for the whole recording, otherwise warn")
+	flag.StringVar(&output, "o", "", "write the ADTS stream to the standard output [-], a named pipe or a file instead of the recording files")
+	flag.StringVar(&mirror, "mirror", "", "directories to write copies of the recordings, e.g. on a second disk [comma seperated]")
+	flag.StringVar(&encode, "encode", "", "encode the recordings while recording [mp3|opus]")
+	flag.StringVar(&encodeCmd, "encoder", encoder.DefaultCommand, "ffmpeg-compatible encoder command")
+	flag.BoolVar(&replace, "encode-only", false, "keep the encoded file only, the AAC file is kept when the encoder fails")
+	logOpts := logFlags(flag.CommandLine)
 	flag.Parse()
+	setupLogging(logOpts)
 
-	if duration == 0 {
+	if cronExpr != "" {
+		if duration == 0 {
+			panic("cron schedule requires record duration")
+		}
+	} else if duration == 0 {
 		if startTime == "" && endTime == "" {
 			panic("record time value must be provided")
 		}
@@ -49,22 +126,111 @@ func main() {
 	// 			endTime is set - start now and stop at endTime
 	// 			endTime is not set - start now and go with given duration
 
-	rcdr := recorder.NewRecorder(channel)
+	resolver.SetMaxConcurrentDownloads(downloads)
+	loc, err := schedule.LoadLocation(timezone)
+	if err != nil {
+		panic(err)
+	}
+	reserve, err := diskspace.ParseSize(minFree)
+	if err != nil {
+		panic(err)
+	}
+	guard := &diskspace.Guard{Reserve: uint64(reserve), Refuse: refuse}
+	var format *encoder.Format
+	if encode != "" {
+		f, err := encoder.ParseFormat(encode)
+		if err != nil {
+			panic(err)
+		}
+		format = &f
+		if err := (&encoder.Encoder{Command: encodeCmd}).Check(); err != nil {
+			slog.Warn("Recordings will not be encoded", logging.Err(err))
+		}
+	}
+	var out io.Writer
+	if output != "" {
+		if strings.Contains(channel, ",") {
+			panic("only one channel can be written to the output")
+		}
+		if liveAt != "" {
+			panic("-live re-streams the recording files, which are not written with -o")
+		}
+		f, err := openOutput(output)
+		if err != nil {
+			panic(err)
+		}
+		out, guard = f, nil // no recording files, closed on exit
+	}
+	ctx, exitCode := gracefulShutdown()
+
+	var observers []recorder.Observer
+	if metricsAt != "" {
+		collector := metrics.New()
+		serveMetrics(metricsAt, collector)
+		observers = append(observers, collector)
+	}
+	if liveAt != "" {
+		observers = append(observers, serveLive(liveAt))
+	}
+	var closers []io.Closer
+	if hookURL != "" {
+		notifier := webhookNotifier(hookURL, hookGaps)
+		observers = append(observers, notifier)
+		closers = append(closers, notifier)
+	}
+	if smtpAddr != "" {
+		notifier := emailNotifier(smtpAddr, smtpUser, mailFrom, mailTo)
+		observers = append(observers, notifier)
+		closers = append(closers, notifier)
+	}
+	sinks := func() []sink.Sink {
+		var sinks []sink.Sink
+		for _, dir := range mirrors(mirror) {
+			sinks = append(sinks, sink.NewDir(dir))
+		}
+		if format != nil {
+			enc := encoder.New(*format)
+			enc.Command = encodeCmd
+			enc.Replace = replace
+			sinks = append(sinks, sink.NewAsync(enc))
+		}
+		return sinks
+	}
+	exit := func(err error) {
+		// Deliver the pending notifications before exit
+		for _, c := range closers {
+			c.Close()
+		}
+		if err != nil {
+			panic(err)
+		}
+		os.Exit(exitCode())
+	}
+
+	if cronExpr != "" {
+		// Cron schedule repeats on every activation
+		c, err := schedule.NewCron(cronExpr, duration, loc)
+		if err != nil {
+			panic(err)
+		}
+		exit(recordChannels(ctx, channel, loc, guard, out, sinks, observers, func(rcdr *recorder.Recorder) error {
+			return rcdr.RunContext(ctx, c, true)
+		}))
+	}
 
 	if startTime == "" {
 		// Add a second delay to avoid skipping
-		startTime = time.Now().Add(time.Second).Format("15:04:05 -0700")
+		startTime = time.Now().Add(time.Second).In(loc).Format(schedule.ClockLayout)
 	}
 
 	if duration > time.Duration(0) {
 		if endTime == "" {
-			// Change Schedule() accepts parameter types and create endTime
 			// With duration parameter, it will override the endTime
-			start, err := time.Parse("15:04:05 -0700", startTime)
+			start, _, err := schedule.ParseClock(startTime)
 			if err != nil {
 				panic(err)
 			}
-			endTime = start.Add(duration).Format("15:04:05 -0700")
+			endTime = start.Add(duration).String()
 		}
 	}
 
@@ -89,11 +255,76 @@ func main() {
 	} else {
 		if !repeat {
 			// Just now, just once.
-			dowMask.Enable(time.Now().Weekday()) // Hope you aren't starting at 23:59:59
+			dowMask.Enable(time.Now().In(loc).Weekday()) // Hope you aren't starting at 23:59:59
 		} // Otherwise, all weeekdays.
 	}
 
-	if err := rcdr.Schedule(startTime, endTime, *dowMask, repeat); err != nil {
+	window, err := schedule.NewWindow(startTime, endTime, *dowMask, loc)
+	if err != nil {
 		panic(err)
 	}
+	exit(recordChannels(ctx, channel, loc, guard, out, sinks, observers, func(rcdr *recorder.Recorder) error {
+		return rcdr.RunContext(ctx, window, repeat)
+	}))
+}
+
+// mirrors splits the comma seperated directories of the copies
+func mirrors(dirs string) []string {
+	var list []string
+	for _, dir := range strings.Split(dirs, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			list = append(list, dir)
+		}
+	}
+	return list
+}
+
+// recordChannels runs the schedule on every comma seperated channel simultaneously
+// It returns the first error after all recordings have finished,
+// unless the recordings were stopped by cancelling the context.
+func recordChannels(
+	ctx context.Context,
+	channels string,
+	loc *time.Location,
+	guard *diskspace.Guard,
+	out io.Writer,
+	sinks func() []sink.Sink,
+	observers []recorder.Observer,
+	run func(*recorder.Recorder) error,
+) error {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, channel := range strings.Split(channels, ",") {
+		rcdr := recorder.NewRecorder(strings.TrimSpace(channel))
+		rcdr.Location = loc
+		rcdr.Guard = guard
+		if out != nil {
+			rcdr.Output = sink.NewWriter(out)
+		}
+		rcdr.Sinks = sinks()
+		for _, o := range observers {
+			rcdr.AddObserver(o)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := run(rcdr)
+			if errors.Is(err, syscall.EPIPE) {
+				slog.Info("Output closed by the reader", logging.KeyChannel, rcdr.Channel)
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Recording failed", logging.KeyChannel, rcdr.Channel, logging.Err(err))
+				errOnce.Do(func() {
+					firstErr = err
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
 }
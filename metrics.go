@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/metrics"
+)
+
+// serveMetrics exposes the /metrics endpoint of the collector on the address
+func serveMetrics(addr string, c *metrics.Collector) {
+	handler, err := metrics.Handler(c)
+	if err != nil {
+		panic(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	go func() {
+		slog.Info("Serving metrics", "address", addr+"/metrics")
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics endpoint failed", logging.Err(err))
+		}
+	}()
+}
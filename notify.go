@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/notify/email"
+	"github.com/antonyho/crhk-recorder/pkg/notify/webhook"
+)
+
+// SMTPPasswordEnv is the environment variable of the SMTP password
+const SMTPPasswordEnv = "CRHK_SMTP_PASSWORD"
+
+// WebhookSecretEnv is the environment variable of the webhook signing secret
+const WebhookSecretEnv = "CRHK_WEBHOOK_SECRET"
+
+// DefaultGapThreshold is the number of gaps a completed recording may have
+// before the webhook reports it degraded
+const DefaultGapThreshold = 2
+
+// webhookNotifier creates the notifier of the recording lifecycle events to the webhook
+// A completed recording with more gaps than the threshold is degraded.
+func webhookNotifier(url string, gapThreshold int) *notify.Notifier {
+	n := notify.New(webhook.New(url, os.Getenv(WebhookSecretEnv)))
+	n.GapThreshold = gapThreshold
+	return n
+}
+
+// emailNotifier creates the notifier of the recording reports by email
+// to the comma seperated recipients
+func emailNotifier(addr, username, from, to string) *notify.Notifier {
+	var recipients []string
+	for _, r := range strings.Split(to, ",") {
+		recipients = append(recipients, strings.TrimSpace(r))
+	}
+	n := notify.New(&email.Email{
+		Addr:     addr,
+		Username: username,
+		Password: os.Getenv(SMTPPasswordEnv),
+		From:     from,
+		To:       recipients,
+	})
+	n.Events = email.DefaultEvents
+	return n
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+)
+
+// StdoutOutput is the output name of the standard output
+const StdoutOutput = "-"
+
+// openOutput opens the output of the ADTS stream
+// It is the standard output, or a named pipe or file which is appended.
+// Opening a named pipe waits for a reader.
+// A broken pipe fails the writes instead of killing the process,
+// so that the recording stops cleanly.
+func openOutput(name string) (io.WriteCloser, error) {
+	signal.Ignore(syscall.SIGPIPE)
+	if name == StdoutOutput {
+		return os.Stdout, nil
+	}
+	if info, err := os.Stat(name); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		slog.Info("Waiting for a reader of the named pipe", logging.KeyFile, name)
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
@@ -0,0 +1,70 @@
+package aac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HeaderSize is the size of an ADTS header without the CRC
+const HeaderSize = 7
+
+// ProfileLC is the ADTS profile of AAC-LC, the audio object type minus one
+const ProfileLC = 1
+
+// Errors of the decoder
+var (
+	ErrUnsupported = errors.New("unsupported AAC stream")
+	ErrCorrupt     = errors.New("corrupt AAC frame")
+	errNoSync      = errors.New("no ADTS syncword")
+)
+
+// Header is the fixed and variable header of an ADTS frame
+type Header struct {
+	Profile       int
+	RateIndex     int // sampling frequency index
+	ChannelConfig int
+	Length        int // frame length in bytes including the header
+	Blocks        int // raw data blocks in the frame
+	CRC           bool
+}
+
+// ParseHeader parses the header at the start of the frame
+func ParseHeader(b []byte) (Header, error) {
+	if len(b) < HeaderSize || b[0] != 0xff || b[1]&0xf6 != 0xf0 {
+		return Header{}, errNoSync
+	}
+	h := Header{
+		Profile:       int(b[2] >> 6),
+		RateIndex:     int(b[2] >> 2 & 0xf),
+		ChannelConfig: int(b[2]&1<<2 | b[3]>>6),
+		Length:        int(b[3]&3)<<11 | int(b[4])<<3 | int(b[5]>>5),
+		Blocks:        int(b[6]&3) + 1,
+		CRC:           b[1]&1 == 0,
+	}
+	if h.RateIndex >= len(sampleRates) {
+		return Header{}, fmt.Errorf("%w: sampling frequency index %d", ErrCorrupt, h.RateIndex)
+	}
+	if h.Length < h.size() {
+		return Header{}, fmt.Errorf("%w: frame length %d", ErrCorrupt, h.Length)
+	}
+	return h, nil
+}
+
+// SampleRate of the frame
+func (h Header) SampleRate() int {
+	return sampleRates[h.RateIndex]
+}
+
+// Channels of the frame, or 0 when a program config element
+// defines the channels
+func (h Header) Channels() int {
+	return channelCounts[h.ChannelConfig]
+}
+
+// size of the header including the CRC and the block positions
+func (h Header) size() int {
+	if !h.CRC {
+		return HeaderSize
+	}
+	return HeaderSize + 2*h.Blocks
+}
@@ -0,0 +1,29 @@
+package aac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeader(t *testing.T) {
+	h, err := ParseHeader([]byte{0xff, 0xf1, 0x50, 0x80, 0x1c, 0x3f, 0xfc})
+	assert.NoError(t, err)
+	assert.Equal(t, Header{Profile: ProfileLC, RateIndex: 4, ChannelConfig: 2, Length: 225, Blocks: 1}, h)
+	assert.Equal(t, 44100, h.SampleRate())
+	assert.Equal(t, 2, h.Channels())
+
+	h, err = ParseHeader([]byte{0xff, 0xf0, 0x4c, 0x40, 0x20, 0x1f, 0xfd})
+	assert.NoError(t, err)
+	assert.Equal(t, Header{Profile: ProfileLC, RateIndex: 3, ChannelConfig: 1, Length: 256, Blocks: 2, CRC: true}, h)
+	assert.Equal(t, HeaderSize+4, h.size())
+
+	_, err = ParseHeader([]byte{0xff, 0xf1, 0x50, 0x80})
+	assert.ErrorIs(t, err, errNoSync)
+	_, err = ParseHeader([]byte{0xff, 0xf7, 0x50, 0x80, 0x1c, 0x3f, 0xfc}) // layer 3
+	assert.ErrorIs(t, err, errNoSync)
+	_, err = ParseHeader([]byte{0xff, 0xf1, 0x7c, 0x80, 0x1c, 0x3f, 0xfc}) // sampling frequency index 15
+	assert.ErrorIs(t, err, ErrCorrupt)
+	_, err = ParseHeader([]byte{0xff, 0xf1, 0x50, 0x80, 0x00, 0xbf, 0xfc}) // 5 bytes
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
@@ -0,0 +1,58 @@
+package aac
+
+// bitReader reads the bits of a frame, most significant bit first
+// Reading past the end yields zeros and marks the reader as overrun.
+type bitReader struct {
+	data    []byte
+	pos     int // bit position
+	overrun bool
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+// read n bits, up to 32
+func (r *bitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | uint32(r.bit())
+	}
+	return v
+}
+
+// bit reads a single bit
+func (r *bitReader) bit() uint8 {
+	i := r.pos >> 3
+	if i >= len(r.data) {
+		r.overrun = true
+		return 0
+	}
+	b := r.data[i] >> (7 - r.pos&7) & 1
+	r.pos++
+	return b
+}
+
+// flag reads a single bit as a boolean
+func (r *bitReader) flag() bool {
+	return r.bit() == 1
+}
+
+// skip n bits
+func (r *bitReader) skip(n int) {
+	r.pos += n
+	if r.pos > len(r.data)*8 {
+		r.pos = len(r.data) * 8
+		r.overrun = true
+	}
+}
+
+// align to the next byte
+func (r *bitReader) align() {
+	r.skip(-r.pos & 7)
+}
+
+// left is the number of unread bits
+func (r *bitReader) left() int {
+	return len(r.data)*8 - r.pos
+}
@@ -0,0 +1,249 @@
+package aac
+
+import (
+	"fmt"
+	"math"
+)
+
+// FrameSamples is the number of samples of a channel in a raw data block
+const FrameSamples = 1024
+
+// Syntactic elements of a raw data block
+const (
+	elementSCE = iota // single channel
+	elementCPE        // channel pair
+	elementCCE        // coupling channel
+	elementLFE        // low frequency effects channel
+	elementDSE        // data stream
+	elementPCE        // program config
+	elementFIL        // fill
+	elementEND
+)
+
+// Decoder decodes ADTS frames of AAC-LC to 16-bit PCM samples
+// The channels are in the order of the elements in the stream.
+// The spectral band replication of HE-AAC is skipped, so such
+// streams decode to their AAC-LC core at half the sample rate.
+type Decoder struct {
+	rateIndex int
+	channels  int
+	states    []channelState
+	streams   [2]channelStream
+	ms        msMask
+	fb        *filterbank
+	seed      uint32 // of the noise substitution
+	pcm       [][]float64
+	samples   []int16
+}
+
+// NewDecoder creates a decoder
+func NewDecoder() *Decoder {
+	return &Decoder{fb: newFilterbank(), seed: 1}
+}
+
+// SampleRate of the decoded frames
+func (d *Decoder) SampleRate() int {
+	return sampleRates[d.rateIndex]
+}
+
+// Channels of the decoded frames
+func (d *Decoder) Channels() int {
+	return d.channels
+}
+
+// Reset clears the overlap of the previous frames, e.g. after a gap
+func (d *Decoder) Reset() {
+	for i := range d.states {
+		d.states[i] = channelState{}
+	}
+}
+
+// Decode the ADTS frame to interleaved samples
+// The samples are valid until the next call. The first frame sets
+// the format of the decoder, which must not change afterwards.
+func (d *Decoder) Decode(frame []byte) ([]int16, error) {
+	h, err := ParseHeader(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) < h.Length {
+		return nil, fmt.Errorf("%w: frame of %d bytes is truncated to %d", ErrCorrupt, h.Length, len(frame))
+	}
+	if err := d.setFormat(h); err != nil {
+		return nil, err
+	}
+	r := newBitReader(frame[h.size():h.Length])
+	d.samples = d.samples[:0]
+	for b := 0; b < h.Blocks; b++ {
+		if err := d.decodeBlock(r); err != nil {
+			return nil, err
+		}
+		if h.CRC && h.Blocks > 1 {
+			r.skip(16) // raw data block CRC
+		}
+		d.interleave()
+	}
+	return d.samples, nil
+}
+
+// setFormat checks the frame format against the previous frames
+func (d *Decoder) setFormat(h Header) error {
+	if h.Profile != ProfileLC {
+		return fmt.Errorf("%w: profile %d is not AAC-LC", ErrUnsupported, h.Profile)
+	}
+	if h.Channels() == 0 {
+		return fmt.Errorf("%w: channel configuration %d", ErrUnsupported, h.ChannelConfig)
+	}
+	if d.channels == 0 {
+		d.rateIndex, d.channels = h.RateIndex, h.Channels()
+		d.states = make([]channelState, d.channels)
+		d.pcm = make([][]float64, d.channels)
+		for i := range d.pcm {
+			d.pcm[i] = make([]float64, FrameSamples)
+		}
+		return nil
+	}
+	if h.RateIndex != d.rateIndex || h.Channels() != d.channels {
+		return fmt.Errorf("%w: format changed to %d Hz of %d channels", ErrUnsupported, h.SampleRate(), h.Channels())
+	}
+	return nil
+}
+
+// decodeBlock decodes the elements of a raw data block to the channels
+func (d *Decoder) decodeBlock(r *bitReader) error {
+	ch := 0
+	for {
+		id := int(r.read(3))
+		if r.overrun {
+			return fmt.Errorf("%w: missing end element", ErrCorrupt)
+		}
+		switch id {
+		case elementSCE, elementLFE:
+			r.skip(4) // element_instance_tag
+			if ch+1 > d.channels {
+				return fmt.Errorf("%w: too many channels", ErrCorrupt)
+			}
+			cs := &d.streams[0]
+			if err := cs.read(r, d.rateIndex, false); err != nil {
+				return err
+			}
+			d.noise(cs, nil, nil)
+			d.synthesize(ch, cs)
+			ch++
+		case elementCPE:
+			r.skip(4) // element_instance_tag
+			if ch+2 > d.channels {
+				return fmt.Errorf("%w: too many channels", ErrCorrupt)
+			}
+			if err := d.decodePair(r, ch); err != nil {
+				return err
+			}
+			ch += 2
+		case elementCCE:
+			return fmt.Errorf("%w: coupling channel", ErrUnsupported)
+		case elementDSE:
+			skipData(r)
+		case elementPCE:
+			skipProgramConfig(r)
+		case elementFIL:
+			n := int(r.read(4))
+			if n == 15 {
+				n += int(r.read(8)) - 1
+			}
+			r.skip(8 * n)
+		case elementEND:
+			for ; ch < d.channels; ch++ {
+				d.silence(ch)
+			}
+			r.align()
+			return nil
+		}
+		if r.overrun {
+			return fmt.Errorf("%w: element %d overruns the frame", ErrCorrupt, id)
+		}
+	}
+}
+
+// decodePair decodes a channel pair element to the channels from ch
+func (d *Decoder) decodePair(r *bitReader, ch int) error {
+	left, right := &d.streams[0], &d.streams[1]
+	common := r.flag()
+	d.ms.present = 0
+	if common {
+		if err := left.info.read(r, d.rateIndex); err != nil {
+			return err
+		}
+		right.info = left.info
+		d.ms.read(r, &left.info)
+	}
+	if err := left.read(r, d.rateIndex, common); err != nil {
+		return err
+	}
+	if err := right.read(r, d.rateIndex, common); err != nil {
+		return err
+	}
+	if common {
+		d.noise(left, nil, &d.ms)
+		d.noise(right, left, &d.ms)
+		stereo(left, right, &d.ms)
+	} else {
+		d.noise(left, nil, nil)
+		d.noise(right, nil, nil)
+	}
+	d.synthesize(ch, left)
+	d.synthesize(ch+1, right)
+	return nil
+}
+
+// synthesize the channel from its spectrum
+func (d *Decoder) synthesize(ch int, cs *channelStream) {
+	tns(cs)
+	d.fb.synthesize(&d.states[ch], &cs.info, &cs.spec, d.pcm[ch])
+}
+
+// silence synthesizes a channel missing from the block
+func (d *Decoder) silence(ch int) {
+	cs := &d.streams[0]
+	cs.info = icsInfo{windowShape: d.states[ch].windowShape}
+	clear(cs.spec[:])
+	d.fb.synthesize(&d.states[ch], &cs.info, &cs.spec, d.pcm[ch])
+}
+
+// interleave the channels of the block into the samples
+func (d *Decoder) interleave() {
+	for n := 0; n < FrameSamples; n++ {
+		for ch := range d.pcm {
+			v := math.Round(d.pcm[ch][n])
+			d.samples = append(d.samples, int16(max(min(v, math.MaxInt16), math.MinInt16)))
+		}
+	}
+}
+
+// skipData skips a data stream element
+func skipData(r *bitReader) {
+	r.skip(4) // element_instance_tag
+	align := r.flag()
+	n := int(r.read(8))
+	if n == 255 {
+		n += int(r.read(8))
+	}
+	if align {
+		r.align()
+	}
+	r.skip(8 * n)
+}
+
+// skipProgramConfig skips a program config element
+func skipProgramConfig(r *bitReader) {
+	r.skip(4 + 2 + 4) // element_instance_tag, object_type, sampling_frequency_index
+	front, side, back := int(r.read(4)), int(r.read(4)), int(r.read(4))
+	lfe, assoc, cc := int(r.read(2)), int(r.read(3)), int(r.read(4))
+	for _, mixdown := range []int{4, 4, 3} { // mono, stereo, matrix
+		if r.flag() {
+			r.skip(mixdown)
+		}
+	}
+	r.skip(5*(front+side+back) + 4*(lfe+assoc) + 5*cc)
+	r.align()
+	r.skip(8 * int(r.read(8))) // comment_field_data
+}
@@ -0,0 +1,248 @@
+package aac
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bitWriter writes the bits of a test frame
+type bitWriter struct {
+	data []byte
+	n    int // bits
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) code(c *codebook, sym int) {
+	w.write(c.codes[sym], int(c.bits[sym]))
+}
+
+// line is a quantized spectral line of a test channel
+type line struct {
+	index int
+	value int
+}
+
+// writeChannel writes a long window channel stream of the lines, coded
+// with the escape codebook at scalefactor 100, so that each line is
+// |value|^(4/3). The bands of the lines must be in ascending order.
+func writeChannel(w *bitWriter, lines []line, commonWindow bool, maxSFB int) {
+	swb := swbOffsetLong48
+	w.write(100, 8) // global_gain
+	if !commonWindow {
+		writeInfo(w, maxSFB)
+	}
+	bands := map[int]bool{}
+	for _, l := range lines {
+		for sfb := 0; sfb < maxSFB; sfb++ {
+			if l.index >= swb[sfb] && l.index < swb[sfb+1] {
+				bands[sfb] = true
+			}
+		}
+	}
+	for sfb := 0; sfb < maxSFB; sfb++ { // a section per band
+		cb := uint32(zeroHCB)
+		if bands[sfb] {
+			cb = escHCB
+		}
+		w.write(cb, 4)
+		w.write(1, 5)
+	}
+	for sfb := 0; sfb < maxSFB; sfb++ {
+		if bands[sfb] {
+			w.code(&scalefactorCodes, 60)
+		}
+	}
+	w.write(0, 3) // no pulse, TNS or gain control
+	values := map[int]int{}
+	for _, l := range lines {
+		values[l.index] = l.value
+	}
+	for sfb := 0; sfb < maxSFB; sfb++ {
+		if !bands[sfb] {
+			continue
+		}
+		for k := swb[sfb]; k < swb[sfb+1]; k += 2 {
+			pair := [2]int{values[k], values[k+1]}
+			idx := 0
+			for _, v := range pair {
+				idx = idx*17 + min(abs(v), 16)
+			}
+			w.code(&spectralCodes[escHCB-1], idx)
+			for _, v := range pair {
+				if v != 0 {
+					w.write(sign(v), 1)
+				}
+			}
+			for _, v := range pair {
+				if abs(v) >= 16 {
+					n := 4
+					for 1<<(n+1) <= abs(v) {
+						w.write(1, 1)
+						n++
+					}
+					w.write(0, 1)
+					w.write(uint32(abs(v)-1<<n), n)
+				}
+			}
+		}
+	}
+}
+
+// writeInfo writes the ics_info of a long window
+func writeInfo(w *bitWriter, maxSFB int) {
+	w.write(0, 1) // ics_reserved_bit
+	w.write(onlyLongSequence, 2)
+	w.write(sineWindow, 1)
+	w.write(uint32(maxSFB), 6)
+	w.write(0, 1) // predictor_data_present
+}
+
+func abs(v int) int {
+	return max(v, -v)
+}
+
+// sign bit of the value, 1 is negative
+func sign(v int) uint32 {
+	if v < 0 {
+		return 1
+	}
+	return 0
+}
+
+// adtsFrame wraps the raw data block in an ADTS frame of 48 kHz
+func adtsFrame(channelConfig int, raw []byte) []byte {
+	n := HeaderSize + len(raw)
+	h := []byte{
+		0xff, 0xf1,
+		byte(ProfileLC<<6 | 3<<2 | channelConfig>>2),
+		byte(channelConfig&3<<6 | n>>11),
+		byte(n >> 3),
+		byte(n&7<<5 | 0x1f),
+		0xfc,
+	}
+	return append(h, raw...)
+}
+
+// monoFrame is an ADTS frame of a single channel of the lines
+func monoFrame(lines ...line) []byte {
+	w := &bitWriter{}
+	w.write(elementSCE, 3)
+	w.write(0, 4)
+	writeChannel(w, lines, false, 40)
+	w.write(elementEND, 3)
+	return adtsFrame(1, w.data)
+}
+
+// stereoFrame is an ADTS frame of a channel pair with a common window
+// and mid/side stereo of all bands
+func stereoFrame(mid, side []line) []byte {
+	w := &bitWriter{}
+	w.write(elementCPE, 3)
+	w.write(0, 4)
+	w.write(1, 1) // common_window
+	writeInfo(w, 40)
+	w.write(2, 2) // ms_mask_present for all bands
+	writeChannel(w, mid, true, 40)
+	writeChannel(w, side, true, 40)
+	w.write(elementEND, 3)
+	return adtsFrame(2, w.data)
+}
+
+// power of the samples of a channel at the frequency
+func power(samples []int16, channels, ch int, freq float64) float64 {
+	var re, im float64
+	for n := ch; n < len(samples); n += channels {
+		phase := 2 * math.Pi * freq * float64(n/channels)
+		re += float64(samples[n]) * math.Cos(phase)
+		im += float64(samples[n]) * math.Sin(phase)
+	}
+	return re*re + im*im
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	d := NewDecoder()
+	frame := monoFrame(line{index: 100, value: 5000})
+	var samples []int16
+	for i := 0; i < 4; i++ {
+		s, err := d.Decode(frame)
+		if !assert.NoError(t, err) {
+			return
+		}
+		samples = append(samples, s...)
+	}
+	assert.Equal(t, 48000, d.SampleRate())
+	assert.Equal(t, 1, d.Channels())
+	assert.Len(t, samples, 4*FrameSamples)
+
+	// The line is a tone at the center frequency of its band
+	tone := power(samples[FrameSamples:], 1, 0, 100.5/2048)
+	assert.Greater(t, tone, 100*power(samples[FrameSamples:], 1, 0, 300.5/2048))
+}
+
+func TestDecoder_Escape(t *testing.T) {
+	d := NewDecoder()
+	for _, v := range []int{15, 16, 31, 32, 1000, -8191} {
+		cs := &d.streams[0]
+		_, err := d.Decode(monoFrame(line{index: 8, value: v}))
+		if assert.NoError(t, err) {
+			assert.Equal(t, int32(v), cs.quant[8])
+		}
+	}
+}
+
+func TestDecoder_MidSide(t *testing.T) {
+	d := NewDecoder()
+	frame := stereoFrame([]line{{index: 100, value: 5000}}, []line{{index: 100, value: 5000}})
+	var samples []int16
+	for i := 0; i < 3; i++ {
+		s, err := d.Decode(frame)
+		if !assert.NoError(t, err) {
+			return
+		}
+		samples = append(samples, s...)
+	}
+	assert.Equal(t, 2, d.Channels())
+	// Mid and side of the same line leave the right channel silent
+	left := power(samples, 2, 0, 100.5/2048)
+	assert.Greater(t, left, 0.0)
+	assert.Less(t, power(samples, 2, 1, 100.5/2048), left*1e-6)
+}
+
+func TestDecoder_Silence(t *testing.T) {
+	d := NewDecoder()
+	samples, err := d.Decode(monoFrame())
+	assert.NoError(t, err)
+	assert.Equal(t, make([]int16, FrameSamples), samples)
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	frame := monoFrame(line{index: 4, value: 1})
+	tests := []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"main profile", append([]byte{0xff, 0xf1, frame[2] &^ 0xc0}, frame[3:]...), ErrUnsupported},
+		{"no end element", adtsFrame(1, frame[HeaderSize:len(frame)-1]), ErrCorrupt},
+		{"truncated", frame[:len(frame)-2], ErrCorrupt},
+		{"channel pair of a mono stream", adtsFrame(1, stereoFrame(nil, nil)[HeaderSize:]), ErrCorrupt},
+		{"no syncword", append([]byte{0}, frame[1:]...), errNoSync},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDecoder().Decode(tt.frame)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
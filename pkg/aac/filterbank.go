@@ -0,0 +1,211 @@
+package aac
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Rising halves of the windows by shape
+var (
+	longWindows  = [2][]float64{sineWindow: sineRise(1024), kbdWindow: kbdRise(1024, 4)}
+	shortWindows = [2][]float64{sineWindow: sineRise(128), kbdWindow: kbdRise(128, 6)}
+)
+
+// sineRise is the rising half of the sine window of 2n samples
+func sineRise(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = math.Sin(math.Pi / float64(2*n) * (float64(i) + 0.5))
+	}
+	return w
+}
+
+// kbdRise is the rising half of the Kaiser-Bessel derived window
+// of 2n samples
+func kbdRise(n int, alpha float64) []float64 {
+	kernel := make([]float64, n+1)
+	total := 0.0
+	for i := range kernel {
+		x := (float64(i) - float64(n)/2) / (float64(n) / 2)
+		kernel[i] = besselI0(math.Pi * alpha * math.Sqrt(1-x*x))
+		total += kernel[i]
+	}
+	w := make([]float64, n)
+	sum := 0.0
+	for i := range w {
+		sum += kernel[i]
+		w[i] = math.Sqrt(sum / total)
+	}
+	return w
+}
+
+// besselI0 is the modified Bessel function of the first kind of order zero
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-16; k++ {
+		term *= (x / 2 / float64(k)) * (x / 2 / float64(k))
+		sum += term
+	}
+	return sum
+}
+
+// fft is a radix-2 complex FFT of a power of two size
+type fft struct {
+	rev     []int
+	twiddle []complex128
+}
+
+func newFFT(n int) *fft {
+	f := &fft{rev: make([]int, n), twiddle: make([]complex128, n/2)}
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	for i := range f.rev {
+		for b := 0; b < bits; b++ {
+			f.rev[i] |= (i >> b & 1) << (bits - 1 - b)
+		}
+	}
+	for k := range f.twiddle {
+		f.twiddle[k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n)))
+	}
+	return f
+}
+
+// transform x in place
+func (f *fft) transform(x []complex128) {
+	n := len(x)
+	for i, j := range f.rev {
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half, step := size/2, n/size
+		for start := 0; start < n; start += size {
+			for k := 0; k < half; k++ {
+				t := x[start+k+half] * f.twiddle[k*step]
+				x[start+k+half] = x[start+k] - t
+				x[start+k] += t
+			}
+		}
+	}
+}
+
+// imdct is the inverse modified discrete cosine transform of m
+// spectral lines to 2m samples, scaled by 1/m
+// It is computed as a DCT-IV with an FFT of m/2 points.
+type imdct struct {
+	m         int
+	pre, post []complex128
+	fft       *fft
+	z         []complex128
+	u         []float64
+}
+
+func newIMDCT(m int) *imdct {
+	t := &imdct{
+		m:    m,
+		pre:  make([]complex128, m/2),
+		post: make([]complex128, m/2),
+		fft:  newFFT(m / 2),
+		z:    make([]complex128, m/2),
+		u:    make([]float64, m),
+	}
+	for j := range t.pre {
+		t.pre[j] = cmplx.Exp(complex(0, -math.Pi*(float64(j)+0.25)/float64(m))) / complex(float64(m), 0)
+		t.post[j] = cmplx.Exp(complex(0, -math.Pi*float64(j)/float64(m)))
+	}
+	return t
+}
+
+// transform the spectrum of m lines to the 2m samples of out
+func (t *imdct) transform(spec, out []float64) {
+	m := t.m
+	for j := range t.z {
+		t.z[j] = complex(spec[2*j], spec[m-1-2*j]) * t.pre[j]
+	}
+	t.fft.transform(t.z)
+	for p, z := range t.z {
+		z *= t.post[p]
+		t.u[2*p] = real(z)
+		t.u[m-1-2*p] = -imag(z)
+	}
+	for n := 0; n < m/2; n++ {
+		out[n] = t.u[n+m/2]
+	}
+	for n := m / 2; n < 3*m/2; n++ {
+		out[n] = -t.u[3*m/2-1-n]
+	}
+	for n := 3 * m / 2; n < 2*m; n++ {
+		out[n] = -t.u[n-3*m/2]
+	}
+}
+
+// channelState is the overlap of a channel between frames
+type channelState struct {
+	overlap     [1024]float64
+	windowShape int
+}
+
+// filterbank transforms the spectra to the time domain with overlap-add
+type filterbank struct {
+	long, short *imdct
+	buf         [2048]float64
+	window      [256]float64
+}
+
+func newFilterbank() *filterbank {
+	return &filterbank{long: newIMDCT(1024), short: newIMDCT(128)}
+}
+
+// synthesize the 1024 samples of the channel spectrum into out
+func (fb *filterbank) synthesize(st *channelState, info *icsInfo, spec *[1024]float64, out []float64) {
+	prevLong, prevShort := longWindows[st.windowShape], shortWindows[st.windowShape]
+	curLong, curShort := longWindows[info.windowShape], shortWindows[info.windowShape]
+	buf := fb.buf[:]
+	if info.short() {
+		clear(buf)
+		for w := 0; w < 8; w++ {
+			fb.short.transform(spec[w*128:w*128+128], fb.window[:])
+			rise := curShort
+			if w == 0 {
+				rise = prevShort
+			}
+			for n := 0; n < 128; n++ {
+				buf[448+128*w+n] += fb.window[n] * rise[n]
+				buf[448+128*w+128+n] += fb.window[128+n] * curShort[127-n]
+			}
+		}
+	} else {
+		fb.long.transform(spec[:], buf)
+		switch info.windowSequence {
+		case onlyLongSequence:
+			for n := 0; n < 1024; n++ {
+				buf[n] *= prevLong[n]
+				buf[1024+n] *= curLong[1023-n]
+			}
+		case longStartSequence:
+			for n := 0; n < 1024; n++ {
+				buf[n] *= prevLong[n]
+			}
+			for n := 0; n < 128; n++ {
+				buf[1472+n] *= curShort[127-n]
+			}
+			clear(buf[1600:])
+		case longStopSequence:
+			clear(buf[:448])
+			for n := 0; n < 128; n++ {
+				buf[448+n] *= prevShort[n]
+			}
+			for n := 0; n < 1024; n++ {
+				buf[1024+n] *= curLong[1023-n]
+			}
+		}
+	}
+	for n := 0; n < 1024; n++ {
+		out[n] = buf[n] + st.overlap[n]
+	}
+	copy(st.overlap[:], buf[1024:])
+	st.windowShape = info.windowShape
+}
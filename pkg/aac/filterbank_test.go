@@ -0,0 +1,131 @@
+package aac
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mdct is the forward transform of 2m samples to m lines
+func mdct(x []float64) []float64 {
+	m := len(x) / 2
+	spec := make([]float64, m)
+	for k := range spec {
+		for n, v := range x {
+			spec[k] += 2 * v * math.Cos(math.Pi/float64(m)*(float64(n)+float64(m)/2+0.5)*(float64(k)+0.5))
+		}
+	}
+	return spec
+}
+
+func TestIMDCT(t *testing.T) {
+	for _, m := range []int{128, 1024} {
+		spec := make([]float64, m)
+		for k := range spec {
+			spec[k] = rand.Float64()*2 - 1
+		}
+		out := make([]float64, 2*m)
+		newIMDCT(m).transform(spec, out)
+		for n := 0; n < 2*m; n += 7 {
+			expected := 0.0
+			for k, v := range spec {
+				expected += v * math.Cos(math.Pi/float64(m)*(float64(n)+float64(m)/2+0.5)*(float64(k)+0.5))
+			}
+			assert.InDelta(t, expected/float64(m), out[n], 1e-9)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	for _, windows := range [][2][]float64{longWindows, shortWindows} {
+		for shape, w := range windows {
+			n := len(w)
+			for i := range w {
+				// Princen-Bradley condition for the perfect reconstruction
+				assert.InDelta(t, 1.0, w[i]*w[i]+w[n-1-i]*w[n-1-i], 1e-9, "shape %d of %d", shape, n)
+			}
+			assert.Less(t, w[0], w[n-1])
+		}
+	}
+}
+
+// analyze the frame of 2048 samples to its spectrum with the windows
+// of the decoder
+func analyze(x []float64, info *icsInfo, prevShape int) *[1024]float64 {
+	prevLong, prevShort := longWindows[prevShape], shortWindows[prevShape]
+	curLong, curShort := longWindows[info.windowShape], shortWindows[info.windowShape]
+	var spec [1024]float64
+	if info.short() {
+		for w := 0; w < 8; w++ {
+			rise := curShort
+			if w == 0 {
+				rise = prevShort
+			}
+			block := make([]float64, 256)
+			for n := 0; n < 128; n++ {
+				block[n] = x[448+128*w+n] * rise[n]
+				block[128+n] = x[448+128*w+128+n] * curShort[127-n]
+			}
+			copy(spec[w*128:], mdct(block))
+		}
+		return &spec
+	}
+	z := make([]float64, 2048)
+	for n := range z {
+		window := 1.0
+		switch {
+		case n < 1024 && info.windowSequence == longStopSequence:
+			if n < 448 {
+				window = 0
+			} else if n < 576 {
+				window = prevShort[n-448]
+			}
+		case n < 1024:
+			window = prevLong[n]
+		case info.windowSequence == longStartSequence:
+			if n >= 1600 {
+				window = 0
+			} else if n >= 1472 {
+				window = curShort[1599-n]
+			}
+		default:
+			window = curLong[2047-n]
+		}
+		z[n] = x[n] * window
+	}
+	copy(spec[:], mdct(z))
+	return &spec
+}
+
+func TestFilterbank_Reconstruction(t *testing.T) {
+	frames := []icsInfo{
+		{windowSequence: onlyLongSequence, windowShape: sineWindow},
+		{windowSequence: longStartSequence, windowShape: kbdWindow},
+		{windowSequence: eightShortSequence, windowShape: kbdWindow},
+		{windowSequence: eightShortSequence, windowShape: sineWindow},
+		{windowSequence: longStopSequence, windowShape: sineWindow},
+		{windowSequence: onlyLongSequence, windowShape: kbdWindow},
+		{windowSequence: onlyLongSequence, windowShape: sineWindow},
+	}
+	x := make([]float64, 1024*(len(frames)+1))
+	for i := range x {
+		x[i] = rand.Float64()*20000 - 10000
+	}
+	fb := newFilterbank()
+	st := &channelState{}
+	out := make([]float64, 1024)
+	for i, info := range frames {
+		spec := analyze(x[1024*i:1024*i+2048], &info, st.windowShape)
+		fb.synthesize(st, &info, spec, out)
+		if i == 0 {
+			continue // no overlap of a previous frame
+		}
+		for n := 0; n < 1024; n++ {
+			if !assert.InDelta(t, x[1024*i+n], out[n], 1e-6, "frame %d sample %d", i, n) {
+				return
+			}
+		}
+	}
+}
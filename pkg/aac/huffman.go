@@ -0,0 +1,114 @@
+package aac
+
+import "fmt"
+
+// codebook is a Huffman codebook
+// The decoding tree is built from the codewords on first use.
+type codebook struct {
+	codes []uint32
+	bits  []uint8
+	tree  [][2]int32 // children of the nodes, a leaf is the complement of its symbol
+}
+
+func (c *codebook) build() {
+	c.tree = make([][2]int32, 1, 2*len(c.codes))
+	for sym, code := range c.codes {
+		node := int32(0)
+		for i := int(c.bits[sym]) - 1; i > 0; i-- {
+			b := code >> i & 1
+			if c.tree[node][b] == 0 {
+				c.tree = append(c.tree, [2]int32{})
+				c.tree[node][b] = int32(len(c.tree) - 1)
+			}
+			node = c.tree[node][b]
+		}
+		c.tree[node][code&1] = ^int32(sym)
+	}
+}
+
+// decode the next symbol
+// The codebooks are complete, so every path ends with a symbol.
+func (c *codebook) decode(r *bitReader) int {
+	node := int32(0)
+	for {
+		node = c.tree[node][r.bit()]
+		if node < 0 {
+			return int(^node)
+		}
+	}
+}
+
+func init() {
+	scalefactorCodes.build()
+	for i := range spectralCodes {
+		spectralCodes[i].build()
+	}
+}
+
+// Special band types of the section data
+const (
+	zeroHCB       = 0
+	escHCB        = 11
+	noiseHCB      = 13
+	intensityHCB2 = 14 // out of phase
+	intensityHCB  = 15 // in phase
+)
+
+// spectralBooks are the layouts of the spectrum codebooks 1 to 11
+var spectralBooks = [11]struct {
+	dim      int  // values of a codeword
+	unsigned bool // signs follow the codeword
+	mod      int  // range of a value
+}{
+	{4, false, 3}, {4, false, 3}, {4, true, 3}, {4, true, 3},
+	{2, false, 9}, {2, false, 9}, {2, true, 8}, {2, true, 8},
+	{2, true, 13}, {2, true, 13}, {2, true, 17},
+}
+
+// decodeScalefactor reads a scalefactor difference
+func decodeScalefactor(r *bitReader) int {
+	return scalefactorCodes.decode(r) - 60
+}
+
+// decodeSpectral reads the quantized values of a codeword of the codebook
+// into q, which has the dimension of the codebook
+func decodeSpectral(r *bitReader, cb int, q []int32) error {
+	book := &spectralBooks[cb-1]
+	idx := spectralCodes[cb-1].decode(r)
+	for i := book.dim - 1; i >= 0; i-- {
+		q[i] = int32(idx % book.mod)
+		idx /= book.mod
+	}
+	if !book.unsigned {
+		off := int32(book.mod-1) / 2
+		for i := range q {
+			q[i] -= off
+		}
+		return nil
+	}
+	for i := range q {
+		if q[i] != 0 && r.flag() {
+			q[i] = -q[i]
+		}
+	}
+	if cb != escHCB {
+		return nil
+	}
+	for i := range q {
+		if q[i] != 16 && q[i] != -16 {
+			continue
+		}
+		n := 4
+		for r.flag() {
+			if n++; n > 12 {
+				return fmt.Errorf("%w: escape sequence too long", ErrCorrupt)
+			}
+		}
+		v := int32(1)<<n | int32(r.read(n))
+		if q[i] < 0 {
+			v = -v
+		}
+		q[i] = v
+	}
+	return nil
+}
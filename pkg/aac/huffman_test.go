@@ -0,0 +1,74 @@
+package aac
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodebooks(t *testing.T) {
+	books := append([]*codebook{&scalefactorCodes}, func() []*codebook {
+		var books []*codebook
+		for i := range spectralCodes {
+			books = append(books, &spectralCodes[i])
+		}
+		return books
+	}()...)
+	for i, c := range books {
+		// A complete prefix code decodes every codeword to its symbol
+		kraft := 0.0
+		w := &bitWriter{}
+		for sym := range c.codes {
+			kraft += math.Exp2(-float64(c.bits[sym]))
+			w.code(c, sym)
+		}
+		assert.Equal(t, 1.0, kraft, "codebook %d", i)
+		r := newBitReader(w.data)
+		for sym := range c.codes {
+			assert.Equal(t, sym, c.decode(r), "codebook %d", i)
+		}
+		assert.Equal(t, w.n, r.pos)
+	}
+}
+
+func TestDecodeSpectral(t *testing.T) {
+	tests := []struct {
+		cb       int
+		values   []int32
+		expected []int32
+	}{
+		{1, []int32{-1, 0, 1, 0}, []int32{-1, 0, 1, 0}},
+		{4, []int32{2, 0, 1, 2}, []int32{2, 0, -1, -2}},
+		{6, []int32{-4, 4}, []int32{-4, 4}},
+		{9, []int32{12, 3}, []int32{-12, 3}},
+		{11, []int32{16, 0}, []int32{-300, 0}},
+	}
+	for _, tt := range tests {
+		book := spectralBooks[tt.cb-1]
+		idx := 0
+		for _, v := range tt.values {
+			if book.unsigned {
+				idx = idx*book.mod + int(v)
+			} else {
+				idx = idx*book.mod + int(v) + (book.mod-1)/2
+			}
+		}
+		w := &bitWriter{}
+		w.code(&spectralCodes[tt.cb-1], idx)
+		if book.unsigned {
+			for i, v := range tt.values {
+				if v != 0 {
+					w.write(sign(int(tt.expected[i])), 1)
+				}
+			}
+		}
+		if tt.cb == escHCB {
+			w.write(0b11110, 5) // 300 = 256 + 44
+			w.write(44, 8)
+		}
+		q := make([]int32, book.dim)
+		assert.NoError(t, decodeSpectral(newBitReader(w.data), tt.cb, q))
+		assert.Equal(t, tt.expected, q, "codebook %d", tt.cb)
+	}
+}
@@ -0,0 +1,370 @@
+package aac
+
+import (
+	"fmt"
+	"math"
+)
+
+// Window sequences
+const (
+	onlyLongSequence = iota
+	longStartSequence
+	eightShortSequence
+	longStopSequence
+)
+
+// Window shapes
+const (
+	sineWindow = iota
+	kbdWindow
+)
+
+// icsInfo describes the windows of a channel
+type icsInfo struct {
+	windowSequence int
+	windowShape    int
+	maxSFB         int
+	numGroups      int
+	groupLen       [8]int
+	swbOffset      []int // band offsets of a window
+	tnsMaxBands    int
+}
+
+func (info *icsInfo) short() bool {
+	return info.windowSequence == eightShortSequence
+}
+
+// read the ics_info of the sampling frequency index
+func (info *icsInfo) read(r *bitReader, rateIndex int) error {
+	r.skip(1) // ics_reserved_bit
+	info.windowSequence = int(r.read(2))
+	info.windowShape = int(r.read(1))
+	info.numGroups = 1
+	info.groupLen = [8]int{1}
+	if info.short() {
+		info.maxSFB = int(r.read(4))
+		grouping := r.read(7)
+		for i := 6; i >= 0; i-- {
+			if grouping>>i&1 == 1 {
+				info.groupLen[info.numGroups-1]++
+			} else {
+				info.numGroups++
+				info.groupLen[info.numGroups-1] = 1
+			}
+		}
+		info.swbOffset = swbOffsetShort[rateIndex]
+		info.tnsMaxBands = tnsMaxBandsShort[rateIndex]
+	} else {
+		info.maxSFB = int(r.read(6))
+		if r.flag() {
+			return fmt.Errorf("%w: prediction is not AAC-LC", ErrUnsupported)
+		}
+		info.swbOffset = swbOffsetLong[rateIndex]
+		info.tnsMaxBands = tnsMaxBandsLong[rateIndex]
+	}
+	if info.maxSFB > len(info.swbOffset)-1 {
+		return fmt.Errorf("%w: %d scalefactor bands", ErrCorrupt, info.maxSFB)
+	}
+	return nil
+}
+
+// tnsFilter is a temporal noise shaping filter of a window
+type tnsFilter struct {
+	length   int // bands
+	order    int
+	downward bool
+	lpc      [tnsMaxOrderLong + 1]float64
+}
+
+// channelStream is an individual channel stream with its spectrum
+// The windows of a short sequence have 128 spectral lines each.
+type channelStream struct {
+	info       icsInfo
+	globalGain int
+	bandType   [8][64]int // by window group and scalefactor band
+	sf         [8][64]int
+	pulses     []pulse
+	tnsFilters [8][]tnsFilter // by window
+	quant      [1024]int32
+	spec       [1024]float64
+}
+
+// pulse is an amplitude added to a quantized spectral line
+type pulse struct {
+	line int
+	amp  int32
+}
+
+// read the individual_channel_stream
+// A common window was read with the channel pair element.
+func (cs *channelStream) read(r *bitReader, rateIndex int, commonWindow bool) error {
+	cs.globalGain = int(r.read(8))
+	if !commonWindow {
+		if err := cs.info.read(r, rateIndex); err != nil {
+			return err
+		}
+	}
+	if err := cs.readSections(r); err != nil {
+		return err
+	}
+	if err := cs.readScalefactors(r); err != nil {
+		return err
+	}
+	cs.pulses = cs.pulses[:0]
+	if r.flag() {
+		if err := cs.readPulses(r); err != nil {
+			return err
+		}
+	}
+	for w := range cs.tnsFilters {
+		cs.tnsFilters[w] = cs.tnsFilters[w][:0]
+	}
+	if r.flag() {
+		if err := cs.readTNS(r); err != nil {
+			return err
+		}
+	}
+	if r.flag() {
+		return fmt.Errorf("%w: gain control is not AAC-LC", ErrUnsupported)
+	}
+	if err := cs.readSpectrum(r); err != nil {
+		return err
+	}
+	if r.overrun {
+		return fmt.Errorf("%w: channel stream overruns the frame", ErrCorrupt)
+	}
+	cs.dequantize()
+	return nil
+}
+
+// readSections reads the codebooks of the scalefactor bands
+func (cs *channelStream) readSections(r *bitReader) error {
+	bits, esc := 5, uint32(31)
+	if cs.info.short() {
+		bits, esc = 3, 7
+	}
+	for g := 0; g < cs.info.numGroups; g++ {
+		for k := 0; k < cs.info.maxSFB; {
+			cb := int(r.read(4))
+			if cb == 12 {
+				return fmt.Errorf("%w: reserved codebook", ErrCorrupt)
+			}
+			n := 0
+			for {
+				incr := r.read(bits)
+				n += int(incr)
+				if incr != esc {
+					break
+				}
+			}
+			if r.overrun || k+n > cs.info.maxSFB {
+				return fmt.Errorf("%w: section overruns the bands", ErrCorrupt)
+			}
+			for ; n > 0; n-- {
+				cs.bandType[g][k] = cb
+				k++
+			}
+		}
+	}
+	return nil
+}
+
+// readScalefactors reads the scalefactors, noise energies and
+// intensity positions of the bands
+func (cs *channelStream) readScalefactors(r *bitReader) error {
+	scalefactor, noise, position := cs.globalGain, cs.globalGain-90, 0
+	firstNoise := true
+	for g := 0; g < cs.info.numGroups; g++ {
+		for sfb := 0; sfb < cs.info.maxSFB; sfb++ {
+			switch cs.bandType[g][sfb] {
+			case zeroHCB:
+				cs.sf[g][sfb] = 0
+			case intensityHCB, intensityHCB2:
+				position += decodeScalefactor(r)
+				cs.sf[g][sfb] = position
+			case noiseHCB:
+				if firstNoise {
+					firstNoise = false
+					noise += int(r.read(9)) - 256
+				} else {
+					noise += decodeScalefactor(r)
+				}
+				cs.sf[g][sfb] = noise
+			default:
+				scalefactor += decodeScalefactor(r)
+				if scalefactor < 0 || scalefactor > 255 {
+					return fmt.Errorf("%w: scalefactor %d", ErrCorrupt, scalefactor)
+				}
+				cs.sf[g][sfb] = scalefactor
+			}
+		}
+	}
+	return nil
+}
+
+// readPulses reads the pulse data of a long window
+func (cs *channelStream) readPulses(r *bitReader) error {
+	if cs.info.short() {
+		return fmt.Errorf("%w: pulses in short windows", ErrCorrupt)
+	}
+	n := int(r.read(2)) + 1
+	start := int(r.read(6))
+	if start >= len(cs.info.swbOffset)-1 {
+		return fmt.Errorf("%w: pulses start at band %d", ErrCorrupt, start)
+	}
+	line := cs.info.swbOffset[start]
+	for i := 0; i < n; i++ {
+		line += int(r.read(5))
+		if line >= 1024 {
+			return fmt.Errorf("%w: pulse at line %d", ErrCorrupt, line)
+		}
+		cs.pulses = append(cs.pulses, pulse{line: line, amp: int32(r.read(4))})
+	}
+	return nil
+}
+
+// readTNS reads the temporal noise shaping filters of the windows
+func (cs *channelStream) readTNS(r *bitReader) error {
+	windows, filtBits, lengthBits, orderBits, maxOrder := 1, 2, 6, 5, tnsMaxOrderLong
+	if cs.info.short() {
+		windows, filtBits, lengthBits, orderBits, maxOrder = 8, 1, 4, 3, tnsMaxOrderShort
+	}
+	for w := 0; w < windows; w++ {
+		n := int(r.read(filtBits))
+		if n == 0 {
+			continue
+		}
+		resolution := int(r.read(1)) + 3
+		for i := 0; i < n; i++ {
+			f := tnsFilter{length: int(r.read(lengthBits)), order: int(r.read(orderBits))}
+			if f.order > maxOrder {
+				return fmt.Errorf("%w: TNS filter order %d", ErrCorrupt, f.order)
+			}
+			if f.order > 0 {
+				f.downward = r.flag()
+				bits := resolution - int(r.read(1))
+				var coef [tnsMaxOrderLong]float64
+				for j := 0; j < f.order; j++ {
+					coef[j] = tnsCoefficient(int(r.read(bits)), bits, resolution)
+				}
+				f.lpc = lpc(coef[:f.order])
+			}
+			cs.tnsFilters[w] = append(cs.tnsFilters[w], f)
+		}
+	}
+	return nil
+}
+
+// tnsCoefficient dequantizes a reflection coefficient of the bits
+// at the coefficient resolution
+func tnsCoefficient(v, bits, resolution int) float64 {
+	if v&(1<<(bits-1)) != 0 {
+		v -= 1 << bits
+	}
+	steps := float64(int(1)<<(resolution-1)) - 0.5
+	if v < 0 {
+		steps++
+	}
+	return math.Sin(float64(v) / steps * math.Pi / 2)
+}
+
+// lpc converts the reflection coefficients to the prediction filter
+func lpc(coef []float64) [tnsMaxOrderLong + 1]float64 {
+	var a, b [tnsMaxOrderLong + 1]float64
+	a[0] = 1
+	for m := 1; m <= len(coef); m++ {
+		for i := 1; i < m; i++ {
+			b[i] = a[i] + coef[m-1]*a[m-i]
+		}
+		copy(a[1:m], b[1:m])
+		a[m] = coef[m-1]
+	}
+	return a
+}
+
+// readSpectrum reads the quantized spectrum of the bands
+// The bands of a window group are interleaved by window.
+func (cs *channelStream) readSpectrum(r *bitReader) error {
+	clear(cs.quant[:])
+	swb := cs.info.swbOffset
+	win := 0
+	for g := 0; g < cs.info.numGroups; g++ {
+		for sfb := 0; sfb < cs.info.maxSFB; sfb++ {
+			cb := cs.bandType[g][sfb]
+			if cb == zeroHCB || cb >= noiseHCB {
+				continue
+			}
+			dim := spectralBooks[cb-1].dim
+			for w := win; w < win+cs.info.groupLen[g]; w++ {
+				for k := swb[sfb]; k < swb[sfb+1]; k += dim {
+					line := w*128 + k
+					if err := decodeSpectral(r, cb, cs.quant[line:line+dim]); err != nil {
+						return err
+					}
+				}
+			}
+			if r.overrun {
+				return fmt.Errorf("%w: spectrum overruns the frame", ErrCorrupt)
+			}
+		}
+		win += cs.info.groupLen[g]
+	}
+	for _, p := range cs.pulses {
+		if cs.quant[p.line] > 0 {
+			cs.quant[p.line] += p.amp
+		} else {
+			cs.quant[p.line] -= p.amp
+		}
+	}
+	return nil
+}
+
+// dequantize the spectrum of the bands with their scalefactors
+// The noise and intensity bands are filled by the stereo tools.
+func (cs *channelStream) dequantize() {
+	clear(cs.spec[:])
+	swb := cs.info.swbOffset
+	win := 0
+	for g := 0; g < cs.info.numGroups; g++ {
+		for sfb := 0; sfb < cs.info.maxSFB; sfb++ {
+			cb := cs.bandType[g][sfb]
+			if cb == zeroHCB || cb >= noiseHCB {
+				continue
+			}
+			gain := math.Exp2(0.25 * float64(cs.sf[g][sfb]-100))
+			for w := win; w < win+cs.info.groupLen[g]; w++ {
+				for k := w*128 + swb[sfb]; k < w*128+swb[sfb+1]; k++ {
+					cs.spec[k] = dequantize(cs.quant[k]) * gain
+				}
+			}
+		}
+		win += cs.info.groupLen[g]
+	}
+}
+
+// pow43 caches the powers of the quantized values
+var pow43 [8192]float64
+
+func init() {
+	for i := range pow43 {
+		pow43[i] = math.Pow(float64(i), 4.0/3)
+	}
+}
+
+// dequantize the quantized value as sign(q)*|q|^(4/3)
+func dequantize(q int32) float64 {
+	x := q
+	if x < 0 {
+		x = -x
+	}
+	v := 0.0
+	if int(x) < len(pow43) {
+		v = pow43[x]
+	} else {
+		v = math.Pow(float64(x), 4.0/3)
+	}
+	if q < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,167 @@
+package aac
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoFrames is the error of a stream without ADTS frames
+var ErrNoFrames = errors.New("no ADTS frames")
+
+// id3HeaderSize is the size of an ID3v2 tag header, which may start
+// the segments of an HLS stream
+const id3HeaderSize = 10
+
+// Format of the decoded samples
+type Format struct {
+	SampleRate int
+	Channels   int
+}
+
+// Reader reads an ADTS stream as interleaved 16-bit little-endian
+// PCM samples. ID3 tags and bytes between the frames are skipped.
+// A corrupt frame is decoded to silence, so that the timing of the
+// stream is kept.
+type Reader struct {
+	r       *bufio.Reader
+	decoder *Decoder
+	header  Header
+	started bool
+	frame   []byte
+	pcm     []byte
+	err     error
+	corrupt int
+	skipped int64
+	offset  int64 // of the frame in the stream
+}
+
+// NewReader creates the reader of the ADTS stream
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), decoder: NewDecoder()}
+}
+
+// Format decodes the first frame for the format of the stream
+func (r *Reader) Format() (Format, error) {
+	if !r.started {
+		if err := r.next(); err != nil {
+			return Format{}, err
+		}
+	}
+	return Format{SampleRate: r.decoder.SampleRate(), Channels: r.decoder.Channels()}, nil
+}
+
+// Corrupt is the number of corrupt frames decoded to silence
+func (r *Reader) Corrupt() int {
+	return r.corrupt
+}
+
+// Skipped is the number of bytes skipped between the frames
+func (r *Reader) Skipped() int64 {
+	return r.skipped
+}
+
+// Read the samples
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pcm) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.pcm)
+	r.pcm = r.pcm[n:]
+	return n, nil
+}
+
+// next decodes the next frame to the samples
+func (r *Reader) next() error {
+	h, err := r.sync()
+	if err == io.EOF && !r.started {
+		return ErrNoFrames
+	}
+	if err != nil {
+		return err
+	}
+	if cap(r.frame) < h.Length {
+		r.frame = make([]byte, h.Length)
+	}
+	r.frame = r.frame[:h.Length]
+	if _, err := io.ReadFull(r.r, r.frame); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF // the last frame is cut off
+		}
+		return err
+	}
+	samples, err := r.decoder.Decode(r.frame)
+	if errors.Is(err, ErrCorrupt) && r.decoder.Channels() > 0 {
+		r.corrupt++
+		r.decoder.Reset()
+		samples = make([]int16, FrameSamples*h.Blocks*r.decoder.Channels())
+	} else if err != nil {
+		return fmt.Errorf("frame at byte %d: %w", r.offset, err)
+	}
+	r.offset += int64(h.Length)
+	r.started = true
+	r.header = h
+	r.pcm = r.pcm[:0]
+	for _, s := range samples {
+		r.pcm = append(r.pcm, byte(s), byte(uint16(s)>>8))
+	}
+	return nil
+}
+
+// sync skips to the next frame header matching the stream
+func (r *Reader) sync() (Header, error) {
+	for {
+		b, err := r.r.Peek(id3HeaderSize)
+		if len(b) < HeaderSize {
+			if err == nil || err == io.EOF {
+				r.skipped += int64(len(b))
+				return Header{}, io.EOF
+			}
+			return Header{}, err
+		}
+		if size, ok := id3Size(b); ok {
+			n, err := r.r.Discard(size)
+			r.skipped += int64(n)
+			r.offset += int64(n)
+			if err != nil {
+				return Header{}, io.EOF
+			}
+			continue
+		}
+		h, err := ParseHeader(b)
+		if err == nil && (!r.started || r.matches(h)) {
+			return h, nil
+		}
+		r.r.Discard(1)
+		r.skipped++
+		r.offset++
+	}
+}
+
+// matches checks that the header has the format of the previous frames
+func (r *Reader) matches(h Header) bool {
+	return h.Profile == r.header.Profile && h.RateIndex == r.header.RateIndex &&
+		h.ChannelConfig == r.header.ChannelConfig
+}
+
+// id3Size is the size of the ID3v2 tag at the start of b, if any
+func id3Size(b []byte) (int, bool) {
+	if len(b) < id3HeaderSize || string(b[:3]) != "ID3" {
+		return 0, false
+	}
+	size := 0
+	for _, c := range b[6:10] {
+		if c&0x80 != 0 {
+			return 0, false
+		}
+		size = size<<7 | int(c) // syncsafe integer
+	}
+	if b[5]&0x10 != 0 {
+		size += id3HeaderSize // footer
+	}
+	return id3HeaderSize + size, true
+}
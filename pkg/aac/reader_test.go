@@ -0,0 +1,55 @@
+package aac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	frame := monoFrame(line{index: 100, value: 5000})
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05"), "HELLO"...)
+	corrupt := adtsFrame(1, frame[HeaderSize:len(frame)-1])
+	var stream []byte
+	stream = append(stream, id3...)
+	stream = append(stream, frame...)
+	stream = append(stream, 0xff, 0x00, 0x12) // garbage between the frames
+	stream = append(stream, frame...)
+	stream = append(stream, corrupt...)
+	stream = append(stream, id3...)
+	stream = append(stream, frame...)
+	stream = append(stream, frame[:20]...) // cut off
+
+	r := NewReader(bytes.NewReader(stream))
+	format, err := r.Format()
+	assert.NoError(t, err)
+	assert.Equal(t, Format{SampleRate: 48000, Channels: 1}, format)
+	pcm, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Len(t, pcm, 4*FrameSamples*2)
+	assert.Equal(t, 1, r.Corrupt())
+	assert.Equal(t, int64(2*len(id3)+3), r.Skipped())
+
+	samples := make([]int16, len(pcm)/2)
+	binary.Read(bytes.NewReader(pcm), binary.LittleEndian, samples)
+	assert.NotEqual(t, make([]int16, FrameSamples), samples[FrameSamples:2*FrameSamples])
+	assert.Equal(t, make([]int16, FrameSamples), samples[2*FrameSamples:3*FrameSamples], "corrupt frame")
+}
+
+func TestReader_NoFrames(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte("not an ADTS stream")))
+	_, err := r.Format()
+	assert.ErrorIs(t, err, ErrNoFrames)
+	_, err = io.ReadAll(NewReader(bytes.NewReader(nil)))
+	assert.ErrorIs(t, err, ErrNoFrames)
+}
+
+func TestReader_Unsupported(t *testing.T) {
+	frame := monoFrame()
+	frame[2] &^= 0xc0 // AAC Main
+	_, err := io.ReadAll(NewReader(bytes.NewReader(frame)))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
@@ -0,0 +1,130 @@
+package aac
+
+import "math"
+
+// msMask is the mid/side stereo of the bands of a channel pair
+type msMask struct {
+	present int // 0 none, 1 by band, 2 all bands
+	used    [8][64]bool
+}
+
+// read the ms_mask of the common window
+func (m *msMask) read(r *bitReader, info *icsInfo) {
+	m.present = int(r.read(2))
+	for g := 0; g < info.numGroups; g++ {
+		for sfb := 0; sfb < info.maxSFB; sfb++ {
+			switch m.present {
+			case 1:
+				m.used[g][sfb] = r.flag()
+			case 2:
+				m.used[g][sfb] = true
+			default:
+				m.used[g][sfb] = false
+			}
+		}
+	}
+}
+
+// noise generates the perceptual noise substitution of the noise bands
+// The noise of a mid/side band pair is the same in both channels.
+func (d *Decoder) noise(cs *channelStream, left *channelStream, ms *msMask) {
+	swb := cs.info.swbOffset
+	win := 0
+	for g := 0; g < cs.info.numGroups; g++ {
+		for sfb := 0; sfb < cs.info.maxSFB; sfb++ {
+			if cs.bandType[g][sfb] != noiseHCB {
+				continue
+			}
+			correlated := left != nil && ms.used[g][sfb] && left.bandType[g][sfb] == noiseHCB
+			for w := win; w < win+cs.info.groupLen[g]; w++ {
+				band := cs.spec[w*128+swb[sfb] : w*128+swb[sfb+1]]
+				if correlated {
+					gain := math.Exp2(0.25 * float64(cs.sf[g][sfb]-left.sf[g][sfb]))
+					for i, v := range left.spec[w*128+swb[sfb] : w*128+swb[sfb+1]] {
+						band[i] = v * gain
+					}
+					continue
+				}
+				energy := 0.0
+				for i := range band {
+					d.seed = d.seed*1664525 + 1013904223
+					band[i] = float64(int32(d.seed))
+					energy += band[i] * band[i]
+				}
+				gain := math.Exp2(0.25*float64(cs.sf[g][sfb])) / math.Sqrt(energy)
+				for i := range band {
+					band[i] *= gain
+				}
+			}
+		}
+		win += cs.info.groupLen[g]
+	}
+}
+
+// stereo applies the mid/side and intensity stereo of the channel pair
+func stereo(left, right *channelStream, ms *msMask) {
+	swb := left.info.swbOffset
+	win := 0
+	for g := 0; g < left.info.numGroups; g++ {
+		for sfb := 0; sfb < left.info.maxSFB; sfb++ {
+			switch cb := right.bandType[g][sfb]; {
+			case cb == intensityHCB || cb == intensityHCB2:
+				gain := math.Exp2(-0.25 * float64(right.sf[g][sfb]))
+				if cb == intensityHCB2 {
+					gain = -gain
+				}
+				if ms.present == 1 && ms.used[g][sfb] {
+					gain = -gain
+				}
+				for w := win; w < win+left.info.groupLen[g]; w++ {
+					for k := w*128 + swb[sfb]; k < w*128+swb[sfb+1]; k++ {
+						right.spec[k] = left.spec[k] * gain
+					}
+				}
+			case ms.used[g][sfb] && cb < noiseHCB && left.bandType[g][sfb] < noiseHCB:
+				for w := win; w < win+left.info.groupLen[g]; w++ {
+					for k := w*128 + swb[sfb]; k < w*128+swb[sfb+1]; k++ {
+						left.spec[k], right.spec[k] = left.spec[k]+right.spec[k], left.spec[k]-right.spec[k]
+					}
+				}
+			}
+		}
+		win += left.info.groupLen[g]
+	}
+}
+
+// tns applies the temporal noise shaping filters to the spectrum
+func tns(cs *channelStream) {
+	swb := cs.info.swbOffset
+	limit := min(cs.info.tnsMaxBands, cs.info.maxSFB)
+	for w, filters := range cs.tnsFilters {
+		bottom := len(swb) - 1
+		for _, f := range filters {
+			top := bottom
+			bottom = max(top-f.length, 0)
+			if f.order == 0 {
+				continue
+			}
+			start, end := swb[min(bottom, limit)], swb[min(top, limit)]
+			if start >= end {
+				continue
+			}
+			spec := cs.spec[w*128:]
+			var state [tnsMaxOrderLong]float64
+			k, inc := start, 1
+			if f.downward {
+				k, inc = end-1, -1
+			}
+			for n := start; n < end; n++ {
+				y := spec[k]
+				for j := 0; j < f.order; j++ {
+					y -= f.lpc[j+1] * state[j]
+				}
+				copy(state[1:f.order], state[:f.order-1])
+				state[0] = y
+				spec[k] = y
+				k += inc
+			}
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/daemon"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/encoder"
+	"github.com/antonyho/crhk-recorder/pkg/timeshift"
+)
+
+// Prefix of the API paths
+const Prefix = "/api"
+
+// ErrCommandsDisabled is the error of setting the post-processing
+// or encoder commands of a job without AllowCommands
+var ErrCommandsDisabled = errors.New("post-processing and encoder commands cannot be set through the API")
+
+// Job is the JSON representation of a scheduled job
+type Job struct {
+	daemon.JobConfig
+	Duration  string     `json:"duration,omitempty"` // e.g. 1h30m
+	Recording bool       `json:"recording"`
+	NextStart *time.Time `json:"next_start,omitempty"`
+	NextEnd   *time.Time `json:"next_end,omitempty"`
+}
+
+// StartRequest is the request body of starting an immediate recording
+type StartRequest struct {
+	Channel  string `json:"channel"`
+	Duration string `json:"duration"` // e.g. 30m
+}
+
+// TimeshiftRequest is the request body of saving a buffered range
+// The range is either the last duration, or from and to.
+type TimeshiftRequest struct {
+	Last string     `json:"last,omitempty"` // e.g. 30m
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// Occurrence is a scheduled recording of a job
+type Occurrence struct {
+	Job     string    `json:"job"`
+	Channel string    `json:"channel"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// Active lists the in-flight recordings
+type Active struct {
+	Jobs       []string   `json:"jobs"`
+	Recordings []Progress `json:"recordings"`
+}
+
+// DefaultScheduleDays is the period of the listed schedule
+const DefaultScheduleDays = 7
+
+// maxOccurrences limits the listed schedule of a job
+const maxOccurrences = 1000
+
+// Server serves the JSON API of the daemon
+// Every request is authorised with the bearer token, which can
+// also be given in the token query parameter for media playback.
+// The podcast feeds and recording files can also be read with the
+// media token, and a recording file with the signature of its URL.
+type Server struct {
+	Daemon     *daemon.Daemon
+	Token      string
+	MediaToken string // read-only token of the feeds and recordings
+	TrustProxy bool   // trust X-Forwarded-Proto of a reverse proxy
+	Live       *Live  // progress of the in-flight recordings
+	// AllowCommands permits setting the post-processing and encoder
+	// commands of the jobs, which are executed on the host
+	AllowCommands bool
+
+	mux *http.ServeMux
+}
+
+// New creates the API server of the daemon
+// It observes the recordings of the jobs started afterwards.
+func New(d *daemon.Daemon, token string) *Server {
+	s := &Server{Daemon: d, Token: token, Live: NewLive(), mux: http.NewServeMux()}
+	d.AddObserver(s.Live)
+	s.mux.HandleFunc("GET "+Prefix+"/jobs", s.listJobs)
+	s.mux.HandleFunc("POST "+Prefix+"/jobs", s.createJob)
+	s.mux.HandleFunc("GET "+Prefix+"/jobs/{name}", s.getJob)
+	s.mux.HandleFunc("PUT "+Prefix+"/jobs/{name}", s.updateJob)
+	s.mux.HandleFunc("DELETE "+Prefix+"/jobs/{name}", s.deleteJob)
+	s.mux.HandleFunc("GET "+Prefix+"/schedule", s.listSchedule)
+	s.mux.HandleFunc("GET "+Prefix+"/recordings", s.listRecordings)
+	s.mux.HandleFunc("GET "+filesPath+"{file}", s.serveRecording)
+	s.mux.HandleFunc("GET "+Prefix+"/feeds/channels/{channel}", s.channelFeed)
+	s.mux.HandleFunc("GET "+Prefix+"/feeds/jobs/{job}", s.jobFeed)
+	s.mux.HandleFunc("GET "+Prefix+"/recordings/active", s.listActive)
+	s.mux.HandleFunc("POST "+Prefix+"/recordings/active", s.startRecording)
+	s.mux.HandleFunc("DELETE "+Prefix+"/recordings/active/{name}", s.stopRecording)
+	s.mux.HandleFunc("POST "+Prefix+"/timeshift/{channel}", s.saveTimeshift)
+	s.mux.HandleFunc("GET "+Prefix+"/retention", s.reportRetention)
+	s.mux.HandleFunc("POST "+Prefix+"/retention", s.enforceRetention)
+	return s
+}
+
+// ServeHTTP authorises and serves the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.Authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="crhk-recorder"`)
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Authorized reports whether the request has the bearer token,
+// or reads media with the media token or a signed URL
+func (s *Server) Authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if matchToken(token, s.Token) {
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, Prefix+"/feeds/") || strings.HasPrefix(r.URL.Path, filesPath) {
+		if matchToken(token, s.MediaToken) {
+			return true
+		}
+	}
+	if strings.HasPrefix(r.URL.Path, filesPath) {
+		sig := r.URL.Query().Get("sig")
+		return sig != "" && hmac.Equal([]byte(sig), []byte(s.sign(r.URL.Path)))
+	}
+	return false
+}
+
+// filesPath is the path prefix of the recording files
+const filesPath = Prefix + "/recordings/files/"
+
+// matchToken reports whether the token is the configured one
+func matchToken(token, configured string) bool {
+	return configured != "" && subtle.ConstantTimeCompare([]byte(token), []byte(configured)) == 1
+}
+
+// sign the path with a key derived from the token
+// The signature grants reading the path without revealing the token.
+func (s *Server) sign(path string) string {
+	key := hmac.New(sha256.New, []byte(s.Token))
+	key.Write([]byte("media"))
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(path))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := []Job{}
+	for _, jc := range s.Daemon.JobConfigs() {
+		jobs = append(jobs, s.job(jc))
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	jc, err := s.Daemon.JobConfig(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.job(jc))
+}
+
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	jc, err := readJob(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.checkCommands(jc); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err := s.Daemon.CreateJob(jc); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.job(jc))
+}
+
+func (s *Server) updateJob(w http.ResponseWriter, r *http.Request) {
+	jc, err := readJob(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	jc.Name = r.PathValue("name")
+	if err := s.checkCommands(jc); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err := s.Daemon.UpdateJob(jc); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.job(jc))
+}
+
+func (s *Server) deleteJob(w http.ResponseWriter, r *http.Request) {
+	if err := s.Daemon.DeleteJob(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listRecordings lists the past recordings
+// They can be filtered by channel, job and status query parameters.
+func (s *Server) listRecordings(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.Daemon.Recordings()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	query := r.URL.Query()
+	filtered := []recording.Entry{}
+	for _, e := range entries {
+		if c := query.Get("channel"); c != "" && c != e.Channel {
+			continue
+		}
+		if j := query.Get("job"); j != "" && j != e.Job {
+			continue
+		}
+		if st := query.Get("status"); st != "" && st != string(e.Status) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+// serveRecording serves the media file of a listed recording
+// The download query parameter serves it as an attachment.
+func (s *Server) serveRecording(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.Daemon.Recordings()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	file := r.PathValue("file")
+	for _, e := range entries {
+		if e.File != file {
+			continue
+		}
+		if r.URL.Query().Has("download") {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file}))
+		}
+		w.Header().Set("Content-Type", encoder.ContentType(e.Path))
+		http.ServeFile(w, r, e.Path)
+		return
+	}
+	writeError(w, http.StatusNotFound, errors.New("unknown recording"))
+}
+
+// listSchedule lists the scheduled recordings of the jobs by start time
+// The period starts from the from query parameter in RFC 3339, or now,
+// and lasts for the days query parameter.
+func (s *Server) listSchedule(w http.ResponseWriter, r *http.Request) {
+	from := time.Now()
+	if value := r.URL.Query().Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from = t
+	}
+	days := DefaultScheduleDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		d, err := strconv.Atoi(value)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("incorrect days [%s]", value))
+			return
+		}
+		days = d
+	}
+	until := from.AddDate(0, 0, days)
+
+	cfg := s.Daemon.Config()
+	occurrences := []Occurrence{}
+	for _, jc := range cfg.Jobs {
+		sched, err := jc.Schedule(cfg.Timezone)
+		if err != nil {
+			continue
+		}
+		// Include the recording in progress at the beginning of the period
+		after := from.Add(-24 * time.Hour)
+		for i := 0; i < maxOccurrences; i++ {
+			start, end := sched.Next(after)
+			if start.IsZero() || !start.Before(until) {
+				break
+			}
+			if end.After(from) {
+				occurrences = append(occurrences, Occurrence{Job: jc.Name, Channel: jc.Channel, Start: start, End: end})
+			}
+			after = end
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+	writeJSON(w, http.StatusOK, occurrences)
+}
+
+func (s *Server) listActive(w http.ResponseWriter, r *http.Request) {
+	names := s.Daemon.Recording()
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, Active{Jobs: names, Recordings: s.Live.Recordings()})
+}
+
+func (s *Server) startRecording(w http.ResponseWriter, r *http.Request) {
+	var req StartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	name, err := s.Daemon.StartRecording(req.Channel, duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"job": name})
+}
+
+func (s *Server) stopRecording(w http.ResponseWriter, r *http.Request) {
+	if err := s.Daemon.StopRecording(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveTimeshift saves a range of the channel buffer as a recording
+func (s *Server) saveTimeshift(w http.ResponseWriter, r *http.Request) {
+	var req TimeshiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	to := time.Now()
+	if req.To != nil {
+		to = *req.To
+	}
+	var from time.Time
+	switch {
+	case req.Last != "":
+		last, err := time.ParseDuration(req.Last)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		from = to.Add(-last)
+	case req.From != nil:
+		from = *req.From
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("last or from must be provided"))
+		return
+	}
+	entry, err := s.Daemon.SaveTimeshift(r.PathValue("channel"), from, to)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// reportRetention lists the recordings which the retention rules would remove
+func (s *Server) reportRetention(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Daemon.Prune(true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// enforceRetention removes the recordings by the retention rules immediately
+func (s *Server) enforceRetention(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Daemon.Prune(false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// job gives the JSON representation of the job with its next schedule
+func (s *Server) job(jc daemon.JobConfig) Job {
+	j := Job{JobConfig: jc}
+	if jc.Duration > 0 {
+		j.Duration = jc.Duration.String()
+	}
+	for _, name := range s.Daemon.Recording() {
+		if name == jc.Name {
+			j.Recording = true
+		}
+	}
+	if sched, err := jc.Schedule(s.Daemon.Config().Timezone); err == nil {
+		if start, end := sched.Next(time.Now()); !start.IsZero() {
+			j.NextStart, j.NextEnd = &start, &end
+		}
+	}
+	return j
+}
+
+// checkCommands rejects new post-processing and encoder commands
+// of the job unless they are allowed. The commands of the
+// configuration file can be kept or removed.
+func (s *Server) checkCommands(jc daemon.JobConfig) error {
+	if s.AllowCommands || (len(jc.PostProcess) == 0 && encodeCommand(jc.Output.Encode) == nil) {
+		return nil
+	}
+	existing, err := s.Daemon.JobConfig(jc.Name)
+	if err != nil {
+		return ErrCommandsDisabled
+	}
+	if len(jc.PostProcess) > 0 && !reflect.DeepEqual(existing.PostProcess, jc.PostProcess) {
+		return ErrCommandsDisabled
+	}
+	if cmd := encodeCommand(jc.Output.Encode); cmd != nil &&
+		!reflect.DeepEqual(encodeCommand(existing.Output.Encode), cmd) {
+		return ErrCommandsDisabled
+	}
+	return nil
+}
+
+// encodeCommand returns the command and arguments of the encoder
+// settings, or nil when the defaults of the format are used
+func encodeCommand(e *daemon.Encode) []string {
+	if e == nil || (e.Command == "" && len(e.Args) == 0) {
+		return nil
+	}
+	return append([]string{e.Command}, e.Args...)
+}
+
+// readJob decodes the job of the request body
+func readJob(r *http.Request) (daemon.JobConfig, error) {
+	var j Job
+	if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+		return daemon.JobConfig{}, err
+	}
+	jc := j.JobConfig
+	jc.Duration = 0
+	if j.Duration != "" {
+		d, err := time.ParseDuration(j.Duration)
+		if err != nil {
+			return jc, err
+		}
+		jc.Duration = d
+	}
+	return jc, nil
+}
+
+// statusOf maps the daemon errors to the HTTP status codes
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, daemon.ErrUnknownJob), errors.Is(err, daemon.ErrNotBuffered), errors.Is(err, timeshift.ErrEmptyRange):
+		return http.StatusNotFound
+	case errors.Is(err, daemon.ErrJobExists), errors.Is(err, daemon.ErrNotRecording):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
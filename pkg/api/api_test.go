@@ -0,0 +1,226 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/api"
+	"github.com/antonyho/crhk-recorder/pkg/daemon"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+const token = "s3cr3t"
+
+func newServer(t *testing.T) (*api.Server, string) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "crhk.yaml")
+	config := "output:\n  dir: " + dir + "\njobs:\n  - {name: morning, channel: \"881\", start: \"07:00\", duration: 2h}\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := daemon.New(configPath)
+	if err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return api.New(d, token), dir
+}
+
+func request(s http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	s, _ := newServer(t)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jobs", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServer_Jobs(t *testing.T) {
+	s, _ := newServer(t)
+
+	w := request(s, http.MethodGet, "/api/jobs", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var jobs []map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jobs)) && assert.Len(t, jobs, 1) {
+		assert.Equal(t, "morning", jobs[0]["name"])
+		assert.Equal(t, "2h0m0s", jobs[0]["duration"])
+		assert.NotEmpty(t, jobs[0]["next_start"])
+	}
+
+	w = request(s, http.MethodPost, "/api/jobs", `{"name":"night","channel":"864","start":"23:00","duration":"1h"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = request(s, http.MethodPost, "/api/jobs", `{"name":"night","channel":"864","start":"23:00","duration":"1h"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = request(s, http.MethodPost, "/api/jobs", `{"name":"noon","channel":"864","start":"12:00"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(s, http.MethodPut, "/api/jobs/night", `{"channel":"864","start":"22:00","duration":"90m"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(s, http.MethodGet, "/api/jobs/night", "")
+	var job api.Job
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &job)) {
+		assert.Equal(t, "22:00", job.Start)
+		assert.Equal(t, "1h30m0s", job.Duration)
+	}
+
+	w = request(s, http.MethodDelete, "/api/jobs/morning", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = request(s, http.MethodGet, "/api/jobs/morning", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, []string{"night"}, s.Daemon.Jobs())
+}
+
+func TestServer_Recordings(t *testing.T) {
+	s, dir := newServer(t)
+	start := time.Date(2021, time.January, 24, 7, 0, 0, 0, time.UTC)
+	for i, status := range []recording.Status{recording.StatusCompleted, recording.StatusFailed} {
+		m := recording.Metadata{Channel: "881", Job: "morning", File: string(status) + ".aac", ScheduledStart: start.AddDate(0, 0, i), Status: status}
+		if err := m.Save(filepath.Join(dir, m.File)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := request(s, http.MethodGet, "/api/recordings?status=completed", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries []recording.Entry
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries)) && assert.Len(t, entries, 1) {
+		assert.Equal(t, filepath.Join(dir, "completed.aac"), entries[0].Path)
+	}
+
+	w = request(s, http.MethodGet, "/api/recordings/active", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"jobs":[],"recordings":[]}`, w.Body.String())
+
+	w = request(s, http.MethodPost, "/api/recordings/active", `{"channel":"881"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(s, http.MethodDelete, "/api/recordings/active/morning", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = request(s, http.MethodDelete, "/api/recordings/active/missing", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_Schedule(t *testing.T) {
+	s, _ := newServer(t)
+	w := request(s, http.MethodGet, "/api/schedule?from=2021-01-25T00:00:00Z&days=7", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var occurrences []api.Occurrence
+	// 08:00 in Hong Kong, the recording in progress is included
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &occurrences)) && assert.Len(t, occurrences, 8) {
+		assert.Equal(t, "morning", occurrences[0].Job)
+		assert.Equal(t, 23, occurrences[0].Start.UTC().Hour())
+		assert.Equal(t, 24, occurrences[0].Start.UTC().Day())
+		assert.Equal(t, 2*time.Hour, occurrences[0].End.Sub(occurrences[0].Start))
+		assert.True(t, occurrences[0].Start.Before(occurrences[1].Start))
+	}
+
+	w = request(s, http.MethodGet, "/api/schedule?days=0", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServer_ServeRecording(t *testing.T) {
+	s, dir := newServer(t)
+	m := recording.Metadata{Channel: "881", File: "881.aac", Status: recording.StatusCompleted}
+	if err := os.WriteFile(filepath.Join(dir, m.File), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(filepath.Join(dir, m.File)); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/recordings/files/881.aac?download&token="+token, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "2345", w.Body.String())
+	assert.Equal(t, "attachment; filename=881.aac", w.Header().Get("Content-Disposition"))
+
+	w = request(s, http.MethodGet, "/api/recordings/files/crhk.yaml", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "only recordings shall be served")
+}
+
+func TestServer_SaveTimeshift(t *testing.T) {
+	s, _ := newServer(t)
+
+	w := request(s, http.MethodPost, "/api/timeshift/881", `{"last":"30m"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, "channel without buffer")
+
+	w = request(s, http.MethodPost, "/api/timeshift/881", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(s, http.MethodPost, "/api/timeshift/881", `{"last":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServer_Retention(t *testing.T) {
+	s, _ := newServer(t)
+
+	w := request(s, http.MethodGet, "/api/retention", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"dry_run":true,"removed":[],"bytes":0}`, w.Body.String())
+
+	w = request(s, http.MethodPost, "/api/retention", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"dry_run":false,"removed":[],"bytes":0}`, w.Body.String())
+}
+
+func TestServer_Jobs_Commands(t *testing.T) {
+	s, _ := newServer(t)
+	job := `{"name":"night","channel":"864","start":"23:00","duration":"1h","post_process":[["touch","{{.Path}}.done"]]}`
+	w := request(s, http.MethodPost, "/api/jobs", job)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	s.AllowCommands = true
+	w = request(s, http.MethodPost, "/api/jobs", job)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// The existing commands can be kept or removed, but not changed
+	s.AllowCommands = false
+	w = request(s, http.MethodPut, "/api/jobs/night", job)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request(s, http.MethodPut, "/api/jobs/night", `{"channel":"864","start":"23:00","duration":"1h","post_process":[["rm","-rf","/"]]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = request(s, http.MethodPut, "/api/jobs/night", `{"channel":"864","start":"23:00","duration":"1h"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestServer_Jobs_EncodeCommands(t *testing.T) {
+	s, _ := newServer(t)
+	job := `{"name":"night","channel":"864","start":"23:00","duration":"1h","output":{"encode":{"format":"mp3","command":"sh","args":["-c","touch /tmp/pwned"]}}}`
+	w := request(s, http.MethodPost, "/api/jobs", job)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The format alone runs the default encoder
+	w = request(s, http.MethodPost, "/api/jobs", `{"name":"night","channel":"864","start":"23:00","duration":"1h","output":{"encode":{"format":"mp3"}}}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = request(s, http.MethodPut, "/api/jobs/night", job)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	s.AllowCommands = true
+	w = request(s, http.MethodPut, "/api/jobs/night", job)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The existing commands can be kept
+	s.AllowCommands = false
+	w = request(s, http.MethodPut, "/api/jobs/night", job)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/antonyho/crhk-recorder/pkg/podcast"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// channelFeed serves the podcast feed of the recordings of a channel
+func (s *Server) channelFeed(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	s.serveFeed(w, r, "CRHK "+channel, func(e recording.Entry) bool {
+		return e.Channel == channel
+	})
+}
+
+// jobFeed serves the podcast feed of the recordings of a job
+func (s *Server) jobFeed(w http.ResponseWriter, r *http.Request) {
+	job := r.PathValue("job")
+	s.serveFeed(w, r, job, func(e recording.Entry) bool {
+		return e.Job == job
+	})
+}
+
+// serveFeed serves the podcast feed of the matched recordings
+// The enclosure URLs are signed, since podcast apps cannot
+// authorise with a header, and the token must not leak to them.
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, title string, match func(recording.Entry) bool) {
+	entries, err := s.Daemon.Recordings()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var matched []recording.Entry
+	for _, e := range entries {
+		if match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	base := s.baseURL(r)
+	feed := podcast.New(title, base+"/", matched, func(e recording.Entry) string {
+		sig := url.Values{"sig": {s.sign(filesPath + e.File)}}
+		return base + filesPath + url.PathEscape(e.File) + "?" + sig.Encode()
+	})
+	w.Header().Set("Content-Type", podcast.ContentType)
+	feed.Write(w)
+}
+
+// baseURL is the scheme and host of the request
+// A trusted reverse proxy can tell the scheme in X-Forwarded-Proto.
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); s.TrustProxy && (proto == "http" || proto == "https") {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
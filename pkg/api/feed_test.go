@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/podcast"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+func TestServer_Feed(t *testing.T) {
+	s, dir := newServer(t)
+	for _, m := range []recording.Metadata{
+		{Channel: "881", Job: "morning", File: "morning.aac", Status: recording.StatusCompleted, Bytes: 10},
+		{Channel: "903", File: "903.aac", Status: recording.StatusCompleted, Bytes: 10},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, m.File), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Save(filepath.Join(dir, m.File)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.MediaToken = "listen"
+	req := httptest.NewRequest(http.MethodGet, "http://recorder.local/api/feeds/jobs/morning?token=listen", nil)
+	req.Header.Set("X-Forwarded-Proto", "https") // not a trusted proxy
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, podcast.ContentType, w.Header().Get("Content-Type"))
+	var feed podcast.RSS
+	if assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed)) && assert.Len(t, feed.Channel.Items, 1) {
+		enclosure := feed.Channel.Items[0].Enclosure.URL
+		assert.True(t, strings.HasPrefix(enclosure, "http://recorder.local/api/recordings/files/morning.aac?sig="))
+		assert.NotContains(t, enclosure, token)
+
+		// The enclosure is playable with its signature
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, enclosure, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+
+		// The signature is of the file only
+		u, _ := url.Parse(enclosure)
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/recordings/files/903.aac?"+u.RawQuery, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// The media token cannot manage the jobs
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jobs?token=listen", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = request(s, http.MethodGet, "/api/feeds/channels/903", "")
+	var channelFeed podcast.RSS
+	if assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &channelFeed)) && assert.Len(t, channelFeed.Channel.Items, 1) {
+		assert.Equal(t, "903.aac", channelFeed.Channel.Items[0].GUID.Value)
+	}
+}
+
+func TestServer_Feed_TrustProxy(t *testing.T) {
+	s, _ := newServer(t)
+	s.TrustProxy = true
+	req := httptest.NewRequest(http.MethodGet, "http://recorder.local/api/feeds/channels/881?token="+token, nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	var feed podcast.RSS
+	if assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed)) {
+		assert.Equal(t, "https://recorder.local/", feed.Channel.Link)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// Progress of an in-flight recording
+type Progress struct {
+	Job             string    `json:"job,omitempty"`
+	Channel         string    `json:"channel"`
+	Path            string    `json:"path"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	Segments        int       `json:"segments"`
+	Bytes           int64     `json:"bytes"`
+	Duration        float64   `json:"duration_seconds"` // duration of the recorded segments
+	Gaps            int       `json:"gaps"`
+	MissingSegments int       `json:"missing_segments"`
+	Retries         int       `json:"retries"`
+}
+
+// Live is a recorder Observer which keeps the progress
+// of the in-flight recordings
+type Live struct {
+	recorder.NopObserver
+
+	mu         sync.Mutex
+	recordings map[*recorder.Recorder]*Progress
+}
+
+// NewLive creates a Live
+func NewLive() *Live {
+	return &Live{recordings: make(map[*recorder.Recorder]*Progress)}
+}
+
+// OnStart tracks the recording
+func (l *Live) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recordings[r] = &Progress{Job: r.Job, Channel: r.Channel, Path: path, Start: start, End: end}
+}
+
+// OnSegment counts the written segment
+func (l *Live) OnSegment(r *recorder.Recorder, sequence int64, bytes int, duration time.Duration) {
+	l.update(r, func(p *Progress) {
+		p.Segments++
+		p.Bytes += int64(bytes)
+		p.Duration += duration.Seconds()
+	})
+}
+
+// OnGap counts the gap
+func (l *Live) OnGap(r *recorder.Recorder, from, to int64) {
+	l.update(r, func(p *Progress) {
+		p.Gaps++
+		p.MissingSegments += int(to - from + 1)
+	})
+}
+
+// OnRetry counts the retry
+func (l *Live) OnRetry(r *recorder.Recorder, attempt int, err error) {
+	l.update(r, func(p *Progress) {
+		p.Retries++
+	})
+}
+
+// OnStop forgets the recording
+func (l *Live) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.recordings, r)
+}
+
+func (l *Live) update(r *recorder.Recorder, change func(*Progress)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, found := l.recordings[r]; found {
+		change(p)
+	}
+}
+
+// Recordings returns the progress of the in-flight recordings by start time
+func (l *Live) Recordings() []Progress {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	progress := []Progress{}
+	for _, p := range l.recordings {
+		progress = append(progress, *p)
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].Start.Before(progress[j].Start)
+	})
+	return progress
+}
@@ -0,0 +1,37 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/api"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+func TestLive(t *testing.T) {
+	live := api.NewLive()
+	rcdr := recorder.NewRecorder("881")
+	rcdr.Job = "morning"
+	now := time.Now()
+
+	live.OnSegment(rcdr, 1, 100, time.Second) // not recording
+	live.OnStart(rcdr, "/srv/morning.aac", now, now.Add(time.Hour))
+	live.OnSegment(rcdr, 1, 100, 10*time.Second)
+	live.OnGap(rcdr, 2, 4)
+	live.OnSegment(rcdr, 5, 50, 10*time.Second)
+
+	progress := live.Recordings()
+	if assert.Len(t, progress, 1) {
+		assert.Equal(t, "morning", progress[0].Job)
+		assert.Equal(t, 2, progress[0].Segments)
+		assert.EqualValues(t, 150, progress[0].Bytes)
+		assert.Equal(t, 20.0, progress[0].Duration)
+		assert.Equal(t, 1, progress[0].Gaps)
+		assert.Equal(t, 3, progress[0].MissingSegments)
+	}
+
+	live.OnStop(rcdr, recorder.Summary{})
+	assert.Empty(t, live.Recordings())
+}
@@ -0,0 +1,242 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	dow "github.com/antonyho/crhk-recorder/pkg/dayofweek"
+	"github.com/antonyho/crhk-recorder/pkg/hook"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+	"github.com/antonyho/crhk-recorder/pkg/stream/encoder"
+)
+
+// Config is the daemon configuration file
+type Config struct {
+	Timezone     string          `yaml:"timezone,omitempty"`      // default timezone of the jobs
+	Output       Output          `yaml:"output,omitempty"`        // default output settings of the jobs
+	MaxDownloads int             `yaml:"max_downloads,omitempty"` // maximum concurrent media downloads
+	Notify       NotifyConfig    `yaml:"notify,omitempty"`        // destinations of the recording lifecycle events
+	Timeshift    TimeshiftConfig `yaml:"timeshift,omitempty"`     // rolling buffers of the channels
+	Retention    RetentionConfig `yaml:"retention,omitempty"`     // removal of the old recordings
+	Disk         DiskConfig      `yaml:"disk,omitempty"`          // free disk space guard of the recordings
+	Storage      StorageConfig   `yaml:"storage,omitempty"`       // remote storage of the finished recordings
+	Jobs         []JobConfig     `yaml:"jobs"`
+}
+
+// Output settings of the recorded files
+type Output struct {
+	Dir    string   `yaml:"dir,omitempty" json:"dir,omitempty"`
+	Prefix string   `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Mirror []string `yaml:"mirror,omitempty" json:"mirror,omitempty"` // directories of copies of the recorded files, e.g. on a second disk
+	Encode *Encode  `yaml:"encode,omitempty" json:"encode,omitempty"` // transcoding of the recorded files while recording
+}
+
+// Encode settings of the external encoder
+type Encode struct {
+	Format  string   `yaml:"format" json:"format"`                       // mp3 or opus
+	Command string   `yaml:"command,omitempty" json:"command,omitempty"` // ffmpeg-compatible encoder, defaults to ffmpeg
+	Args    []string `yaml:"args,omitempty" json:"args,omitempty"`       // output arguments, defaults to those of the format
+	Replace bool     `yaml:"replace,omitempty" json:"replace,omitempty"` // keep the AAC file only when the encoder fails
+}
+
+// encoder creates the encoder sink of the settings
+func (e Encode) encoder() (*encoder.Encoder, error) {
+	format, err := encoder.ParseFormat(e.Format)
+	if err != nil {
+		return nil, err
+	}
+	enc := encoder.New(format)
+	enc.Command = e.Command
+	enc.Args = e.Args
+	enc.Replace = e.Replace
+	return enc, nil
+}
+
+// JobConfig is a named recording job
+// A job is scheduled either with a daily start and end (or duration)
+// filtered by weekdays, or with a cron expression and a duration.
+type JobConfig struct {
+	Name        string        `yaml:"name" json:"name"`
+	Channel     string        `yaml:"channel,omitempty" json:"channel,omitempty"`
+	Start       string        `yaml:"start,omitempty" json:"start,omitempty"`
+	End         string        `yaml:"end,omitempty" json:"end,omitempty"`
+	Duration    time.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+	Weekdays    []int         `yaml:"weekdays,omitempty" json:"weekdays,omitempty"` // Sunday=0
+	Cron        string        `yaml:"cron,omitempty" json:"cron,omitempty"`
+	Timezone    string        `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	Output      Output        `yaml:"output,omitempty" json:"output,omitempty"`
+	PostProcess [][]string    `yaml:"post_process,omitempty" json:"post_process,omitempty"` // commands executed after recording, with arguments templated on hook.Data
+	// PostProcessTimeout kills a post-processing command, defaults to hook.DefaultTimeout
+	PostProcessTimeout time.Duration `yaml:"post_process_timeout,omitempty" json:"post_process_timeout,omitempty"`
+}
+
+// LoadConfig reads the YAML configuration file
+func LoadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(content)
+}
+
+// ParseConfig parses and validates the YAML configuration
+func ParseConfig(content []byte) (*Config, error) {
+	cfg := new(Config)
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate the configuration
+func (c *Config) Validate() error {
+	if _, err := schedule.LoadLocation(c.Timezone); err != nil {
+		return err
+	}
+	if err := c.Notify.Validate(); err != nil {
+		return err
+	}
+	if err := c.Timeshift.Validate(); err != nil {
+		return err
+	}
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+	if err := c.Disk.Validate(); err != nil {
+		return err
+	}
+	if err := c.Storage.Validate(); err != nil {
+		return err
+	}
+	if c.Output.Prefix != "" {
+		if err := recording.ValidateName(c.Output.Prefix); err != nil {
+			return err
+		}
+	}
+	if c.Output.Encode != nil {
+		if _, err := c.Output.Encode.encoder(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, job := range c.Jobs {
+		if job.Name == "" {
+			return errors.New("job name must be provided")
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicated job name [%s]", job.Name)
+		}
+		names[job.Name] = true
+		if err := recording.ValidateName(job.Name); err != nil {
+			return fmt.Errorf("job %w", err)
+		}
+		if job.Channel == "" {
+			return fmt.Errorf("job [%s]: channel must be provided", job.Name)
+		}
+		if err := recording.ValidateChannel(job.Channel); err != nil {
+			return fmt.Errorf("job [%s]: %w", job.Name, err)
+		}
+		if job.Output.Prefix != "" {
+			if err := recording.ValidateName(job.Output.Prefix); err != nil {
+				return fmt.Errorf("job [%s]: prefix %w", job.Name, err)
+			}
+		}
+		if _, err := job.Schedule(c.Timezone); err != nil {
+			return fmt.Errorf("job [%s]: %w", job.Name, err)
+		}
+		if _, err := job.commands(); err != nil {
+			return fmt.Errorf("job [%s]: %w", job.Name, err)
+		}
+		if job.Output.Encode != nil {
+			if _, err := job.Output.Encode.encoder(); err != nil {
+				return fmt.Errorf("job [%s]: %w", job.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Schedule builds the recording schedule of the job
+// defaultTimezone applies when the job has no timezone of its own
+func (j JobConfig) Schedule(defaultTimezone string) (schedule.Schedule, error) {
+	timezone := j.Timezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+	loc, err := schedule.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.Cron != "" {
+		return schedule.NewCron(j.Cron, j.Duration, loc)
+	}
+
+	if j.Start == "" {
+		return nil, errors.New("start time or cron expression must be provided")
+	}
+	end := j.End
+	if end == "" {
+		if j.Duration <= 0 {
+			return nil, errors.New("end time or duration must be provided")
+		}
+		start, _, err := schedule.ParseClock(j.Start)
+		if err != nil {
+			return nil, err
+		}
+		end = start.Add(j.Duration).String()
+	}
+	wd := dow.New()
+	for _, d := range j.Weekdays {
+		if d < 0 || d > 6 {
+			return nil, fmt.Errorf("incorrect day of week [%d]", d)
+		}
+		wd.Enable(time.Weekday(d))
+	}
+	return schedule.NewWindow(j.Start, end, *wd, loc)
+}
+
+// commands parses the post-processing commands of the job
+func (j JobConfig) commands() ([]*hook.Command, error) {
+	var commands []*hook.Command
+	for _, args := range j.PostProcess {
+		if len(args) == 0 {
+			continue
+		}
+		c, err := hook.Parse(args, j.PostProcessTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("post-processing command: %w", err)
+		}
+		commands = append(commands, c)
+	}
+	return commands, nil
+}
+
+// output merges the job output settings with the defaults
+func (j JobConfig) output(defaults Output) Output {
+	out := defaults
+	if j.Output.Dir != "" {
+		out.Dir = j.Output.Dir
+	}
+	if j.Output.Prefix != "" {
+		out.Prefix = j.Output.Prefix
+	}
+	if len(j.Output.Mirror) > 0 {
+		out.Mirror = j.Output.Mirror
+	}
+	if j.Output.Encode != nil {
+		out.Encode = j.Output.Encode
+	}
+	if out.Prefix == "" {
+		out.Prefix = j.Name
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/notify/email"
+)
+
+const sampleConfig = `
+timezone: Asia/Hong_Kong
+output:
+  dir: /tmp/recordings
+jobs:
+  - name: morning
+    channel: "881"
+    start: "07:00"
+    duration: 2h
+    weekdays: [1, 2, 3, 4, 5]
+  - name: mid-month
+    channel: "903"
+    cron: "0 12 15 * *"
+    duration: 1h
+    timezone: Europe/London
+    output:
+      prefix: noon
+      mirror: [/mnt/backup]
+    post_process:
+      - ["echo", "done"]
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(sampleConfig))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "Asia/Hong_Kong", cfg.Timezone)
+	if assert.Len(t, cfg.Jobs, 2) {
+		assert.Equal(t, 2*time.Hour, cfg.Jobs[0].Duration)
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, cfg.Jobs[0].Weekdays)
+		assert.Equal(t, [][]string{{"echo", "done"}}, cfg.Jobs[1].PostProcess)
+		assert.Equal(t, Output{Dir: "/tmp/recordings", Prefix: "morning"}, cfg.Jobs[0].output(cfg.Output))
+		assert.Equal(t, Output{Dir: "/tmp/recordings", Prefix: "noon", Mirror: []string{"/mnt/backup"}}, cfg.Jobs[1].output(cfg.Output))
+	}
+}
+
+func TestParseConfig_Notify(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+notify:
+  webhooks:
+    - url: http://localhost:8080/hook
+      secret: s3cr3t
+      events: [failed, degraded]
+      gap_threshold: 3
+  email:
+    - smtp: localhost:25
+      from: recorder@example.com
+      to: [ops@example.com]
+`))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	notifiers, err := cfg.Notify.notifiers(nil)
+	if assert.NoError(t, err) && assert.Len(t, notifiers, 2) {
+		n := notifiers[0].(*notify.Notifier)
+		assert.Equal(t, []notify.EventType{notify.EventFailed, notify.EventDegraded}, n.Events)
+		assert.Equal(t, 3, n.GapThreshold)
+		assert.Equal(t, notify.DefaultRetries, n.Retries)
+		assert.Equal(t, email.DefaultEvents, notifiers[1].(*notify.Notifier).Events)
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	cases := []struct {
+		testName string
+		config   string
+	}{
+		{"missing name", `jobs: [{channel: "881", start: "07:00", duration: 1h}]`},
+		{"duplicated name", `jobs: [{name: a, channel: "881", start: "07:00", duration: 1h}, {name: a, channel: "903", start: "07:00", duration: 1h}]`},
+		{"missing channel", `jobs: [{name: a, start: "07:00", duration: 1h}]`},
+		{"channel out of the directory", `jobs: [{name: a, channel: "../../etc/x", start: "07:00", duration: 1h}]`},
+		{"name out of the directory", `jobs: [{name: ../x, channel: "881", start: "07:00", duration: 1h}]`},
+		{"prefix out of the directory", `jobs: [{name: a, channel: "881", start: "07:00", duration: 1h, output: {prefix: ../x}}]`},
+		{"timeshift channel out of the directory", `timeshift: {channels: ["../881"]}`},
+		{"missing end", `jobs: [{name: a, channel: "881", start: "07:00"}]`},
+		{"cron without duration", `jobs: [{name: a, channel: "881", cron: "0 7 * * *"}]`},
+		{"duration of a day", `jobs: [{name: a, channel: "881", start: "07:00", duration: 24h}]`},
+		{"cron of no date", `jobs: [{name: a, channel: "881", cron: "0 0 30 2 *", duration: 1h}]`},
+		{"incorrect weekday", `jobs: [{name: a, channel: "881", start: "07:00", duration: 1h, weekdays: [7]}]`},
+		{"incorrect timezone", `timezone: Nowhere/Land`},
+		{"webhook without url", `notify: {webhooks: [{secret: s}]}`},
+		{"email without recipients", `notify: {email: [{smtp: "localhost:25", from: a@example.com}]}`},
+		{"unknown webhook event", `notify: {webhooks: [{url: "http://localhost", events: [exploded]}]}`},
+		{"negative timeshift window", `timeshift: {window: -1h}`},
+		{"incorrect retention size", `retention: {rules: [{channel: "881", max_size: lots}]}`},
+		{"negative retention limit", `retention: {rules: [{keep_last: -1}]}`},
+		{"incorrect disk reserve", `disk: {min_free: plenty}`},
+		{"s3 without bucket", `storage: {s3: {endpoint: "localhost:9000"}}`},
+		{"incorrect post-processing template", `jobs: [{name: a, channel: "881", start: "07:00", duration: 1h, post_process: [[echo, "{{.Path"]]}]`},
+		{"unknown encoding format", `output: {encode: {format: wma}}`},
+		{"unknown job encoding format", `jobs: [{name: a, channel: "881", start: "07:00", duration: 1h, output: {encode: {format: wav}}}]`},
+		{"small s3 part size", `storage: {s3: {endpoint: "localhost:9000", bucket: archive, part_size: 1MB}}`},
+	}
+
+	for _, c := range cases {
+		_, err := ParseConfig([]byte(c.config))
+		assert.Error(t, err, c.testName)
+	}
+}
+
+func TestJobConfig_Schedule(t *testing.T) {
+	jc := JobConfig{Start: "23:00", Duration: 2 * time.Hour, Weekdays: []int{int(time.Monday)}}
+	s, err := jc.Schedule("Asia/Hong_Kong")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	start, end := s.Next(time.Date(2021, time.January, 24, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Monday, start.Weekday())
+	assert.Equal(t, 23, start.Hour())
+	assert.Equal(t, 2*time.Hour, end.Sub(start))
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// AdHocPrefix is the name prefix of the ad-hoc recording jobs
+const AdHocPrefix = "adhoc-"
+
+// Errors of controlling the recordings
+var (
+	ErrUnknownJob   = errors.New("unknown job")
+	ErrNotRecording = errors.New("job is not recording")
+)
+
+// StartRecording records the channel immediately for the duration
+// It returns the name of the ad-hoc job. The recording is saved
+// with the default output settings, and stopped when the daemon stops.
+func (d *Daemon) StartRecording(channel string, duration time.Duration) (string, error) {
+	if channel == "" {
+		return "", errors.New("channel must be provided")
+	}
+	if err := recording.ValidateChannel(channel); err != nil {
+		return "", err
+	}
+	if duration <= 0 {
+		return "", errors.New("duration must be positive")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	start := time.Now()
+	name := fmt.Sprintf("%s%s-%s", AdHocPrefix, channel, start.Format("20060102-150405"))
+	if _, found := d.adhoc[name]; found {
+		return "", fmt.Errorf("job [%s] is already recording", name)
+	}
+	jc := d.defaults
+	jc.Name = name
+	jc.Channel = channel
+	jc.Output.Prefix = firstNonEmpty(jc.Output.Prefix, channel)
+	j, err := d.newJob(jc, nil)
+	if err != nil {
+		return "", err
+	}
+
+	d.adhoc[name] = j
+	d.running.Add(1)
+	recordCtx := d.recordContext()
+	go func() {
+		defer d.running.Done()
+		defer close(j.done)
+		if err := j.record(recordCtx, start, start.Add(duration)); err != nil {
+			j.logger.Error("Recording failed", logging.Err(err))
+		}
+		d.mu.Lock()
+		delete(d.adhoc, name)
+		d.mu.Unlock()
+	}()
+	d.logger().Info("Ad-hoc recording started", logging.KeyJob, name, logging.KeyChannel, channel, "duration", duration)
+	return name, nil
+}
+
+// StopRecording stops the in-flight recording of the job
+// A scheduled job continues with its next recording.
+func (d *Daemon) StopRecording(name string) error {
+	d.mu.Lock()
+	j, found := d.jobs[name]
+	if !found {
+		j, found = d.adhoc[name]
+	}
+	d.mu.Unlock()
+	if !found {
+		return ErrUnknownJob
+	}
+	if !j.stop() {
+		return ErrNotRecording
+	}
+	d.logger().Info("Recording stopped on request", logging.KeyJob, name)
+	return nil
+}
+
+// Recording returns the names of the jobs which are recording
+func (d *Daemon) Recording() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var names []string
+	for _, jobs := range []map[string]*job{d.jobs, d.adhoc} {
+		for name, j := range jobs {
+			if !j.recordingUntil().IsZero() {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher/fetchertest"
+)
+
+func TestDaemon_StartRecording(t *testing.T) {
+	d := New("")
+	d.Pool = fetchertest.NewPool(0)
+	d.defaults = JobConfig{Output: Output{Dir: t.TempDir()}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+
+	_, err := d.StartRecording("881", 0)
+	assert.Error(t, err)
+	_, err = d.StartRecording("../../etc/x", time.Hour)
+	assert.Error(t, err, "channel out of the output directory")
+
+	name, err := d.StartRecording("881", time.Hour)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Contains(t, name, AdHocPrefix+"881-")
+	assert.Eventually(t, func() bool {
+		return len(d.Recording()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, ErrUnknownJob, d.StopRecording("missing"))
+	assert.NoError(t, d.StopRecording(name))
+	assert.Eventually(t, func() bool {
+		return len(d.Recording()) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, ErrUnknownJob, d.StopRecording(name), "stopped ad-hoc job shall be removed")
+}
+
+func TestDaemon_SaveTimeshift(t *testing.T) {
+	d := New("")
+	d.Pool = fetchertest.NewPool(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+	outputDir := t.TempDir()
+	err := d.Apply(&Config{
+		Output:    Output{Dir: outputDir},
+		Timeshift: TimeshiftConfig{Dir: t.TempDir(), Channels: []string{"881"}},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, err = d.SaveTimeshift("903", time.Now().Add(-time.Minute), time.Now())
+	assert.ErrorIs(t, err, ErrNotBuffered)
+
+	var entry recording.Entry
+	assert.Eventually(t, func() bool {
+		entry, err = d.SaveTimeshift("881", time.Now().Add(-time.Minute), time.Now())
+		return err == nil
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "881", entry.Channel)
+	assert.Equal(t, recording.StatusCompleted, entry.Status)
+	assert.Equal(t, outputDir, filepath.Dir(entry.Path))
+
+	entries, err := d.Recordings()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
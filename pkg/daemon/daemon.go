@@ -0,0 +1,310 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+	"github.com/antonyho/crhk-recorder/pkg/storage/s3"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// WatchInterval is the interval of checking the configuration file for changes
+const WatchInterval = 5 * time.Second
+
+// Daemon runs the recording jobs listed in a configuration file concurrently
+type Daemon struct {
+	ConfigPath string
+	Logger     *slog.Logger  // defaults to slog.Default()
+	Pool       *fetcher.Pool // defaults to fetcher.DefaultPool
+
+	mu            sync.Mutex
+	ctx           context.Context
+	jobs          map[string]*job
+	adhoc         map[string]*job // ad-hoc recordings by job name
+	defaults      JobConfig       // default timezone and output of the jobs
+	config        *Config         // applied configuration
+	editMu        sync.Mutex      // serialises the job changes
+	observers     []recorder.Observer
+	notifiers     notifierSet
+	notify        NotifyConfig
+	timeshift     TimeshiftConfig
+	stopTimeshift context.CancelFunc // stops the timeshift buffers
+	sweeper       sweeper
+	diskGuard     *diskspace.Guard // guard of the recordings started afterwards, including those of the unchanged jobs
+	uploader      *s3.Uploader     // uploads the finished recordings, nil without remote storage
+	streaming     bool             // uploads the media while recording
+	running       sync.WaitGroup
+	modTime       time.Time
+}
+
+// New creates a Daemon with the configuration file at the given path
+func New(configPath string) *Daemon {
+	return &Daemon{
+		ConfigPath: configPath,
+		jobs:       make(map[string]*job),
+		adhoc:      make(map[string]*job),
+	}
+}
+
+// Run the jobs until the context is cancelled
+// The configuration file is reloaded when it has been changed,
+// and the retention rules are enforced periodically.
+// On cancellation in-flight recordings are stopped and finalised
+// before Run returns.
+func (d *Daemon) Run(ctx context.Context) error {
+	d.mu.Lock()
+	d.ctx = ctx
+	d.mu.Unlock()
+
+	if err := d.Reload(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.running.Wait()
+			d.notifiers.close()
+			return nil
+
+		case <-ticker.C:
+			if d.changed() {
+				if err := d.Reload(); err != nil {
+					d.logger().Error("Reload configuration failed", logging.Err(err))
+				}
+			}
+			if d.sweepDue() {
+				d.sweep()
+			}
+		}
+	}
+}
+
+// changed reports whether the configuration file was modified since last load
+func (d *Daemon) changed() bool {
+	info, err := os.Stat(d.ConfigPath)
+	if err != nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !info.ModTime().Equal(d.modTime)
+}
+
+// Reload the configuration file and apply the changes of jobs
+// The current jobs are kept when the configuration is invalid.
+func (d *Daemon) Reload() error {
+	info, err := os.Stat(d.ConfigPath)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.modTime = info.ModTime()
+	d.mu.Unlock()
+
+	cfg, err := LoadConfig(d.ConfigPath)
+	if err != nil {
+		return err
+	}
+	d.logger().Info("Configuration loaded", logging.KeyFile, d.ConfigPath, "jobs", len(cfg.Jobs))
+	return d.Apply(cfg)
+}
+
+// Apply the configuration to the running jobs
+// Unchanged jobs keep running. Changed and removed jobs stop scheduling,
+// while their in-flight recordings continue until the scheduled end.
+// A changed job resumes its schedule after the in-flight recording.
+func (d *Daemon) Apply(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Everything which can fail is built before the daemon is changed,
+	// so that a failed reload keeps the current configuration.
+	uploader, err := cfg.Storage.uploader()
+	if err != nil {
+		return err
+	}
+	guard := d.guard(cfg.Disk)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	configs := make(map[string]JobConfig)
+	for _, jc := range cfg.Jobs {
+		jc.Timezone = firstNonEmpty(jc.Timezone, cfg.Timezone)
+		jc.Output = jc.output(cfg.Output)
+		if j, found := d.jobs[jc.Name]; found && reflect.DeepEqual(jc, j.config) {
+			continue
+		}
+		configs[jc.Name] = jc
+	}
+	started := make(map[string]*job)
+	for name, jc := range configs {
+		s, err := jc.Schedule(jc.Timezone)
+		if err != nil {
+			return err
+		}
+		j, err := d.newJob(jc, s)
+		if err != nil {
+			return err
+		}
+		started[name] = j
+	}
+	notifyChanged := !reflect.DeepEqual(cfg.Notify, d.notify)
+	var notifiers []recorder.Observer
+	if notifyChanged {
+		if notifiers, err = cfg.Notify.notifiers(d.logger()); err != nil {
+			return err
+		}
+	}
+
+	maxDownloads := cfg.MaxDownloads
+	if maxDownloads == 0 {
+		maxDownloads = resolver.DefaultMaxConcurrentDownloads
+	}
+	resolver.SetMaxConcurrentDownloads(maxDownloads)
+	d.defaults = JobConfig{Timezone: cfg.Timezone, Output: cfg.Output}
+	applied := *cfg
+	d.config = &applied
+	d.diskGuard = guard
+	d.uploader = uploader
+	d.streaming = cfg.Storage.streaming()
+	if notifyChanged {
+		d.notifiers.replace(notifiers)
+		d.notify = cfg.Notify
+	}
+	if !reflect.DeepEqual(cfg.Timeshift, d.timeshift) {
+		d.startTimeshift(cfg.Timeshift)
+	}
+
+	resumeAfter := make(map[string]time.Time)
+	for name, j := range d.jobs {
+		if _, found := configs[name]; !found && containsJob(cfg.Jobs, name) {
+			continue
+		}
+		d.logger().Info("Job stopped", logging.KeyJob, name)
+		j.cancel()
+		resumeAfter[name] = j.recordingUntil()
+		delete(d.jobs, name)
+	}
+
+	for name, j := range started {
+		recordCtx := d.recordContext()
+		ctx, cancel := context.WithCancel(recordCtx)
+		j.cancel = cancel
+		after := time.Now()
+		if until := resumeAfter[name]; until.After(after) {
+			after = until
+		}
+		d.jobs[name] = j
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			j.run(ctx, recordCtx, after)
+		}()
+		d.logger().Info("Job started", logging.KeyJob, name)
+	}
+
+	return nil
+}
+
+// containsJob reports whether the job is listed in the configurations
+func containsJob(jobs []JobConfig, name string) bool {
+	for _, jc := range jobs {
+		if jc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newJob creates a job which reports to the observers of the daemon
+func (d *Daemon) newJob(jc JobConfig, s schedule.Schedule) (*job, error) {
+	observers := append([]recorder.Observer{&d.notifiers}, d.observers...)
+	j, err := newJob(jc, s, observers, d.logger())
+	if err != nil {
+		return nil, err
+	}
+	j.recorder.Pool = d.Pool
+	j.guard = d.currentGuard
+	j.recorder.Sinks = append(j.recorder.Sinks, sink.NewAsync(&remoteStream{uploader: d.streamUploader}))
+	j.finished = d.finished
+	j.background = d.background
+	return j, nil
+}
+
+// currentGuard returns the free disk space guard of the applied configuration
+func (d *Daemon) currentGuard() *diskspace.Guard {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.diskGuard
+}
+
+// background runs the work in a goroutine which the daemon waits for
+// when it stops
+func (d *Daemon) background(work func()) {
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		work()
+	}()
+}
+
+// recordContext is the context of the recordings, which is
+// cancelled when the daemon stops
+func (d *Daemon) recordContext() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+func (d *Daemon) logger() *slog.Logger {
+	if d.Logger == nil {
+		return slog.Default()
+	}
+	return d.Logger
+}
+
+// AddObserver registers an observer on the recorders of the jobs
+// started afterwards
+func (d *Daemon) AddObserver(o recorder.Observer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.observers = append(d.observers, o)
+}
+
+// Jobs returns the names of the running jobs
+func (d *Daemon) Jobs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.jobs))
+	for name := range d.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+func TestDaemon_Apply(t *testing.T) {
+	d := New("")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+
+	cfg, err := ParseConfig([]byte(sampleConfig))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"mid-month", "morning"}, d.Jobs())
+	morning := d.jobs["morning"]
+	midMonth := d.jobs["mid-month"]
+
+	cfg.Jobs[1].Duration = 3 * time.Hour
+	cfg.Jobs = append(cfg.Jobs, JobConfig{Name: "night", Channel: "864", Start: "23:00", End: "01:00"})
+	if !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"mid-month", "morning", "night"}, d.Jobs())
+	assert.Same(t, morning, d.jobs["morning"], "unchanged job shall keep running")
+	assert.NotSame(t, midMonth, d.jobs["mid-month"], "changed job shall be replaced")
+	<-midMonth.done
+
+	cfg.Jobs = cfg.Jobs[1:]
+	if !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"mid-month", "night"}, d.Jobs())
+	<-morning.done
+}
+
+func TestDaemon_Apply_Disk(t *testing.T) {
+	d := New("")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+
+	cfg, err := ParseConfig([]byte(sampleConfig))
+	if !assert.NoError(t, err) || !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	morning := d.jobs["morning"]
+
+	cfg.Disk.MinFree = "1GB"
+	if !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	assert.Same(t, morning, d.jobs["morning"], "unchanged job shall keep running")
+	assert.Equal(t, uint64(1<<30), morning.guard().Reserve, "unchanged job shall record with the reloaded reserve")
+}
+
+func TestDaemon_Apply_Stream(t *testing.T) {
+	d := New("")
+	s := &remoteStream{uploader: d.streamUploader}
+	assert.NoError(t, s.Open(sink.Info{Channel: "881"}))
+	assert.Nil(t, s.stream, "nothing shall be streamed without remote storage")
+	assert.NoError(t, s.Close())
+
+	cfg, err := ParseConfig([]byte(`storage: {s3: {endpoint: "localhost:9000", bucket: archive, stream: true}}`))
+	if !assert.NoError(t, err) || !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	assert.NotNil(t, d.streamUploader())
+
+	cfg.Storage.S3.Stream = false
+	assert.NoError(t, d.Apply(cfg))
+	assert.Nil(t, d.streamUploader())
+}
+
+func TestDaemon_Run(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "crhk.yaml")
+	if err := os.WriteFile(configPath, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(configPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- d.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return len(d.Jobs()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("daemon shall stop when the context is cancelled")
+	}
+}
+
+func TestDaemon_Run_InvalidConfig(t *testing.T) {
+	d := New(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, d.Run(context.Background()))
+}
@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+)
+
+// DiskConfig keeps free disk space for the recordings
+// A recording is checked for the estimated size before it starts,
+// and stopped when the free space falls below the reserve. The
+// retention rules are enforced to free space before giving up.
+// The settings apply to the jobs started after a change.
+type DiskConfig struct {
+	MinFree string `yaml:"min_free,omitempty"` // reserve of free space, defaults to diskspace.DefaultReserve
+	Refuse  bool   `yaml:"refuse,omitempty"`   // refuse a recording without the estimated space, otherwise warn
+}
+
+// Validate the disk settings
+func (c DiskConfig) Validate() error {
+	_, err := c.reserve()
+	return err
+}
+
+func (c DiskConfig) reserve() (uint64, error) {
+	if c.MinFree == "" {
+		return diskspace.DefaultReserve, nil
+	}
+	size, err := diskspace.ParseSize(c.MinFree)
+	return uint64(size), err
+}
+
+// guard creates the disk space guard of the configuration
+// It frees space by the retention rules of the daemon.
+func (d *Daemon) guard(c DiskConfig) *diskspace.Guard {
+	reserve, _ := c.reserve()
+	return &diskspace.Guard{
+		Reserve: reserve,
+		Refuse:  c.Refuse,
+		Cleanup: func() error {
+			cfg := d.Config().Retention
+			if len(cfg.Rules) == 0 || cfg.DryRun {
+				return nil
+			}
+			_, err := d.Prune(false)
+			return err
+		},
+	}
+}
@@ -0,0 +1,226 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/hook"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// EarlyStart is how long a job wakes up before the scheduled start time
+const EarlyStart = 10 * time.Second
+
+// job runs a recording job on its schedule
+type job struct {
+	config    JobConfig
+	schedule  schedule.Schedule
+	recorder  *recorder.Recorder
+	observers []recorder.Observer
+	logger    *slog.Logger
+	cancel    context.CancelFunc
+	done      chan struct{}
+	finished  func(path string) // called after each recording and its post-processing
+	// background runs the post-processing of a recording, so that it
+	// does not hold up the next recording. It runs in place when nil.
+	background func(work func())
+	// guard returns the free disk space guard of the next recording,
+	// so that a reload applies to the unchanged jobs
+	guard func() *diskspace.Guard
+
+	mu            sync.Mutex
+	busyUntil     time.Time          // end of the in-flight recording
+	stopRecording context.CancelFunc // stops the in-flight recording
+}
+
+// newJob creates the job of the configuration
+// An ad-hoc job has no schedule.
+func newJob(config JobConfig, s schedule.Schedule, observers []recorder.Observer, logger *slog.Logger) (*job, error) {
+	rcdr := recorder.NewRecorder(config.Channel)
+	if err := rcdr.SetTimezone(config.Timezone); err != nil {
+		return nil, err
+	}
+	rcdr.OutputDir = config.Output.Dir
+	rcdr.Prefix = config.Output.Prefix
+	for _, dir := range config.Output.Mirror {
+		rcdr.Sinks = append(rcdr.Sinks, sink.NewDir(dir))
+	}
+	if config.Output.Encode != nil {
+		enc, err := config.Output.Encode.encoder()
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Check(); err != nil {
+			logger.Warn("Recordings will not be encoded", logging.KeyJob, config.Name, logging.Err(err))
+		}
+		rcdr.Sinks = append(rcdr.Sinks, sink.NewAsync(enc))
+	}
+	rcdr.Job = config.Name
+	rcdr.Logger = logger
+	for _, o := range observers {
+		rcdr.AddObserver(o)
+	}
+
+	return &job{
+		config:    config,
+		schedule:  s,
+		recorder:  rcdr,
+		observers: observers,
+		logger:    logger.With(logging.KeyJob, config.Name, logging.KeyChannel, config.Channel),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// recordingUntil returns the end time of the in-flight recording
+// A zero time means the job is not recording
+func (j *job) recordingUntil() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.busyUntil
+}
+
+// stop the in-flight recording
+// It returns false when the job is not recording.
+func (j *job) stop() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stopRecording == nil {
+		return false
+	}
+	j.stopRecording()
+	return true
+}
+
+// run schedules the recordings starting no earlier than after
+// until the context is cancelled. A cancellation does not
+// interrupt the in-flight recording, which only stops when
+// recordCtx is cancelled or the recording is stopped.
+func (j *job) run(ctx, recordCtx context.Context, after time.Time) {
+	defer close(j.done)
+
+	start, end := j.schedule.Next(after)
+	for {
+		if start.IsZero() {
+			j.logger.Warn("No further recording scheduled")
+			return
+		}
+		for _, o := range j.observers {
+			o.OnScheduled(j.recorder, start, end)
+		}
+		j.logger.Info("Next recording scheduled",
+			"start", start.Format(schedule.TimeLayout), "end", end.Format(schedule.TimeLayout),
+			"local_start", start.Local().Format(schedule.TimeLayout), "local_end", end.Local().Format(schedule.TimeLayout))
+
+		timer := time.NewTimer(time.Until(start.Add(-EarlyStart)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		err := j.record(recordCtx, start, end)
+		if errors.Is(err, context.Canceled) {
+			j.logger.Info("Recording interrupted")
+			if recordCtx.Err() != nil {
+				return
+			}
+		} else if err != nil {
+			j.logger.Error("Recording failed", logging.Err(err))
+		}
+
+		start, end = j.schedule.Next(end)
+	}
+}
+
+// record from start to end
+// The recording can be stopped with stop without cancelling ctx.
+func (j *job) record(ctx context.Context, start, end time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	j.mu.Lock()
+	j.busyUntil = end
+	j.stopRecording = cancel
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		j.busyUntil = time.Time{}
+		j.stopRecording = nil
+		j.mu.Unlock()
+		cancel()
+	}()
+
+	path, err := j.recorder.OutputPath(start)
+	if err != nil {
+		return err
+	}
+	if j.guard != nil {
+		j.recorder.Guard = j.guard()
+	}
+	defer j.afterRecording(path)
+	return j.recorder.RecordContext(ctx, start, end)
+}
+
+// afterRecording post-processes the recording and finishes it
+// in the background
+func (j *job) afterRecording(path string) {
+	work := func() {
+		j.postProcess(path)
+		if j.finished != nil {
+			j.finished(path)
+		}
+	}
+	if j.background == nil {
+		work()
+		return
+	}
+	j.background(work)
+}
+
+// postProcess executes the post-processing commands of the job
+// The commands are executed in order after every recording with media,
+// whether it is completed, interrupted or failed, which the commands
+// can tell from the status. Every result is logged and notified.
+func (j *job) postProcess(path string) {
+	commands, err := j.config.commands()
+	if err != nil || len(commands) == 0 {
+		return // validated with the configuration
+	}
+	meta, err := recording.Load(path)
+	if err != nil {
+		j.logger.Error("Post-processing skipped", logging.KeyFile, path, logging.Err(err))
+		return
+	}
+	if meta.Bytes == 0 {
+		return // nothing recorded
+	}
+	if meta.File != "" {
+		path = filepath.Join(filepath.Dir(path), meta.File) // e.g. an encoded file
+	}
+	data := hook.NewData(*meta, path)
+	for _, c := range commands {
+		result := c.Run(context.Background(), data)
+		attrs := []any{"command", result.Args, "exit_code", result.ExitCode,
+			"output", result.Output, "duration", result.Duration}
+		if result.Err != nil {
+			j.logger.Error("Post-processing failed", append(attrs, logging.Err(result.Err))...)
+		} else {
+			j.logger.Info("Post-processing completed", attrs...)
+		}
+		e := notify.PostProcessEvent(*meta, path, result)
+		for _, o := range j.observers {
+			if n, ok := o.(eventNotifier); ok {
+				n.Notify(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher/fetchertest"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// eventRecorder keeps the notified events
+type eventRecorder struct {
+	recorder.NopObserver
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (r *eventRecorder) Notify(e notify.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestJob_PostProcess(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	events := new(eventRecorder)
+	j, err := newJob(JobConfig{
+		Name:    "morning",
+		Channel: "881",
+		Output:  Output{Dir: t.TempDir()},
+		PostProcess: [][]string{
+			{"sh", "-c", "echo $1", "sh", "{{.Channel}} {{.Job}} gaps={{.Gaps}}"},
+			{"sh", "-c", "exit 2"},
+		},
+	}, nil, []recorder.Observer{events}, slog.Default())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	j.recorder.Pool = fetchertest.NewPool(0)
+	j.recorder.Pool.Fetcher("881").PollInterval = 50 * time.Millisecond
+
+	start := time.Now()
+	assert.NoError(t, j.record(context.Background(), start, start.Add(300*time.Millisecond)))
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if assert.Len(t, events.events, 2) {
+		done, failed := events.events[0], events.events[1]
+		assert.Equal(t, notify.EventPostProcessed, done.Type)
+		assert.Equal(t, "881 morning gaps=0\n", done.Command.Output)
+		assert.Equal(t, []string{"sh", "-c", "echo $1", "sh", "881 morning gaps=0"}, done.Command.Args)
+		assert.Equal(t, notify.EventPostProcessFailed, failed.Type)
+		assert.Equal(t, 2, failed.Command.ExitCode)
+		assert.NotEmpty(t, failed.Error)
+	}
+}
+
+func TestJob_PostProcess_Background(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	events := new(eventRecorder)
+	j, err := newJob(JobConfig{
+		Name:        "morning",
+		Channel:     "881",
+		Output:      Output{Dir: t.TempDir()},
+		PostProcess: [][]string{{"sh", "-c", "sleep 1; echo {{.Status}}"}},
+	}, nil, []recorder.Observer{events}, slog.Default())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	j.recorder.Pool = fetchertest.NewPool(0)
+	j.recorder.Pool.Fetcher("881").PollInterval = 50 * time.Millisecond
+	var wg sync.WaitGroup
+	j.background = func(work func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, j.record(ctx, start, start.Add(time.Hour)), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "post-processing shall not hold up the job")
+
+	wg.Wait()
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if assert.Len(t, events.events, 1) {
+		assert.Equal(t, "failed\n", events.events[0].Command.Output, "an unfinished recording shall be post-processed")
+	}
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// ErrJobExists is the error of creating a job with a taken name
+var ErrJobExists = errors.New("job already exists")
+
+// Config returns a copy of the applied configuration
+func (d *Daemon) Config() Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.config == nil {
+		return Config{}
+	}
+	cfg := *d.config
+	cfg.Jobs = append([]JobConfig(nil), d.config.Jobs...)
+	return cfg
+}
+
+// JobConfigs returns the configured jobs sorted by name
+func (d *Daemon) JobConfigs() []JobConfig {
+	jobs := d.Config().Jobs
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// JobConfig returns the configured job of the name
+func (d *Daemon) JobConfig(name string) (JobConfig, error) {
+	for _, jc := range d.Config().Jobs {
+		if jc.Name == name {
+			return jc, nil
+		}
+	}
+	return JobConfig{}, ErrUnknownJob
+}
+
+// CreateJob adds the job to the configuration
+func (d *Daemon) CreateJob(jc JobConfig) error {
+	return d.editJobs(func(jobs []JobConfig) ([]JobConfig, error) {
+		for _, existing := range jobs {
+			if existing.Name == jc.Name {
+				return nil, ErrJobExists
+			}
+		}
+		return append(jobs, jc), nil
+	})
+}
+
+// UpdateJob replaces the job of the same name in the configuration
+func (d *Daemon) UpdateJob(jc JobConfig) error {
+	return d.editJobs(func(jobs []JobConfig) ([]JobConfig, error) {
+		for i, existing := range jobs {
+			if existing.Name == jc.Name {
+				jobs[i] = jc
+				return jobs, nil
+			}
+		}
+		return nil, ErrUnknownJob
+	})
+}
+
+// DeleteJob removes the job from the configuration
+// Its in-flight recording continues until the scheduled end.
+func (d *Daemon) DeleteJob(name string) error {
+	return d.editJobs(func(jobs []JobConfig) ([]JobConfig, error) {
+		for i, existing := range jobs {
+			if existing.Name == name {
+				return append(jobs[:i], jobs[i+1:]...), nil
+			}
+		}
+		return nil, ErrUnknownJob
+	})
+}
+
+// editJobs saves the edited jobs to the configuration file, and applies them
+// The file is restored when the edited jobs cannot be applied, so that
+// the running jobs always match the file.
+func (d *Daemon) editJobs(edit func([]JobConfig) ([]JobConfig, error)) error {
+	d.editMu.Lock()
+	defer d.editMu.Unlock()
+
+	previous := d.Config()
+	cfg := d.Config()
+	jobs, err := edit(cfg.Jobs)
+	if err != nil {
+		return err
+	}
+	cfg.Jobs = jobs
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := d.save(&cfg); err != nil {
+		return err
+	}
+	if err := d.Apply(&cfg); err != nil {
+		if restoreErr := d.save(&previous); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// save the configuration to the configuration file
+// The file keeps its permissions, as it holds credentials.
+// Comments in the file are not preserved.
+func (d *Daemon) save(cfg *Config) error {
+	if d.ConfigPath == "" {
+		return nil
+	}
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(d.ConfigPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmpPath := d.ConfigPath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil { // regardless of the umask
+		return err
+	}
+	if err := os.Rename(tmpPath, d.ConfigPath); err != nil {
+		return err
+	}
+	if info, err := os.Stat(d.ConfigPath); err == nil {
+		d.mu.Lock()
+		d.modTime = info.ModTime()
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+// Recordings lists the recordings in the output directories of the jobs
+// The recordings are sorted by the scheduled start, latest first.
+func (d *Daemon) Recordings() ([]recording.Entry, error) {
+	cfg := d.Config()
+	dirs := map[string]bool{outputDir(cfg.Output.Dir): true}
+	for _, jc := range cfg.Jobs {
+		dirs[outputDir(jc.output(cfg.Output).Dir)] = true
+	}
+
+	var entries []recording.Entry
+	for dir := range dirs {
+		listed, err := recording.List(dir)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, listed...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ScheduledStart.After(entries[j].ScheduledStart)
+	})
+	return entries, nil
+}
+
+// outputDir is the directory of the recordings, the working directory when empty
+func outputDir(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return filepath.Clean(dir)
+}
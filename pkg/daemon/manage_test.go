@@ -0,0 +1,139 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+func TestDaemon_EditJobs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "crhk.yaml")
+	if err := os.WriteFile(configPath, []byte(sampleConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := New(configPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+	if !assert.NoError(t, d.Reload()) {
+		t.FailNow()
+	}
+
+	night := JobConfig{Name: "night", Channel: "864", Start: "23:00", Duration: time.Hour}
+	assert.NoError(t, d.CreateJob(night))
+	assert.Equal(t, ErrJobExists, d.CreateJob(night))
+	assert.Error(t, d.CreateJob(JobConfig{Name: "invalid", Channel: "881"}), "invalid job shall be rejected")
+	assert.Equal(t, []string{"mid-month", "morning", "night"}, d.Jobs())
+
+	night.Duration = 2 * time.Hour
+	assert.NoError(t, d.UpdateJob(night))
+	assert.Equal(t, ErrUnknownJob, d.UpdateJob(JobConfig{Name: "missing"}))
+	assert.NoError(t, d.DeleteJob("morning"))
+	assert.Equal(t, ErrUnknownJob, d.DeleteJob("morning"))
+	assert.Equal(t, []string{"mid-month", "night"}, d.Jobs())
+
+	saved, err := LoadConfig(configPath)
+	if assert.NoError(t, err) && assert.Len(t, saved.Jobs, 2) {
+		assert.Equal(t, night, saved.Jobs[1])
+		assert.Equal(t, "/tmp/recordings", saved.Output.Dir)
+	}
+	jc, err := d.JobConfig("night")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, jc.Duration)
+	assert.False(t, d.changed(), "saved configuration shall not be reloaded")
+	if info, err := os.Stat(configPath); assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "credentials shall stay private")
+	}
+}
+
+func TestDaemon_EditJobs_SaveFailed(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "crhk.yaml")
+	if err := os.WriteFile(configPath, []byte(sampleConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := New(configPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.ctx = ctx
+	if !assert.NoError(t, d.Reload()) {
+		t.FailNow()
+	}
+
+	// The temporary file cannot be written over a directory
+	if err := os.Mkdir(configPath+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, d.CreateJob(JobConfig{Name: "night", Channel: "864", Start: "23:00", Duration: time.Hour}))
+	assert.Equal(t, []string{"mid-month", "morning"}, d.Jobs(), "unsaved job shall not run")
+}
+
+func TestDaemon_Recordings(t *testing.T) {
+	dir := t.TempDir()
+	d := New("")
+	cfg, err := ParseConfig([]byte(`
+output:
+  dir: ` + dir + `
+`))
+	if !assert.NoError(t, err) || !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	m := recording.Metadata{Channel: "881", File: "881.aac", Status: recording.StatusCompleted}
+	if err := m.Save(filepath.Join(dir, m.File)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := d.Recordings()
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, filepath.Join(dir, "881.aac"), entries[0].Path)
+	}
+}
+
+func TestDaemon_Prune(t *testing.T) {
+	dir := t.TempDir()
+	d := New("")
+	cfg, err := ParseConfig([]byte(`
+output:
+  dir: ` + dir + `
+retention:
+  rules:
+    - channel: "881"
+      keep_last: 1
+`))
+	if !assert.NoError(t, err) || !assert.NoError(t, d.Apply(cfg)) {
+		t.FailNow()
+	}
+	for i, channel := range []string{"881", "881", "903"} {
+		start := time.Now().Add(-time.Duration(i) * time.Hour)
+		m := recording.Metadata{Channel: channel, File: fmt.Sprintf("%s-%d.aac", channel, i), ScheduledStart: start, Status: recording.StatusCompleted}
+		if err := os.WriteFile(filepath.Join(dir, m.File), []byte("aac"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Save(filepath.Join(dir, m.File)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := d.Prune(true)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Removed, 1) {
+		assert.Equal(t, "881-1.aac", report.Removed[0].File)
+	}
+	assert.False(t, d.sweepDue())
+	assert.FileExists(t, filepath.Join(dir, "881-1.aac"))
+
+	assert.Equal(t, uint64(diskspace.DefaultReserve), d.diskGuard.Reserve)
+	assert.NoError(t, d.diskGuard.Cleanup(), "low disk space shall enforce the retention rules")
+	assert.NoFileExists(t, filepath.Join(dir, "881-1.aac"))
+	d.sweep()
+	entries, err := d.Recordings()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,213 @@
+package daemon
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/notify/email"
+	"github.com/antonyho/crhk-recorder/pkg/notify/webhook"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// NotifyConfig lists the destinations of the recording lifecycle events
+type NotifyConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
+	Email    []EmailConfig   `yaml:"email,omitempty"`
+}
+
+// WebhookConfig is a webhook destination of the events
+type WebhookConfig struct {
+	URL          string        `yaml:"url,omitempty"`
+	Secret       string        `yaml:"secret,omitempty"`        // HMAC-SHA256 signing secret
+	Events       []string      `yaml:"events,omitempty"`        // all events when empty
+	GapThreshold int           `yaml:"gap_threshold,omitempty"` // a completed recording with more gaps is degraded
+	Retries      int           `yaml:"retries,omitempty"`       // defaults to notify.DefaultRetries
+	RetryDelay   time.Duration `yaml:"retry_delay,omitempty"`   // defaults to notify.DefaultRetryDelay
+}
+
+// EmailConfig is an SMTP destination of the recording reports
+type EmailConfig struct {
+	SMTP         string   `yaml:"smtp,omitempty"` // host:port of the SMTP server
+	Username     string   `yaml:"username,omitempty"`
+	Password     string   `yaml:"password,omitempty"`
+	TLS          bool     `yaml:"tls,omitempty"` // implicit TLS, otherwise STARTTLS when supported
+	From         string   `yaml:"from,omitempty"`
+	To           []string `yaml:"to,omitempty"`
+	Events       []string `yaml:"events,omitempty"`        // defaults to email.DefaultEvents
+	GapThreshold int      `yaml:"gap_threshold,omitempty"` // a completed recording with more gaps is degraded
+}
+
+// Validate the notification settings
+func (c NotifyConfig) Validate() error {
+	for _, w := range c.Webhooks {
+		if w.URL == "" {
+			return errors.New("webhook url must be provided")
+		}
+		if _, err := parseEvents(w.Events); err != nil {
+			return err
+		}
+	}
+	for _, m := range c.Email {
+		if m.SMTP == "" {
+			return errors.New("email smtp server must be provided")
+		}
+		if m.From == "" || len(m.To) == 0 {
+			return errors.New("email sender and recipients must be provided")
+		}
+		if _, err := parseEvents(m.Events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifiers creates the notifiers of the destinations
+func (c NotifyConfig) notifiers(logger *slog.Logger) ([]recorder.Observer, error) {
+	var notifiers []recorder.Observer
+	for _, w := range c.Webhooks {
+		n := notify.New(webhook.New(w.URL, w.Secret))
+		events, err := parseEvents(w.Events)
+		if err != nil {
+			return nil, err
+		}
+		n.Events = events
+		n.GapThreshold = w.GapThreshold
+		if w.Retries > 0 {
+			n.Retries = w.Retries
+		}
+		if w.RetryDelay > 0 {
+			n.RetryDelay = w.RetryDelay
+		}
+		n.Logger = logger
+		notifiers = append(notifiers, n)
+	}
+	for _, m := range c.Email {
+		n := notify.New(&email.Email{
+			Addr:     m.SMTP,
+			Username: m.Username,
+			Password: m.Password,
+			From:     m.From,
+			To:       m.To,
+			TLS:      m.TLS,
+		})
+		events, err := parseEvents(m.Events)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			events = email.DefaultEvents
+		}
+		n.Events = events
+		n.GapThreshold = m.GapThreshold
+		n.Logger = logger
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+func parseEvents(names []string) ([]notify.EventType, error) {
+	var events []notify.EventType
+	for _, name := range names {
+		e, err := notify.ParseEventType(name)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// notifierSet forwards the recording progress to the current notifiers
+// The notifiers are replaced on reloading the configuration,
+// without restarting the jobs.
+type notifierSet struct {
+	mu        sync.RWMutex
+	notifiers []recorder.Observer
+}
+
+// replace the notifiers, the previous notifiers are closed
+// after delivering the queued events
+func (s *notifierSet) replace(notifiers []recorder.Observer) {
+	s.mu.Lock()
+	previous := s.notifiers
+	s.notifiers = notifiers
+	s.mu.Unlock()
+	go closeAll(previous)
+}
+
+// close the notifiers after delivering the queued events
+func (s *notifierSet) close() {
+	s.mu.Lock()
+	previous := s.notifiers
+	s.notifiers = nil
+	s.mu.Unlock()
+	closeAll(previous)
+}
+
+func closeAll(notifiers []recorder.Observer) {
+	for _, n := range notifiers {
+		if c, ok := n.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func (s *notifierSet) each(call func(recorder.Observer)) {
+	s.mu.RLock()
+	notifiers := s.notifiers
+	s.mu.RUnlock()
+	for _, n := range notifiers {
+		call(n)
+	}
+}
+
+func (s *notifierSet) OnScheduled(r *recorder.Recorder, start, end time.Time) {
+	s.each(func(o recorder.Observer) { o.OnScheduled(r, start, end) })
+}
+
+func (s *notifierSet) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	s.each(func(o recorder.Observer) { o.OnStart(r, path, start, end) })
+}
+
+func (s *notifierSet) OnSegment(r *recorder.Recorder, sequence int64, bytes int, duration time.Duration) {
+	s.each(func(o recorder.Observer) { o.OnSegment(r, sequence, bytes, duration) })
+}
+
+func (s *notifierSet) OnGap(r *recorder.Recorder, from, to int64) {
+	s.each(func(o recorder.Observer) { o.OnGap(r, from, to) })
+}
+
+func (s *notifierSet) OnRetry(r *recorder.Recorder, attempt int, err error) {
+	s.each(func(o recorder.Observer) { o.OnRetry(r, attempt, err) })
+}
+
+func (s *notifierSet) OnResolve(r *recorder.Recorder, src resolver.StreamSource) {
+	s.each(func(o recorder.Observer) { o.OnResolve(r, src) })
+}
+
+func (s *notifierSet) OnPlaylist(r *recorder.Recorder, latency time.Duration) {
+	s.each(func(o recorder.Observer) { o.OnPlaylist(r, latency) })
+}
+
+func (s *notifierSet) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	s.each(func(o recorder.Observer) { o.OnStop(r, summary) })
+}
+
+// eventNotifier delivers the events other than the recorder progress
+type eventNotifier interface {
+	Notify(e notify.Event)
+}
+
+// Notify delivers the event with the notifiers
+func (s *notifierSet) Notify(e notify.Event) {
+	s.each(func(o recorder.Observer) {
+		if n, ok := o.(eventNotifier); ok {
+			n.Notify(e)
+		}
+	})
+}
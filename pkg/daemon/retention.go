@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/retention"
+)
+
+// DefaultSweepInterval is the interval of the periodic retention sweep
+const DefaultSweepInterval = time.Hour
+
+// RetentionConfig removes the old recordings by the rules
+// The rules are enforced after each recording and on the periodic sweep.
+type RetentionConfig struct {
+	Sweep  time.Duration   `yaml:"sweep,omitempty"`   // defaults to DefaultSweepInterval
+	DryRun bool            `yaml:"dry_run,omitempty"` // only log the recordings which would be removed
+	Rules  []RetentionRule `yaml:"rules,omitempty"`
+}
+
+// RetentionRule limits the recordings of a channel or a job
+// A rule without channel and job limits every recording.
+type RetentionRule struct {
+	Channel  string `yaml:"channel,omitempty"`
+	Job      string `yaml:"job,omitempty"`
+	KeepDays int    `yaml:"keep_days,omitempty"`
+	KeepLast int    `yaml:"keep_last,omitempty"`
+	MaxSize  string `yaml:"max_size,omitempty"` // e.g. 500MB or 20GB
+}
+
+// Validate the retention rules
+func (c RetentionConfig) Validate() error {
+	_, err := c.policies()
+	return err
+}
+
+func (c RetentionConfig) policies() ([]retention.Policy, error) {
+	var policies []retention.Policy
+	for _, rule := range c.Rules {
+		if rule.KeepDays < 0 || rule.KeepLast < 0 {
+			return nil, fmt.Errorf("retention of [%s%s]: limits must not be negative", rule.Channel, rule.Job)
+		}
+		p := retention.Policy{Channel: rule.Channel, Job: rule.Job, KeepDays: rule.KeepDays, KeepLast: rule.KeepLast}
+		if rule.MaxSize != "" {
+			size, err := diskspace.ParseSize(rule.MaxSize)
+			if err != nil {
+				return nil, fmt.Errorf("retention of [%s%s]: %w", rule.Channel, rule.Job, err)
+			}
+			p.MaxSize = size
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// sweeper serialises the retention sweeps
+type sweeper struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Prune enforces the retention rules on the recordings
+// A dry run only reports the recordings which would be removed.
+func (d *Daemon) Prune(dryRun bool) (retention.Report, error) {
+	d.sweeper.mu.Lock()
+	defer d.sweeper.mu.Unlock()
+	d.sweeper.last = time.Now()
+
+	policies, err := d.Config().Retention.policies()
+	if err != nil {
+		return retention.Report{}, err
+	}
+	entries, err := d.Recordings()
+	if err != nil {
+		return retention.Report{}, err
+	}
+	report, err := retention.Enforce(entries, policies, time.Now(), dryRun)
+	for _, e := range report.Removed {
+		if dryRun {
+			d.logger().Info("Recording would be removed by retention", logging.KeyFile, e.Path, logging.KeyChannel, e.Channel, logging.KeyJob, e.Job)
+		} else {
+			d.logger().Info("Recording removed by retention", logging.KeyFile, e.Path, logging.KeyChannel, e.Channel, logging.KeyJob, e.Job)
+		}
+	}
+	return report, err
+}
+
+// sweep enforces the retention rules of the configuration
+func (d *Daemon) sweep() {
+	cfg := d.Config().Retention
+	if len(cfg.Rules) == 0 {
+		return
+	}
+	if _, err := d.Prune(cfg.DryRun); err != nil {
+		d.logger().Error("Retention sweep failed", logging.Err(err))
+	}
+}
+
+// sweepDue reports whether the periodic retention sweep is due
+func (d *Daemon) sweepDue() bool {
+	interval := d.Config().Retention.Sweep
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+	d.sweeper.mu.Lock()
+	defer d.sweeper.mu.Unlock()
+	return time.Since(d.sweeper.last) >= interval
+}
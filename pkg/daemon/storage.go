@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/storage/s3"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// StorageConfig lists the remote storage of the finished recordings
+type StorageConfig struct {
+	S3 *S3Config `yaml:"s3,omitempty"`
+}
+
+// S3Config is an S3-compatible bucket of the recordings
+type S3Config struct {
+	Endpoint     string `yaml:"endpoint,omitempty"` // host[:port] of the S3 API
+	Insecure     bool   `yaml:"insecure,omitempty"` // plain HTTP instead of HTTPS
+	Region       string `yaml:"region,omitempty"`
+	Bucket       string `yaml:"bucket,omitempty"`
+	AccessKey    string `yaml:"access_key,omitempty"`
+	SecretKey    string `yaml:"secret_key,omitempty"`
+	KeyTemplate  string `yaml:"key_template,omitempty"`  // defaults to s3.DefaultKeyTemplate
+	StorageClass string `yaml:"storage_class,omitempty"` // the bucket default when empty
+	PartSize     string `yaml:"part_size,omitempty"`     // e.g. 64MB, defaults to s3.DefaultPartSize
+	DeleteLocal  bool   `yaml:"delete_local,omitempty"`  // delete the local files after a verified upload
+	Stream       bool   `yaml:"stream,omitempty"`        // upload the media while recording, the sidecar after it
+}
+
+// Validate the storage settings
+func (c StorageConfig) Validate() error {
+	_, err := c.uploader()
+	return err
+}
+
+// uploader creates the uploader of the configuration, nil without remote storage
+func (c StorageConfig) uploader() (*s3.Uploader, error) {
+	if c.S3 == nil {
+		return nil, nil
+	}
+	cfg := s3.Config{
+		Endpoint:     c.S3.Endpoint,
+		Insecure:     c.S3.Insecure,
+		Region:       c.S3.Region,
+		Bucket:       c.S3.Bucket,
+		AccessKey:    c.S3.AccessKey,
+		SecretKey:    c.S3.SecretKey,
+		KeyTemplate:  c.S3.KeyTemplate,
+		StorageClass: c.S3.StorageClass,
+		DeleteLocal:  c.S3.DeleteLocal,
+	}
+	if c.S3.PartSize != "" {
+		size, err := diskspace.ParseSize(c.S3.PartSize)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PartSize = uint64(size)
+	}
+	return s3.New(cfg)
+}
+
+// streaming reports whether the media is uploaded while recording
+func (c StorageConfig) streaming() bool {
+	return c.S3 != nil && c.S3.Stream
+}
+
+// streamUploader returns the uploader of the recordings while
+// recording, nil without streaming remote storage
+func (d *Daemon) streamUploader() *s3.Uploader {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.streaming {
+		return nil
+	}
+	return d.uploader
+}
+
+// remoteStream is the sink streaming a recording to the remote storage
+// The uploader is looked up when each recording starts, so that a reload
+// applies to the unchanged jobs. Nothing is written without streaming.
+type remoteStream struct {
+	uploader func() *s3.Uploader
+	stream   *s3.Stream
+}
+
+func (s *remoteStream) Open(info sink.Info) error {
+	s.stream = nil
+	u := s.uploader()
+	if u == nil {
+		return nil
+	}
+	s.stream = u.Stream()
+	return s.stream.Open(info)
+}
+
+func (s *remoteStream) Write(seg fetcher.Segment) error {
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.Write(seg)
+}
+
+func (s *remoteStream) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.Close()
+}
+
+func (s *remoteStream) String() string {
+	return "remote storage"
+}
+
+// finished uploads the recording and enforces the retention rules
+// It runs in the background after the post-processing.
+func (d *Daemon) finished(path string) {
+	d.mu.Lock()
+	uploader := d.uploader
+	d.mu.Unlock()
+
+	if uploader != nil {
+		d.upload(uploader, path)
+	}
+	d.sweep()
+}
+
+// upload the recording with media
+// The upload continues when the daemon stops, so that the local
+// files are not deleted without a complete upload. The media
+// streamed while recording is not uploaded again.
+func (d *Daemon) upload(uploader *s3.Uploader, path string) {
+	meta, err := recording.Load(path)
+	if err != nil || meta.Bytes == 0 {
+		return // nothing recorded
+	}
+	if _, err := uploader.Upload(context.Background(), path); err != nil {
+		d.logger().Error("Upload failed", logging.KeyFile, path, logging.Err(err))
+	}
+}
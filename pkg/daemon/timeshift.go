@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/timeshift"
+)
+
+// ErrNotBuffered is the error of saving from a channel without timeshift buffer
+var ErrNotBuffered = errors.New("channel is not buffered")
+
+// TimeshiftConfig keeps rolling buffers of the channels,
+// which can be saved as recordings afterwards
+type TimeshiftConfig struct {
+	Dir      string        `yaml:"dir,omitempty"`    // defaults to the timeshift directory in the working directory
+	Window   time.Duration `yaml:"window,omitempty"` // defaults to timeshift.DefaultWindow
+	Channels []string      `yaml:"channels,omitempty"`
+}
+
+// DefaultTimeshiftDir is the buffer directory when none is configured
+const DefaultTimeshiftDir = "timeshift"
+
+// Validate the timeshift settings
+func (c TimeshiftConfig) Validate() error {
+	if c.Window < 0 {
+		return errors.New("timeshift window must not be negative")
+	}
+	for _, channel := range c.Channels {
+		if channel == "" {
+			return errors.New("timeshift channel must be provided")
+		}
+		if err := recording.ValidateChannel(channel); err != nil {
+			return fmt.Errorf("timeshift %w", err)
+		}
+	}
+	return nil
+}
+
+func (c TimeshiftConfig) dir() string {
+	return firstNonEmpty(c.Dir, DefaultTimeshiftDir)
+}
+
+func (c TimeshiftConfig) buffered(channel string) bool {
+	for _, ch := range c.Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// startTimeshift replaces the running buffers with those of the configuration
+// d.mu must be held.
+func (d *Daemon) startTimeshift(c TimeshiftConfig) {
+	if d.stopTimeshift != nil {
+		d.stopTimeshift()
+		d.stopTimeshift = nil
+	}
+	d.timeshift = c
+	if len(c.Channels) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(d.recordContext())
+	d.stopTimeshift = cancel
+	for _, channel := range c.Channels {
+		b := timeshift.NewBuffer(c.dir(), channel, c.Window)
+		b.Pool = d.Pool
+		b.Logger = d.logger()
+		go func() {
+			if err := b.Run(ctx); err != nil && ctx.Err() == nil {
+				d.logger().Error("Timeshift buffering stopped", logging.KeyChannel, channel, logging.Err(err))
+			}
+		}()
+	}
+}
+
+// SaveTimeshift saves the buffered range of the channel as a recording
+// with the default output settings
+func (d *Daemon) SaveTimeshift(channel string, from, to time.Time) (recording.Entry, error) {
+	d.mu.Lock()
+	c := d.timeshift
+	output := d.defaults.Output
+	d.mu.Unlock()
+	if !c.buffered(channel) {
+		return recording.Entry{}, ErrNotBuffered
+	}
+
+	r := recorder.Recorder{
+		Channel:   channel,
+		OutputDir: output.Dir,
+		Prefix:    firstNonEmpty(output.Prefix, channel),
+	}
+	path, err := r.OutputPath(from)
+	if err != nil {
+		return recording.Entry{}, err
+	}
+	meta, err := timeshift.Export(c.dir(), channel, from, to, path)
+	if err != nil {
+		return recording.Entry{}, fmt.Errorf("saving timeshift of [%s]: %w", channel, err)
+	}
+	d.logger().Info("Timeshift saved", logging.KeyChannel, channel, logging.KeyFile, path, "from", from, "to", to)
+	return recording.Entry{Metadata: *meta, Path: path}, nil
+}
@@ -0,0 +1,110 @@
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the guard
+const (
+	DefaultReserve = 100 << 20 // free space kept on the filesystem
+	DefaultBitrate = 16000     // bytes per second of a 128 kbps stream
+)
+
+// ErrInsufficientSpace is the error of a filesystem without enough free space
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// Guard keeps free space on the filesystem of the recordings
+// It frees space with Cleanup before giving up.
+type Guard struct {
+	Reserve uint64                            // free space kept on the filesystem, e.g. DefaultReserve, none when zero
+	Refuse  bool                              // refuse a recording without the estimated space, otherwise warn
+	Cleanup func() error                      // frees space, e.g. by the retention rules
+	Free    func(path string) (uint64, error) // defaults to Free
+}
+
+// Check that the filesystem of the directory has the space needed
+// on top of the reserve. The free space is unknown on some platforms,
+// in which case nothing is checked.
+func (g *Guard) Check(dir string, needed uint64) error {
+	required := needed + g.Reserve
+	free, err := g.free(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if free >= required {
+		return nil
+	}
+	if g.Cleanup != nil {
+		if err := g.Cleanup(); err != nil {
+			return err
+		}
+		if free, err = g.free(dir); err != nil {
+			return err
+		}
+		if free >= required {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s free of %s required in %s", ErrInsufficientSpace, Format(free), Format(required), dir)
+}
+
+func (g *Guard) free(dir string) (uint64, error) {
+	if g.Free != nil {
+		return g.Free(dir)
+	}
+	return Free(dir)
+}
+
+// Estimate the size of recording the duration at the bitrate in bytes per second
+// The default bitrate applies to an unknown bitrate.
+func Estimate(duration time.Duration, bitrate float64) uint64 {
+	if bitrate <= 0 {
+		bitrate = DefaultBitrate
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return uint64(duration.Seconds() * bitrate)
+}
+
+// ParseSize parses a size in bytes with an optional unit, e.g. 500MB or 2GB
+// The units are in powers of 1024.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("incorrect size [%s]", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// Format the size in bytes with the largest unit
+func Format(size uint64) string {
+	for _, unit := range units {
+		if size >= uint64(unit.size) && unit.size > 1 {
+			return strconv.FormatFloat(float64(size)/float64(unit.size), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatUint(size, 10) + "B"
+}
+
+var units = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
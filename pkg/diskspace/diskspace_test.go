@@ -0,0 +1,87 @@
+package diskspace
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFree(t *testing.T) {
+	free, err := Free(t.TempDir())
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	assert.NoError(t, err)
+	assert.Greater(t, free, uint64(0))
+}
+
+func TestGuard_Check(t *testing.T) {
+	free := uint64(300)
+	cleanups := 0
+	g := &Guard{
+		Reserve: 100,
+		Free: func(path string) (uint64, error) {
+			return free, nil
+		},
+	}
+	assert.NoError(t, g.Check("/srv", 200))
+	err := g.Check("/srv", 201)
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+	assert.Contains(t, err.Error(), "300B free of 301B required in /srv")
+
+	g.Cleanup = func() error {
+		cleanups++
+		free += 1000
+		return nil
+	}
+	assert.NoError(t, g.Check("/srv", 500))
+	assert.Equal(t, 1, cleanups)
+	assert.NoError(t, g.Check("/srv", 500))
+	assert.Equal(t, 1, cleanups, "no cleanup with enough space")
+
+	g.Free = func(path string) (uint64, error) {
+		return 0, errors.ErrUnsupported
+	}
+	assert.NoError(t, g.Check("/srv", 1<<40), "unknown free space shall not be checked")
+}
+
+func TestGuard_Check_NoReserve(t *testing.T) {
+	g := &Guard{Free: func(path string) (uint64, error) {
+		return 300, nil
+	}}
+	assert.NoError(t, g.Check("/srv", 300), "a zero reserve shall keep no free space")
+	assert.ErrorIs(t, g.Check("/srv", 301), ErrInsufficientSpace)
+}
+
+func TestEstimate(t *testing.T) {
+	assert.Equal(t, uint64(3600*DefaultBitrate), Estimate(time.Hour, 0))
+	assert.Equal(t, uint64(8000*60), Estimate(time.Minute, 8000))
+	assert.Equal(t, uint64(0), Estimate(-time.Minute, 8000))
+}
+
+func TestParseSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"1024":   1024,
+		"10B":    10,
+		"2KB":    2048,
+		"1.5 MB": 3 << 19,
+		"5gb":    5 << 30,
+		"1TB":    1 << 40,
+	} {
+		size, err := ParseSize(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+	for _, value := range []string{"", "GB", "-1MB", "ten"} {
+		_, err := ParseSize(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "512B", Format(512))
+	assert.Equal(t, "1.5KB", Format(1536))
+	assert.Equal(t, "2.0GB", Format(2<<30))
+}
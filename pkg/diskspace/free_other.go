@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package diskspace
+
+import "errors"
+
+// Free is not supported on the platform, so the guard is disabled
+func Free(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
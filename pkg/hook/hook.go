@@ -0,0 +1,178 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// Defaults of the commands
+const (
+	DefaultTimeout = 10 * time.Minute
+	MaxOutput      = 64 << 10        // bytes of the captured output
+	WaitDelay      = 5 * time.Second // wait for the output after the command is killed
+)
+
+// Data of the argument templates
+// Start and End are the time of the first and last segments,
+// or the scheduled window when nothing was recorded.
+type Data struct {
+	recording.Metadata
+	Path  string
+	Start time.Time
+	End   time.Time
+}
+
+// NewData creates the template data of a recording
+func NewData(meta recording.Metadata, path string) Data {
+	d := Data{Metadata: meta, Path: path, Start: meta.Started, End: meta.Stopped}
+	if d.Start.IsZero() {
+		d.Start = meta.ScheduledStart
+	}
+	if d.End.IsZero() {
+		d.End = meta.ScheduledEnd
+	}
+	return d
+}
+
+// Env lists the recording details in environment variables
+func (d Data) Env() []string {
+	return []string{
+		"CRHK_JOB=" + d.Job,
+		"CRHK_CHANNEL=" + d.Channel,
+		"CRHK_FILE=" + d.Path,
+		"CRHK_START=" + d.ScheduledStart.Format(time.RFC3339),
+		"CRHK_END=" + d.ScheduledEnd.Format(time.RFC3339),
+		"CRHK_STATUS=" + string(d.Status),
+		"CRHK_DURATION=" + strconv.FormatFloat(d.Duration.Seconds(), 'f', -1, 64),
+		"CRHK_GAPS=" + strconv.Itoa(d.Gaps),
+	}
+}
+
+// funcs are the functions of the argument templates
+var funcs = template.FuncMap{
+	"base": filepath.Base,
+	"dir":  filepath.Dir,
+	"trimext": func(path string) string {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	},
+}
+
+// Command is a command with the arguments templated on Data,
+// e.g. ["ffmpeg", "-i", "{{.Path}}", "{{trimext .Path}}.mp3"]
+type Command struct {
+	Args    []string
+	Timeout time.Duration // defaults to DefaultTimeout
+
+	templates []*template.Template
+}
+
+// Parse the argument templates of the command
+func Parse(args []string, timeout time.Duration) (*Command, error) {
+	if len(args) == 0 {
+		return nil, errors.New("command must be provided")
+	}
+	c := &Command{Args: args, Timeout: timeout}
+	for i, arg := range args {
+		t, err := template.New(strconv.Itoa(i)).Funcs(funcs).Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument [%s]: %w", arg, err)
+		}
+		c.templates = append(c.templates, t)
+	}
+	return c, nil
+}
+
+// Expand the arguments of the recording
+func (c *Command) Expand(data Data) ([]string, error) {
+	args := make([]string, len(c.templates))
+	for i, t := range c.templates {
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		args[i] = b.String()
+	}
+	return args, nil
+}
+
+// Result of an executed command
+type Result struct {
+	Args     []string
+	ExitCode int    // -1 when the command did not exit by itself
+	Output   string // combined standard output and error, truncated to MaxOutput
+	Duration time.Duration
+	Err      error
+}
+
+// Run the command of the recording
+// The recording details are also passed in environment variables.
+// The command is killed on the timeout.
+func (c *Command) Run(ctx context.Context, data Data) Result {
+	args, err := c.Expand(data)
+	if err != nil {
+		return Result{Args: c.Args, ExitCode: -1, Err: err}
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), data.Env()...)
+	cmd.WaitDelay = WaitDelay
+	output := &limitedBuffer{limit: MaxOutput}
+	cmd.Stdout, cmd.Stderr = output, output
+
+	started := time.Now()
+	err = cmd.Run()
+	result := Result{
+		Args:     args,
+		ExitCode: -1,
+		Output:   output.String(),
+		Duration: time.Since(started),
+		Err:      err,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		result.Err = fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+	}
+	return result
+}
+
+// limitedBuffer keeps the first bytes written to it
+type limitedBuffer struct {
+	strings.Builder
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Builder.Write(p[:max(room, 0)])
+	} else {
+		b.Builder.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.Builder.String() + "\n[output truncated]"
+	}
+	return b.Builder.String()
+}
@@ -0,0 +1,88 @@
+package hook
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+func sampleData() Data {
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	return NewData(recording.Metadata{
+		Channel:        "881",
+		Job:            "morning",
+		ScheduledStart: start,
+		ScheduledEnd:   start.Add(time.Hour),
+		Started:        start.Add(time.Second),
+		Status:         recording.StatusCompleted,
+		Duration:       59 * time.Minute,
+		Gaps:           2,
+	}, "/srv/881-2024-05-01-070000.aac")
+}
+
+func TestCommand_Expand(t *testing.T) {
+	c, err := Parse([]string{"ffmpeg", "-i", "{{.Path}}", "{{trimext .Path}}.mp3",
+		"{{.Channel}} {{.Start.Format \"15:04:05\"}}-{{.End.Format \"15:04\"}} {{.Duration}} gaps={{.Gaps}} {{base .Path}}"}, 0)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	args, err := c.Expand(sampleData())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-i", "/srv/881-2024-05-01-070000.aac", "/srv/881-2024-05-01-070000.mp3",
+		"881 07:00:01-08:00 59m0s gaps=2 881-2024-05-01-070000.aac"}, args)
+
+	_, err = Parse([]string{"echo", "{{.Path"}, 0)
+	assert.Error(t, err)
+	_, err = Parse(nil, 0)
+	assert.Error(t, err)
+	c, _ = Parse([]string{"echo", "{{.Unknown}}"}, 0)
+	_, err = c.Expand(sampleData())
+	assert.Error(t, err)
+}
+
+func TestCommand_Run(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	c, _ := Parse([]string{"sh", "-c", `echo "$CRHK_CHANNEL $CRHK_GAPS $1"; exit 3`, "sh", "{{.Job}}"}, 0)
+	result := c.Run(context.Background(), sampleData())
+	assert.Error(t, result.Err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "881 2 morning\n", result.Output)
+
+	c, _ = Parse([]string{"sh", "-c", "echo ok"}, 0)
+	result = c.Run(context.Background(), sampleData())
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "ok\n", result.Output)
+}
+
+func TestCommand_Run_Timeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip(err)
+	}
+	c, _ := Parse([]string{"sleep", "10"}, 100*time.Millisecond)
+	started := time.Now()
+	result := c.Run(context.Background(), sampleData())
+	assert.Less(t, time.Since(started), 5*time.Second)
+	if assert.Error(t, result.Err) {
+		assert.Contains(t, result.Err.Error(), "timed out")
+	}
+	assert.Equal(t, -1, result.ExitCode)
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	b := &limitedBuffer{limit: 4}
+	n, err := b.Write([]byte("abc"))
+	assert.Equal(t, 3, n)
+	assert.NoError(t, err)
+	b.Write([]byte("defg"))
+	assert.True(t, strings.HasPrefix(b.String(), "abcd\n"))
+	assert.Contains(t, b.String(), "truncated")
+}
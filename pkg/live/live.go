@@ -0,0 +1,283 @@
+package live
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// MediaType of the re-streamed audio
+const MediaType = "audio/aac"
+
+// PlaylistType is the media type of the HLS playlist
+const PlaylistType = "application/vnd.apple.mpegurl"
+
+// segment of the recording file
+type segment struct {
+	offset   int64
+	size     int64
+	duration time.Duration
+}
+
+// stream is the recording of a channel which is re-streamed
+type stream struct {
+	channel string
+	job     string
+	path    string
+
+	mu       sync.Mutex
+	segments []segment
+	size     int64
+	ended    bool
+	changed  chan struct{} // closed on every change
+}
+
+func newStream(r *recorder.Recorder, path string) *stream {
+	return &stream{channel: r.Channel, job: r.Job, path: path, changed: make(chan struct{})}
+}
+
+// append the segment written to the recording file
+func (s *stream) append(size int64, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments = append(s.segments, segment{offset: s.size, size: size, duration: duration})
+	s.size += size
+	s.notify()
+}
+
+func (s *stream) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	s.notify()
+}
+
+// notify the waiting listeners, s.mu must be held
+func (s *stream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// state returns the written size, whether the stream has ended,
+// and the channel closed on the next change
+func (s *stream) state() (int64, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, s.ended, s.changed
+}
+
+// Server is a recorder Observer which re-streams the recordings
+// on the local network. The segments are served from the recording
+// file, so listening opens no extra connection to CRHK.
+//
+//	/live/{channel}/playlist.m3u8     HLS EVENT playlist from the recording start
+//	/live/{channel}/{n}.aac           HLS media segment
+//	/live/{channel}/stream.aac        Icecast-compatible progressive ADTS stream
+//
+// A stopped recording stays available until the channel is recorded again,
+// unless its file is replaced, e.g. by an encoded file. A recording which
+// is not written to a file, e.g. to a pipe, is not re-streamed.
+type Server struct {
+	recorder.NopObserver
+
+	mu         sync.Mutex
+	byChannel  map[string]*stream
+	byRecorder map[*recorder.Recorder]*stream
+	mux        *http.ServeMux
+}
+
+// New creates a Server
+func New() *Server {
+	s := &Server{
+		byChannel:  make(map[string]*stream),
+		byRecorder: make(map[*recorder.Recorder]*stream),
+		mux:        http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /live/{channel}/playlist.m3u8", s.servePlaylist)
+	s.mux.HandleFunc("GET /live/{channel}/stream.aac", s.serveStream)
+	s.mux.HandleFunc("GET /live/{channel}/{segment}", s.serveSegment)
+	return s
+}
+
+// OnStart re-streams the recording of a recording file
+func (s *Server) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		delete(s.byChannel, r.Channel) // no file to serve
+		return
+	}
+	st := newStream(r, path)
+	s.byChannel[r.Channel] = st
+	s.byRecorder[r] = st
+}
+
+// OnSegment publishes the segment written to the recording file
+func (s *Server) OnSegment(r *recorder.Recorder, sequence int64, bytes int, duration time.Duration) {
+	s.mu.Lock()
+	st := s.byRecorder[r]
+	s.mu.Unlock()
+	if st != nil {
+		st.append(int64(bytes), duration)
+	}
+}
+
+// OnStop ends the stream of the recording
+// The stream of a replaced recording file is removed.
+func (s *Server) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	s.mu.Lock()
+	st := s.byRecorder[r]
+	delete(s.byRecorder, r)
+	if st != nil && summary.Path != st.path && s.byChannel[r.Channel] == st {
+		delete(s.byChannel, r.Channel)
+	}
+	s.mu.Unlock()
+	if st != nil {
+		st.end()
+	}
+}
+
+// ServeHTTP serves the live streams
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) *stream {
+	s.mu.Lock()
+	st := s.byChannel[r.PathValue("channel")]
+	s.mu.Unlock()
+	if st == nil {
+		http.Error(w, "channel is not recording", http.StatusNotFound)
+	}
+	return st
+}
+
+// servePlaylist serves the HLS EVENT playlist, which grows from the
+// recording start so that listeners can seek back
+func (s *Server) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	st := s.stream(w, r)
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	segments := append([]segment(nil), st.segments...)
+	ended := st.ended
+	st.mu.Unlock()
+
+	target := 1.0
+	for _, seg := range segments {
+		target = math.Max(target, math.Ceil(seg.duration.Seconds()))
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.aac\n", seg.duration.Seconds(), i)
+	}
+	if ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	w.Header().Set("Content-Type", PlaylistType)
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, b.String())
+}
+
+// serveSegment serves a media segment from the recording file
+func (s *Server) serveSegment(w http.ResponseWriter, r *http.Request) {
+	st := s.stream(w, r)
+	if st == nil {
+		return
+	}
+	name := r.PathValue("segment")
+	index, err := strconv.Atoi(strings.TrimSuffix(name, ".aac"))
+	st.mu.Lock()
+	valid := err == nil && strings.HasSuffix(name, ".aac") && index >= 0 && index < len(st.segments)
+	var seg segment
+	if valid {
+		seg = st.segments[index]
+	}
+	st.mu.Unlock()
+	if !valid {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(st.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Content-Length", strconv.FormatInt(seg.size, 10))
+	io.Copy(w, io.NewSectionReader(file, seg.offset, seg.size))
+}
+
+// serveStream serves the recording as a progressive ADTS stream
+// It starts from the latest segment and follows the recording file
+// until the recording stops or the listener disconnects.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	st := s.stream(w, r)
+	if st == nil {
+		return
+	}
+	file, err := os.Open(st.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	st.mu.Lock()
+	var offset int64
+	if n := len(st.segments); n > 0 {
+		offset = st.segments[n-1].offset
+	}
+	st.mu.Unlock()
+
+	name := st.channel
+	if st.job != "" {
+		name = st.job + " (" + st.channel + ")"
+	}
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("icy-name", "CRHK "+name)
+	w.Header().Set("icy-pub", "0")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		size, ended, changed := st.state()
+		if offset < size {
+			n, err := io.Copy(w, io.NewSectionReader(file, offset, size-offset))
+			offset += n
+			if err != nil {
+				return // listener disconnected
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			continue
+		}
+		if ended {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
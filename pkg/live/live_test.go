@@ -0,0 +1,126 @@
+package live_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/live"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// writeSegment appends the segment to the recording file and notifies the server
+func writeSegment(t *testing.T, s *live.Server, r *recorder.Recorder, path, data string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	s.OnSegment(r, 0, len(data), 10*time.Second)
+}
+
+func get(s http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestServer_HLS(t *testing.T) {
+	s := live.New()
+	rcdr := recorder.NewRecorder("881")
+	path := filepath.Join(t.TempDir(), "881.aac")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusNotFound, get(s, "/live/881/playlist.m3u8").Code)
+
+	s.OnStart(rcdr, path, time.Now(), time.Now().Add(time.Hour))
+	writeSegment(t, s, rcdr, path, "first")
+	writeSegment(t, s, rcdr, path, "second")
+
+	w := get(s, "/live/881/playlist.m3u8")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, live.PlaylistType, w.Header().Get("Content-Type"))
+	playlist := w.Body.String()
+	assert.Contains(t, playlist, "#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	assert.Contains(t, playlist, "#EXT-X-TARGETDURATION:10\n")
+	assert.Contains(t, playlist, "#EXTINF:10.000,\n0.aac\n#EXTINF:10.000,\n1.aac\n")
+	assert.NotContains(t, playlist, "#EXT-X-ENDLIST")
+
+	assert.Equal(t, "first", get(s, "/live/881/0.aac").Body.String())
+	assert.Equal(t, "second", get(s, "/live/881/1.aac").Body.String())
+	assert.Equal(t, http.StatusNotFound, get(s, "/live/881/2.aac").Code)
+
+	s.OnStop(rcdr, recorder.Summary{Path: path})
+	assert.Contains(t, get(s, "/live/881/playlist.m3u8").Body.String(), "#EXT-X-ENDLIST\n")
+}
+
+func TestServer_Stream(t *testing.T) {
+	s := live.New()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	rcdr := recorder.NewRecorder("881")
+	path := filepath.Join(t.TempDir(), "881.aac")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.OnStart(rcdr, path, time.Now(), time.Now().Add(time.Hour))
+	writeSegment(t, s, rcdr, path, "old|")
+	writeSegment(t, s, rcdr, path, "live|")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/live/881/stream.aac", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, live.MediaType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "CRHK 881", resp.Header.Get("icy-name"))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		writeSegment(t, s, rcdr, path, "next|")
+		s.OnStop(rcdr, recorder.Summary{Path: path})
+	}()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "live|next|", string(body), "stream shall start from the latest segment and end with the recording")
+	assert.False(t, strings.Contains(string(body), "old"))
+}
+
+func TestServer_NoRecordingFile(t *testing.T) {
+	s := live.New()
+	rcdr := recorder.NewRecorder("881")
+	dir := t.TempDir()
+
+	// The recording is written to a pipe
+	s.OnStart(rcdr, filepath.Join(dir, "881.aac"), time.Now(), time.Now().Add(time.Hour))
+	s.OnSegment(rcdr, 1, 10, 10*time.Second)
+	assert.Equal(t, http.StatusNotFound, get(s, "/live/881/playlist.m3u8").Code)
+	s.OnStop(rcdr, recorder.Summary{})
+
+	// The recording file is replaced by the encoded file
+	path := filepath.Join(dir, "903.aac")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rcdr = recorder.NewRecorder("903")
+	s.OnStart(rcdr, path, time.Now(), time.Now().Add(time.Hour))
+	writeSegment(t, s, rcdr, path, "first")
+	assert.Equal(t, http.StatusOK, get(s, "/live/903/0.aac").Code)
+	s.OnStop(rcdr, recorder.Summary{Path: filepath.Join(dir, "903.mp3")})
+	assert.Equal(t, http.StatusNotFound, get(s, "/live/903/0.aac").Code)
+}
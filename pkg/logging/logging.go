@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Attribute keys shared by the log records
+const (
+	KeyChannel  = "channel"
+	KeyJob      = "job"
+	KeySequence = "sequence"
+	KeyURL      = "url"
+	KeyAttempt  = "attempt"
+	KeyError    = "error"
+	KeyFile     = "file"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options of the logger
+type Options struct {
+	Format     string // text or json
+	Level      string // debug, info, warn or error
+	File       string // log file path, logs go to stderr when empty
+	MaxSize    int    // megabytes of the log file before it is rotated
+	MaxBackups int    // number of rotated log files to keep
+	MaxAge     int    // days to keep the rotated log files
+}
+
+// New creates the logger with the options
+// The returned closer releases the log file.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if opts.Level != "" {
+		if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if opts.File != "" {
+		out = &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSize,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAge,
+		}
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return nil, nil, fmt.Errorf("incorrect log format [%s]", opts.Format)
+	}
+
+	return slog.New(handler), out, nil
+}
+
+// Err is the attribute of an error
+// A nil error gives an empty attribute which is not logged.
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.Any(KeyError, err)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
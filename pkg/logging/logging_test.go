@@ -0,0 +1,46 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+)
+
+func TestNew(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "crhkrecorder.log")
+	logger, closer, err := logging.New(logging.Options{Format: logging.FormatJSON, Level: "warn", File: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("Recording started", logging.KeyChannel, "881")
+	logger.Warn("Download failed", logging.KeyChannel, "881", logging.KeyAttempt, 2, logging.Err(errors.New("empty media file")))
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(content, &record), "only the warning shall be logged") {
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, "881", record[logging.KeyChannel])
+		assert.EqualValues(t, 2, record[logging.KeyAttempt])
+		assert.Equal(t, "empty media file", record[logging.KeyError])
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, _, err := logging.New(logging.Options{Format: "xml"})
+	assert.Error(t, err)
+
+	_, _, err = logging.New(logging.Options{Level: "verbose"})
+	assert.Error(t, err)
+}
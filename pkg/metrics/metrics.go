@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// Namespace of the metric names
+const Namespace = "crhk"
+
+// Recording states of the state gauge
+const (
+	StateIdle      = "idle"
+	StateScheduled = "scheduled"
+	StateRecording = "recording"
+)
+
+var states = []string{StateIdle, StateScheduled, StateRecording}
+
+// Collector is a recorder Observer which exposes the
+// recording progress as Prometheus metrics
+type Collector struct {
+	segments        *prometheus.CounterVec
+	bytes           *prometheus.CounterVec
+	gaps            *prometheus.CounterVec
+	missing         *prometheus.CounterVec
+	retries         *prometheus.CounterVec
+	resolves        *prometheus.CounterVec
+	recordings      *prometheus.CounterVec
+	cookieExpiry    *prometheus.GaugeVec
+	cookieAge       *prometheus.GaugeVec
+	playlistLatency *prometheus.HistogramVec
+	state           *prometheus.GaugeVec
+	nextStart       *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	resolved map[string]time.Time // resolved time of the cookies by channel
+}
+
+// New creates a Collector
+func New() *Collector {
+	jobLabels := []string{"channel", "job"}
+	return &Collector{
+		segments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "segments_downloaded_total",
+			Help:      "Number of media segments downloaded and written.",
+		}, jobLabels),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_written_total",
+			Help:      "Number of media bytes written.",
+		}, jobLabels),
+		gaps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "gaps_total",
+			Help:      "Number of interruptions in the media sequence.",
+		}, jobLabels),
+		missing: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "missing_segments_total",
+			Help:      "Number of media segments lost in gaps.",
+		}, jobLabels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "retries_total",
+			Help:      "Number of download retries by error class.",
+		}, []string{"channel", "job", "class"}),
+		resolves: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "resolver_calls_total",
+			Help:      "Number of stream source resolutions.",
+		}, []string{"channel"}),
+		recordings: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "recordings_total",
+			Help:      "Number of stopped recordings by status.",
+		}, []string{"channel", "job", "status"}),
+		cookieExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "cloudfront_cookie_expiry_timestamp_seconds",
+			Help:      "Expiry time of the CloudFront cookies policy.",
+		}, []string{"channel"}),
+		cookieAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "cloudfront_cookie_age_seconds",
+			Help:      "Time since the CloudFront cookies were obtained.",
+		}, []string{"channel"}),
+		playlistLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "playlist_latency_seconds",
+			Help:      "Latency of fetching the channel playlist.",
+			Buckets:   prometheus.DefBuckets,
+		}, jobLabels),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "recording_state",
+			Help:      "Current recording state, 1 for the active state.",
+		}, []string{"channel", "job", "state"}),
+		nextStart: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "next_recording_timestamp_seconds",
+			Help:      "Start time of the next scheduled recording.",
+		}, jobLabels),
+		resolved: make(map[string]time.Time),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.segments, c.bytes, c.gaps, c.missing, c.retries, c.resolves, c.recordings,
+		c.cookieExpiry, c.cookieAge, c.playlistLatency, c.state, c.nextStart,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	for channel, resolved := range c.resolved {
+		c.cookieAge.WithLabelValues(channel).Set(time.Since(resolved).Seconds())
+	}
+	c.mu.Unlock()
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// Handler serves the metrics of the Collector in Prometheus format
+func Handler(c *Collector) (http.Handler, error) {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), nil
+}
+
+func (c *Collector) setState(r *recorder.Recorder, state string) {
+	for _, s := range states {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		c.state.WithLabelValues(r.Channel, r.Job, s).Set(value)
+	}
+}
+
+// OnScheduled implements recorder.Observer
+func (c *Collector) OnScheduled(r *recorder.Recorder, start, end time.Time) {
+	c.setState(r, StateScheduled)
+	c.nextStart.WithLabelValues(r.Channel, r.Job).Set(float64(start.Unix()))
+}
+
+// OnStart implements recorder.Observer
+func (c *Collector) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	c.setState(r, StateRecording)
+}
+
+// OnSegment implements recorder.Observer
+func (c *Collector) OnSegment(r *recorder.Recorder, sequence int64, bytes int, duration time.Duration) {
+	c.segments.WithLabelValues(r.Channel, r.Job).Inc()
+	c.bytes.WithLabelValues(r.Channel, r.Job).Add(float64(bytes))
+}
+
+// OnGap implements recorder.Observer
+func (c *Collector) OnGap(r *recorder.Recorder, from, to int64) {
+	c.gaps.WithLabelValues(r.Channel, r.Job).Inc()
+	c.missing.WithLabelValues(r.Channel, r.Job).Add(float64(to - from + 1))
+}
+
+// OnRetry implements recorder.Observer
+func (c *Collector) OnRetry(r *recorder.Recorder, attempt int, err error) {
+	c.retries.WithLabelValues(r.Channel, r.Job, ErrorClass(err)).Inc()
+}
+
+// OnResolve implements recorder.Observer
+// The recordings sharing the channel download report the same
+// resolution, which is counted once.
+func (c *Collector) OnResolve(r *recorder.Recorder, src resolver.StreamSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if resolved, found := c.resolved[r.Channel]; found && resolved.Equal(src.Resolved) {
+		return
+	}
+	c.resolved[r.Channel] = src.Resolved
+	c.resolves.WithLabelValues(r.Channel).Inc()
+	if expiry, err := src.CloudfrontCookie.Expiry(); err == nil {
+		c.cookieExpiry.WithLabelValues(r.Channel).Set(float64(expiry.Unix()))
+	}
+}
+
+// OnPlaylist implements recorder.Observer
+func (c *Collector) OnPlaylist(r *recorder.Recorder, latency time.Duration) {
+	c.playlistLatency.WithLabelValues(r.Channel, r.Job).Observe(latency.Seconds())
+}
+
+// OnStop implements recorder.Observer
+func (c *Collector) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	c.setState(r, StateIdle)
+	c.recordings.WithLabelValues(r.Channel, r.Job, string(summary.Status)).Inc()
+}
+
+// ErrorClass classifies a download error for the retries metric
+func ErrorClass(err error) string {
+	var statusErr *resolver.StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return "http"
+	case errors.Is(err, resolver.ErrEmptyMedia):
+		return "media"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,80 @@
+package metrics_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/metrics"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+func scrape(t *testing.T, c *metrics.Collector) string {
+	handler, err := metrics.Handler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCollector(t *testing.T) {
+	c := metrics.New()
+	rcdr := recorder.NewRecorder("881")
+	rcdr.Job = "morning"
+	now := time.Now()
+
+	c.OnScheduled(rcdr, now, now.Add(time.Hour))
+	c.OnStart(rcdr, "881.aac", now, now.Add(time.Hour))
+	c.OnSegment(rcdr, 458898, 1024, 12*time.Second)
+	c.OnSegment(rcdr, 458899, 1024, 12*time.Second)
+	c.OnGap(rcdr, 458900, 458902)
+	c.OnRetry(rcdr, 1, &resolver.StatusError{Resource: "playlist", StatusCode: 403})
+	c.OnResolve(rcdr, resolver.StreamSource{Resolved: now})
+	overlapping := recorder.NewRecorder("881")
+	overlapping.Job = "adhoc"
+	c.OnResolve(overlapping, resolver.StreamSource{Resolved: now}) // shared download
+	c.OnPlaylist(rcdr, 100*time.Millisecond)
+
+	body := scrape(t, c)
+	assert.Contains(t, body, `crhk_segments_downloaded_total{channel="881",job="morning"} 2`)
+	assert.Contains(t, body, `crhk_bytes_written_total{channel="881",job="morning"} 2048`)
+	assert.Contains(t, body, `crhk_gaps_total{channel="881",job="morning"} 1`)
+	assert.Contains(t, body, `crhk_missing_segments_total{channel="881",job="morning"} 3`)
+	assert.Contains(t, body, `crhk_retries_total{channel="881",class="http",job="morning"} 1`)
+	assert.Contains(t, body, `crhk_resolver_calls_total{channel="881"} 1`)
+	assert.Contains(t, body, `crhk_cloudfront_cookie_age_seconds{channel="881"}`)
+	assert.Contains(t, body, `crhk_playlist_latency_seconds_count{channel="881",job="morning"} 1`)
+	assert.Contains(t, body, `crhk_recording_state{channel="881",job="morning",state="recording"} 1`)
+
+	c.OnStop(rcdr, recorder.Summary{Metadata: recording.Metadata{Status: recording.StatusCompleted}})
+	body = scrape(t, c)
+	assert.Contains(t, body, `crhk_recording_state{channel="881",job="morning",state="idle"} 1`)
+	assert.Contains(t, body, `crhk_recording_state{channel="881",job="morning",state="recording"} 0`)
+	assert.Contains(t, body, `crhk_recordings_total{channel="881",job="morning",status="completed"} 1`)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "http", metrics.ErrorClass(fmt.Errorf("get: %w", &resolver.StatusError{StatusCode: 404})))
+	assert.Equal(t, "media", metrics.ErrorClass(resolver.ErrEmptyMedia))
+	assert.Equal(t, "timeout", metrics.ErrorClass(timeoutError{}))
+	assert.Equal(t, "other", metrics.ErrorClass(errors.New("playlist URL not found")))
+}
@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+)
+
+// PublishTimeout is how long a publish waits for the broker
+const PublishTimeout = 5 * time.Second
+
+// Options of the broker connection
+type Options struct {
+	Broker      string // e.g. tcp://localhost:1883
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string // the availability topic goes offline on disconnection
+	Logger      *slog.Logger
+}
+
+// pahoClient is the Client of a broker connection
+// The broker drops the subscriptions of a clean session on disconnection,
+// so they are subscribed again on every reconnection.
+type pahoClient struct {
+	client paho.Client
+	logger *slog.Logger
+	broker string
+	prefix string
+
+	mu            sync.Mutex
+	subscriptions map[string]paho.MessageHandler
+}
+
+// Connect to the broker
+// The availability topic of the prefix is the last will of the connection.
+func Connect(opts Options) (Client, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	prefix := opts.TopicPrefix
+	if prefix == "" {
+		prefix = DefaultTopicPrefix
+	}
+	clientID := opts.ClientID
+	if clientID == "" {
+		clientID = prefix
+	}
+
+	pahoOpts := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(clientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetWill(prefix+"/availability", Offline, 1, true)
+	c := &pahoClient{
+		logger:        logger,
+		broker:        opts.Broker,
+		prefix:        prefix,
+		subscriptions: make(map[string]paho.MessageHandler),
+	}
+	pahoOpts.SetOnConnectHandler(c.onConnect)
+	c.client = paho.NewClient(pahoOpts)
+
+	token := c.client.Connect()
+	if !token.WaitTimeout(PublishTimeout) {
+		return nil, fmt.Errorf("connect MQTT broker [%s] timed out", opts.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Publish the message with QoS 1
+// It does not wait for the broker, and the failure is logged.
+func (c *pahoClient) Publish(topic string, retained bool, payload []byte) error {
+	token := c.client.Publish(topic, 1, retained, payload)
+	go func() {
+		if !token.WaitTimeout(PublishTimeout) {
+			c.logger.Warn("MQTT publish timed out", "topic", topic)
+		} else if err := token.Error(); err != nil {
+			c.logger.Warn("MQTT publish failed", "topic", topic, logging.Err(err))
+		}
+	}()
+	return nil
+}
+
+// onConnect comes back online and restores the subscriptions
+// after connecting or reconnecting
+func (c *pahoClient) onConnect(paho.Client) {
+	c.logger.Info("MQTT connected", "broker", c.broker)
+	c.Publish(c.prefix+"/availability", true, []byte(Online))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, handler := range c.subscriptions {
+		token := c.client.Subscribe(topic, 1, handler)
+		go func() {
+			if !token.WaitTimeout(PublishTimeout) {
+				c.logger.Warn("MQTT subscribe timed out", "topic", topic)
+			} else if err := token.Error(); err != nil {
+				c.logger.Warn("MQTT subscribe failed", "topic", topic, logging.Err(err))
+			}
+		}()
+	}
+}
+
+// Subscribe the topic with QoS 1
+// The topic is subscribed again on reconnection.
+func (c *pahoClient) Subscribe(topic string, handler func(payload []byte)) error {
+	h := func(_ paho.Client, msg paho.Message) {
+		handler(msg.Payload())
+	}
+	c.mu.Lock()
+	c.subscriptions[topic] = h
+	c.mu.Unlock()
+	token := c.client.Subscribe(topic, 1, h)
+	if !token.WaitTimeout(PublishTimeout) {
+		return fmt.Errorf("subscribe MQTT topic [%s] timed out", topic)
+	}
+	return token.Error()
+}
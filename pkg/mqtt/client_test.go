@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+)
+
+// doneToken is a completed paho token
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+
+func (doneToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// fakeBroker is the paho client of a broker dropping the subscriptions
+// on disconnection
+type fakeBroker struct {
+	paho.Client // unused methods
+
+	mu            sync.Mutex
+	subscriptions map[string]paho.MessageHandler
+}
+
+func (b *fakeBroker) Publish(string, byte, bool, interface{}) paho.Token {
+	return doneToken{}
+}
+
+func (b *fakeBroker) Subscribe(topic string, _ byte, handler paho.MessageHandler) paho.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[topic] = handler
+	return doneToken{}
+}
+
+// disconnect drops the subscriptions
+func (b *fakeBroker) disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = make(map[string]paho.MessageHandler)
+}
+
+func (b *fakeBroker) subscribed(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.subscriptions[topic]
+	return ok
+}
+
+func TestPahoClient_Reconnect(t *testing.T) {
+	broker := &fakeBroker{subscriptions: make(map[string]paho.MessageHandler)}
+	c := &pahoClient{
+		client:        broker,
+		logger:        slog.Default(),
+		prefix:        DefaultTopicPrefix,
+		subscriptions: make(map[string]paho.MessageHandler),
+	}
+	c.onConnect(broker)
+	assert.NoError(t, c.Subscribe("crhk-recorder/command", func([]byte) {}))
+	assert.True(t, broker.subscribed("crhk-recorder/command"))
+
+	broker.disconnect()
+	c.onConnect(broker)
+	assert.True(t, broker.subscribed("crhk-recorder/command"), "command topic shall be subscribed after reconnecting")
+}
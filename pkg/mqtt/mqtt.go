@@ -0,0 +1,364 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// Default topic prefixes
+const (
+	DefaultTopicPrefix     = "crhk-recorder"
+	DefaultDiscoveryPrefix = "homeassistant"
+)
+
+// Recorder states published on the state topic
+const (
+	StateIdle      = "idle"
+	StateScheduled = "scheduled"
+	StateRecording = "recording"
+)
+
+// Availability payloads
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// Client publishes and subscribes MQTT messages
+type Client interface {
+	Publish(topic string, retained bool, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) error
+}
+
+// Controller starts and stops the recordings on command
+type Controller interface {
+	// StartRecording records the channel immediately for the duration
+	StartRecording(channel string, duration time.Duration) (string, error)
+
+	// StopRecording stops the in-flight recording of the job
+	StopRecording(name string) error
+
+	// Recording returns the names of the jobs which are recording
+	Recording() []string
+}
+
+// Command received on the command topic
+// A record command is either JSON {"action":"record","channel":"881","minutes":30}
+// or text "record 881 30". A stop command is {"action":"stop","job":"name"}
+// or text "stop", which stops all the recordings when no job is given.
+type Command struct {
+	Action  string `json:"action"` // record or stop
+	Channel string `json:"channel,omitempty"`
+	Minutes int    `json:"minutes,omitempty"`
+	Job     string `json:"job,omitempty"`
+}
+
+// ParseCommand parses a JSON or text command
+func ParseCommand(payload []byte) (Command, error) {
+	var cmd Command
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			return cmd, err
+		}
+	} else {
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			return cmd, errors.New("empty command")
+		}
+		cmd.Action = fields[0]
+		switch {
+		case cmd.Action == "record" && len(fields) == 3:
+			cmd.Channel = fields[1]
+			minutes, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return cmd, fmt.Errorf("incorrect minutes [%s]", fields[2])
+			}
+			cmd.Minutes = minutes
+		case cmd.Action == "stop" && len(fields) <= 2:
+			if len(fields) == 2 {
+				cmd.Job = fields[1]
+			}
+		default:
+			return cmd, fmt.Errorf("incorrect command [%s]", text)
+		}
+	}
+
+	switch cmd.Action {
+	case "record":
+		if cmd.Channel == "" || cmd.Minutes <= 0 {
+			return cmd, errors.New("record command requires channel and minutes")
+		}
+	case "stop":
+	default:
+		return cmd, fmt.Errorf("unknown action [%s]", cmd.Action)
+	}
+	return cmd, nil
+}
+
+// CurrentJob is the payload of the current job topic
+type CurrentJob struct {
+	Job     string    `json:"job,omitempty"`
+	Channel string    `json:"channel"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Path    string    `json:"path"`
+}
+
+// Bridge is a recorder Observer which publishes the recorder state,
+// current job and last result to MQTT with Home Assistant discovery,
+// and executes the commands from the command topic
+type Bridge struct {
+	recorder.NopObserver
+
+	Client          Client
+	Controller      Controller // commands are ignored when nil
+	TopicPrefix     string     // defaults to DefaultTopicPrefix
+	DiscoveryPrefix string     // defaults to DefaultDiscoveryPrefix
+	NodeID          string     // Home Assistant node ID, defaults to the topic prefix
+	Logger          *slog.Logger
+
+	mu        sync.Mutex
+	scheduled map[string]bool        // scheduled recordings by job or channel
+	recording map[string]*CurrentJob // in-flight recordings by job or channel
+	current   *CurrentJob            // most recently started recording
+}
+
+// NewBridge creates a Bridge of the client
+func NewBridge(client Client, controller Controller) *Bridge {
+	return &Bridge{
+		Client:          client,
+		Controller:      controller,
+		TopicPrefix:     DefaultTopicPrefix,
+		DiscoveryPrefix: DefaultDiscoveryPrefix,
+	}
+}
+
+// Topic returns the full topic name under the topic prefix
+func (b *Bridge) Topic(name string) string {
+	return b.topicPrefix() + "/" + name
+}
+
+func (b *Bridge) topicPrefix() string {
+	if b.TopicPrefix == "" {
+		return DefaultTopicPrefix
+	}
+	return b.TopicPrefix
+}
+
+// Start publishes the discovery payloads and the initial state,
+// and subscribes the command topic
+func (b *Bridge) Start() error {
+	for topic, payload := range b.discovery() {
+		if err := b.publishJSON(topic, payload); err != nil {
+			return err
+		}
+	}
+	if err := b.Client.Publish(b.Topic("availability"), true, []byte(Online)); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.publishState()
+	b.mu.Unlock()
+	return b.Client.Subscribe(b.Topic("command"), b.handleCommand)
+}
+
+// OnScheduled publishes the scheduled state
+func (b *Bridge) OnScheduled(r *recorder.Recorder, start, end time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+	b.scheduled[key(r)] = true
+	b.publishState()
+}
+
+// OnStart publishes the recording state and the current job
+func (b *Bridge) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+	job := &CurrentJob{Job: r.Job, Channel: r.Channel, Start: start, End: end, Path: path}
+	b.recording[key(r)] = job
+	b.current = job
+	b.publishState()
+}
+
+// OnStop publishes the last result, the state and the current job
+func (b *Bridge) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	result := notify.SummaryEvent(r, summary)
+	result.Time = summary.Stopped
+	switch summary.Status {
+	case recording.StatusCompleted:
+		result.Type = notify.EventCompleted
+	case recording.StatusFailed:
+		result.Type = notify.EventFailed
+	default:
+		result.Type = notify.EventType(summary.Status)
+	}
+	if err := b.publishJSON(b.Topic("last_result"), result); err != nil {
+		b.logger().Warn("Publish MQTT last result failed", logging.Err(err))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.init()
+	delete(b.recording, key(r))
+	delete(b.scheduled, key(r))
+	if b.current != nil && b.current.Job == r.Job && b.current.Channel == r.Channel {
+		b.current = nil
+		for _, job := range b.recording {
+			if b.current == nil || job.Start.After(b.current.Start) {
+				b.current = job
+			}
+		}
+	}
+	b.publishState()
+}
+
+// init the maps, b.mu must be held
+func (b *Bridge) init() {
+	if b.scheduled == nil {
+		b.scheduled = make(map[string]bool)
+		b.recording = make(map[string]*CurrentJob)
+	}
+}
+
+// publishState publishes the state and the current job, b.mu must be held
+func (b *Bridge) publishState() {
+	state := StateIdle
+	if len(b.recording) > 0 {
+		state = StateRecording
+	} else if len(b.scheduled) > 0 {
+		state = StateScheduled
+	}
+	if err := b.Client.Publish(b.Topic("state"), true, []byte(state)); err != nil {
+		b.logger().Warn("Publish MQTT state failed", logging.Err(err))
+	}
+
+	current := b.current
+	if current == nil {
+		current = &CurrentJob{}
+	}
+	if err := b.publishJSON(b.Topic("job"), current); err != nil {
+		b.logger().Warn("Publish MQTT current job failed", logging.Err(err))
+	}
+}
+
+func (b *Bridge) publishJSON(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Client.Publish(topic, true, payload)
+}
+
+// handleCommand executes the command with the controller
+func (b *Bridge) handleCommand(payload []byte) {
+	if b.Controller == nil {
+		return
+	}
+	cmd, err := ParseCommand(payload)
+	if err != nil {
+		b.logger().Warn("Incorrect MQTT command", "payload", string(payload), logging.Err(err))
+		return
+	}
+
+	switch cmd.Action {
+	case "record":
+		name, err := b.Controller.StartRecording(cmd.Channel, time.Duration(cmd.Minutes)*time.Minute)
+		if err != nil {
+			b.logger().Error("MQTT record command failed", logging.KeyChannel, cmd.Channel, logging.Err(err))
+			return
+		}
+		b.logger().Info("MQTT record command accepted", logging.KeyJob, name, logging.KeyChannel, cmd.Channel)
+
+	case "stop":
+		names := []string{cmd.Job}
+		if cmd.Job == "" {
+			names = b.Controller.Recording()
+		}
+		for _, name := range names {
+			if err := b.Controller.StopRecording(name); err != nil {
+				b.logger().Error("MQTT stop command failed", logging.KeyJob, name, logging.Err(err))
+			}
+		}
+	}
+}
+
+// discovery returns the Home Assistant discovery payloads by topic
+func (b *Bridge) discovery() map[string]interface{} {
+	node := b.NodeID
+	if node == "" {
+		node = strings.ReplaceAll(b.topicPrefix(), "/", "_")
+	}
+	prefix := b.DiscoveryPrefix
+	if prefix == "" {
+		prefix = DefaultDiscoveryPrefix
+	}
+	device := map[string]interface{}{
+		"identifiers": []string{node},
+		"name":        "CRHK Recorder",
+		"model":       "crhk-recorder",
+	}
+	entity := func(name, id string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":               name,
+			"unique_id":          node + "_" + id,
+			"object_id":          node + "_" + id,
+			"availability_topic": b.Topic("availability"),
+			"device":             device,
+		}
+	}
+
+	state := entity("State", "state")
+	state["state_topic"] = b.Topic("state")
+	state["icon"] = "mdi:radio"
+
+	job := entity("Current job", "job")
+	job["state_topic"] = b.Topic("job")
+	job["value_template"] = "{{ value_json.job or value_json.channel or 'none' }}"
+	job["json_attributes_topic"] = b.Topic("job")
+
+	result := entity("Last result", "last_result")
+	result["state_topic"] = b.Topic("last_result")
+	result["value_template"] = "{{ value_json.status }}"
+	result["json_attributes_topic"] = b.Topic("last_result")
+
+	stop := entity("Stop recording", "stop")
+	stop["command_topic"] = b.Topic("command")
+	stop["payload_press"] = `{"action":"stop"}`
+	stop["icon"] = "mdi:stop"
+
+	return map[string]interface{}{
+		prefix + "/sensor/" + node + "/state/config":       state,
+		prefix + "/sensor/" + node + "/job/config":         job,
+		prefix + "/sensor/" + node + "/last_result/config": result,
+		prefix + "/button/" + node + "/stop/config":        stop,
+	}
+}
+
+func (b *Bridge) logger() *slog.Logger {
+	if b.Logger == nil {
+		return slog.Default()
+	}
+	return b.Logger
+}
+
+// key identifies the recordings of a recorder
+func key(r *recorder.Recorder) string {
+	if r.Job != "" {
+		return r.Job
+	}
+	return r.Channel
+}
@@ -0,0 +1,143 @@
+package mqtt_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/mqtt"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// fakeClient keeps the last retained message of every topic
+type fakeClient struct {
+	mu       sync.Mutex
+	messages map[string]string
+	handlers map[string]func([]byte)
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{messages: make(map[string]string), handlers: make(map[string]func([]byte))}
+}
+
+func (c *fakeClient) Publish(topic string, retained bool, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[topic] = string(payload)
+	return nil
+}
+
+func (c *fakeClient) Subscribe(topic string, handler func([]byte)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[topic] = handler
+	return nil
+}
+
+func (c *fakeClient) message(topic string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages[topic]
+}
+
+type fakeController struct {
+	started  []string
+	stopped  []string
+	duration time.Duration
+}
+
+func (c *fakeController) StartRecording(channel string, duration time.Duration) (string, error) {
+	c.started = append(c.started, channel)
+	c.duration = duration
+	return "adhoc-" + channel, nil
+}
+
+func (c *fakeController) StopRecording(name string) error {
+	c.stopped = append(c.stopped, name)
+	return nil
+}
+
+func (c *fakeController) Recording() []string {
+	return []string{"morning", "adhoc-903"}
+}
+
+func TestBridge(t *testing.T) {
+	client := newFakeClient()
+	b := mqtt.NewBridge(client, nil)
+	if !assert.NoError(t, b.Start()) {
+		t.FailNow()
+	}
+	assert.Equal(t, mqtt.Online, client.message("crhk-recorder/availability"))
+	assert.Equal(t, mqtt.StateIdle, client.message("crhk-recorder/state"))
+
+	var discovery map[string]interface{}
+	if assert.NoError(t, json.Unmarshal([]byte(client.message("homeassistant/sensor/crhk-recorder/state/config")), &discovery)) {
+		assert.Equal(t, "crhk-recorder/state", discovery["state_topic"])
+		assert.Equal(t, "crhk-recorder/availability", discovery["availability_topic"])
+	}
+	assert.NotEmpty(t, client.message("homeassistant/button/crhk-recorder/stop/config"))
+
+	rcdr := recorder.NewRecorder("881")
+	rcdr.Job = "morning"
+	now := time.Now()
+	b.OnScheduled(rcdr, now, now.Add(time.Hour))
+	assert.Equal(t, mqtt.StateScheduled, client.message("crhk-recorder/state"))
+
+	b.OnStart(rcdr, "/srv/morning.aac", now, now.Add(time.Hour))
+	assert.Equal(t, mqtt.StateRecording, client.message("crhk-recorder/state"))
+	var job mqtt.CurrentJob
+	if assert.NoError(t, json.Unmarshal([]byte(client.message("crhk-recorder/job")), &job)) {
+		assert.Equal(t, "morning", job.Job)
+		assert.Equal(t, "/srv/morning.aac", job.Path)
+	}
+
+	b.OnStop(rcdr, recorder.Summary{
+		Metadata: recording.Metadata{Status: recording.StatusCompleted, Bytes: 100, Gaps: 1},
+		Path:     "/srv/morning.aac",
+	})
+	assert.Equal(t, mqtt.StateIdle, client.message("crhk-recorder/state"))
+	var result map[string]interface{}
+	if assert.NoError(t, json.Unmarshal([]byte(client.message("crhk-recorder/last_result")), &result)) {
+		assert.Equal(t, "completed", result["event"])
+		assert.Equal(t, float64(100), result["bytes"])
+	}
+	assert.Contains(t, client.message("crhk-recorder/job"), `"channel":""`)
+}
+
+func TestBridge_Command(t *testing.T) {
+	client := newFakeClient()
+	controller := new(fakeController)
+	b := mqtt.NewBridge(client, controller)
+	if !assert.NoError(t, b.Start()) {
+		t.FailNow()
+	}
+	handle := client.handlers["crhk-recorder/command"]
+	if !assert.NotNil(t, handle) {
+		t.FailNow()
+	}
+
+	handle([]byte(`{"action":"record","channel":"881","minutes":30}`))
+	handle([]byte("record 903 5"))
+	handle([]byte("record 903"))
+	assert.Equal(t, []string{"881", "903"}, controller.started)
+	assert.Equal(t, 5*time.Minute, controller.duration)
+
+	handle([]byte(`{"action":"stop","job":"morning"}`))
+	handle([]byte("stop"))
+	assert.Equal(t, []string{"morning", "morning", "adhoc-903"}, controller.stopped)
+}
+
+func TestParseCommand(t *testing.T) {
+	cmd, err := mqtt.ParseCommand([]byte("record 881 30"))
+	assert.NoError(t, err)
+	assert.Equal(t, mqtt.Command{Action: "record", Channel: "881", Minutes: 30}, cmd)
+
+	for _, payload := range []string{"", "record 881", "record 881 x", `{"action":"record","channel":"881"}`, "play 881", "{"} {
+		_, err := mqtt.ParseCommand([]byte(payload))
+		assert.Error(t, err, payload)
+	}
+}
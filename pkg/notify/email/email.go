@@ -0,0 +1,153 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+)
+
+// DefaultEvents are the events reported by email
+// Failed recordings are alerted, other recordings are summarised.
+var DefaultEvents = []notify.EventType{notify.EventCompleted, notify.EventDegraded, notify.EventFailed, notify.EventPostProcessFailed}
+
+// Email sends the events as plain text emails through an SMTP server
+type Email struct {
+	Addr     string // host:port of the SMTP server
+	Username string // authenticates with PLAIN when set
+	Password string
+	From     string
+	To       []string
+	TLS      bool // implicit TLS, otherwise STARTTLS is used when supported
+}
+
+// Send the event as an email
+func (m *Email) Send(ctx context.Context, e notify.Event) error {
+	if len(m.To) == 0 {
+		return errors.New("email: no recipient")
+	}
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+	if m.TLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !m.TLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(e)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message composes the email of the event
+func (m *Email) message(e notify.Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	// The job name may break the header, which is encoded when it is not printable ASCII
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", Subject(e)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(Body(e), "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// Subject of the email of the event
+// A failed recording is an alert.
+func Subject(e notify.Event) string {
+	name := e.Channel
+	if e.Job != "" {
+		name = fmt.Sprintf("%s (%s)", e.Job, e.Channel)
+	}
+	switch e.Type {
+	case notify.EventFailed:
+		return fmt.Sprintf("[crhk-recorder] ALERT: recording %s failed", name)
+	case notify.EventPostProcessFailed:
+		return fmt.Sprintf("[crhk-recorder] ALERT: post-processing of %s failed", name)
+	case notify.EventPostProcessed:
+		return fmt.Sprintf("[crhk-recorder] Recording %s post-processed", name)
+	}
+	return fmt.Sprintf("[crhk-recorder] Recording %s %s", name, e.Type)
+}
+
+// Body of the email of the event
+func Body(e notify.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Event:     %s\n", e.Type)
+	fmt.Fprintf(&b, "Channel:   %s\n", e.Channel)
+	if e.Job != "" {
+		fmt.Fprintf(&b, "Job:       %s\n", e.Job)
+	}
+	fmt.Fprintf(&b, "Window:    %s - %s\n", e.Window.Start.Format(time.RFC3339), e.Window.End.Format(time.RFC3339))
+	captured := time.Duration(e.Duration * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(&b, "Captured:  %s of %s\n", captured, e.Window.End.Sub(e.Window.Start))
+	fmt.Fprintf(&b, "Segments:  %d\n", e.Segments)
+	fmt.Fprintf(&b, "Gaps:      %d (%d segments missing)\n", e.Gaps.Count, e.Gaps.MissingSegments)
+	if e.Path != "" {
+		fmt.Fprintf(&b, "File:      %s\n", e.Path)
+	}
+	fmt.Fprintf(&b, "Size:      %d bytes\n", e.Bytes)
+	if e.Command != nil {
+		fmt.Fprintf(&b, "Command:   %s\n", strings.Join(e.Command.Args, " "))
+		fmt.Fprintf(&b, "Exit code: %d\n", e.Command.ExitCode)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "Error:     %s\n", e.Error)
+	}
+	if e.Command != nil && e.Command.Output != "" {
+		fmt.Fprintf(&b, "\nOutput:\n%s\n", e.Command.Output)
+	}
+	return b.String()
+}
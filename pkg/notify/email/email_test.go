@@ -0,0 +1,142 @@
+package email_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/notify/email"
+)
+
+// mail received by the SMTP stand-in
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts one session of a minimal SMTP stand-in
+func serveSMTP(t *testing.T) (string, <-chan mail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan mail, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var m mail
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				m.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				m.data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				received <- m
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestEmail_Send(t *testing.T) {
+	addr, received := serveSMTP(t)
+	m := &email.Email{Addr: addr, From: "recorder@example.com", To: []string{"ops@example.com", "dj@example.com"}}
+	start := time.Date(2021, time.January, 25, 23, 6, 0, 0, time.UTC)
+	e := notify.Event{
+		Type:     notify.EventFailed,
+		Time:     start,
+		Channel:  "881",
+		Job:      "night",
+		Window:   notify.Window{Start: start, End: start.Add(time.Hour)},
+		Path:     "/srv/night.aac",
+		Bytes:    2048,
+		Duration: 600,
+		Gaps:     notify.Gaps{Count: 1, MissingSegments: 3},
+		Error:    "media file: unsuccessful HTTP request. response code: 403",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, m.Send(ctx, e)) {
+		t.FailNow()
+	}
+
+	got := <-received
+	assert.Equal(t, "recorder@example.com", got.from)
+	assert.Equal(t, []string{"ops@example.com", "dj@example.com"}, got.to)
+	assert.Contains(t, got.data, "Subject: [crhk-recorder] ALERT: recording night (881) failed\r\n")
+	assert.Contains(t, got.data, "Captured:  10m0s of 1h0m0s\r\n")
+	assert.Contains(t, got.data, "Gaps:      1 (3 segments missing)\r\n")
+	assert.Contains(t, got.data, "File:      /srv/night.aac\r\n")
+	assert.Contains(t, got.data, "Size:      2048 bytes\r\n")
+	assert.Contains(t, got.data, "Error:     media file: unsuccessful HTTP request. response code: 403\r\n")
+}
+
+func TestEmail_Send_HeaderInjection(t *testing.T) {
+	addr, received := serveSMTP(t)
+	m := &email.Email{Addr: addr, From: "recorder@example.com", To: []string{"ops@example.com"}}
+	e := notify.Event{Type: notify.EventFailed, Time: time.Now(), Channel: "881", Job: "night\r\nBcc: victim@example.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !assert.NoError(t, m.Send(ctx, e)) {
+		t.FailNow()
+	}
+
+	got := <-received
+	header, _, _ := strings.Cut(got.data, "\r\n\r\n")
+	assert.NotContains(t, header, "\r\nBcc:")
+	assert.Contains(t, header, "Subject: =?UTF-8?q?")
+}
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "[crhk-recorder] Recording 903 completed",
+		email.Subject(notify.Event{Type: notify.EventCompleted, Channel: "903"}))
+	assert.Equal(t, "[crhk-recorder] ALERT: post-processing of morning (881) failed",
+		email.Subject(notify.Event{Type: notify.EventPostProcessFailed, Channel: "881", Job: "morning"}))
+}
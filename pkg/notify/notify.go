@@ -0,0 +1,306 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/hook"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// Default delivery settings of a Notifier
+const (
+	DefaultRetries    = 3
+	DefaultRetryDelay = 5 * time.Second
+	DefaultTimeout    = 30 * time.Second
+	QueueSize         = 64
+)
+
+// EventType is the kind of recording lifecycle event
+type EventType string
+
+// Recording lifecycle events
+const (
+	EventScheduled EventType = "scheduled"
+	EventStarted   EventType = "started"
+	EventCompleted EventType = "completed"
+	EventFailed    EventType = "failed"
+	EventDegraded  EventType = "degraded" // completed with gaps above the threshold
+
+	EventPostProcessed     EventType = "post_processed" // a post-processing command succeeded
+	EventPostProcessFailed EventType = "post_process_failed"
+)
+
+// EventTypes lists all the event types
+var EventTypes = []EventType{
+	EventScheduled, EventStarted, EventCompleted, EventFailed, EventDegraded,
+	EventPostProcessed, EventPostProcessFailed,
+}
+
+// ParseEventType validates the name of an event type
+func ParseEventType(name string) (EventType, error) {
+	for _, t := range EventTypes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event [%s]", name)
+}
+
+// Window is the scheduled recording window
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Gaps summarises the interruptions in the media sequence
+type Gaps struct {
+	Count           int `json:"count"`
+	MissingSegments int `json:"missing_segments"`
+}
+
+// Command is the result of a post-processing command
+type Command struct {
+	Args     []string `json:"args"`
+	ExitCode int      `json:"exit_code"`
+	Output   string   `json:"output,omitempty"`
+	Duration float64  `json:"duration_seconds"`
+}
+
+// Event is the payload of a notification
+type Event struct {
+	Type     EventType        `json:"event"`
+	Time     time.Time        `json:"time"`
+	Channel  string           `json:"channel"`
+	Job      string           `json:"job,omitempty"`
+	Window   Window           `json:"window"`
+	Path     string           `json:"path,omitempty"` // output file path
+	Status   recording.Status `json:"status,omitempty"`
+	Bytes    int64            `json:"bytes"`
+	Segments int              `json:"segments"`
+	Duration float64          `json:"duration_seconds"` // duration of the recorded segments
+	Gaps     Gaps             `json:"gaps"`
+	Command  *Command         `json:"command,omitempty"` // of the post-processing events
+	Error    string           `json:"error,omitempty"`
+}
+
+// Sender delivers an event to a destination
+type Sender interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// Notifier is a recorder Observer which turns the recording
+// lifecycle into events, and delivers them with a Sender
+// Events are delivered in order in the background, and
+// a failed delivery is retried.
+type Notifier struct {
+	recorder.NopObserver
+
+	Sender       Sender
+	Events       []EventType   // delivered events, all events when empty
+	GapThreshold int           // a completed recording with more gaps is degraded
+	Retries      int           // retries after a failed delivery
+	RetryDelay   time.Duration // delay before the first retry, doubled on every retry
+	Timeout      time.Duration // timeout of a delivery attempt
+	Logger       *slog.Logger  // defaults to slog.Default()
+
+	mu     sync.Mutex
+	queue  chan Event
+	closed bool
+	done   chan struct{}
+}
+
+// New creates a Notifier of all events with the default delivery settings
+func New(sender Sender) *Notifier {
+	return &Notifier{
+		Sender:     sender,
+		Retries:    DefaultRetries,
+		RetryDelay: DefaultRetryDelay,
+		Timeout:    DefaultTimeout,
+	}
+}
+
+// OnScheduled notifies the scheduled event
+func (n *Notifier) OnScheduled(r *recorder.Recorder, start, end time.Time) {
+	n.Notify(Event{
+		Type:    EventScheduled,
+		Channel: r.Channel,
+		Job:     r.Job,
+		Window:  Window{Start: start, End: end},
+	})
+}
+
+// OnStart notifies the started event
+func (n *Notifier) OnStart(r *recorder.Recorder, path string, start, end time.Time) {
+	n.Notify(Event{
+		Type:    EventStarted,
+		Channel: r.Channel,
+		Job:     r.Job,
+		Window:  Window{Start: start, End: end},
+		Path:    path,
+		Status:  recording.StatusRecording,
+	})
+}
+
+// OnStop notifies the completed, degraded or failed event
+// An interrupted recording is not notified.
+func (n *Notifier) OnStop(r *recorder.Recorder, summary recorder.Summary) {
+	e := SummaryEvent(r, summary)
+	switch summary.Status {
+	case recording.StatusCompleted:
+		e.Type = EventCompleted
+		if summary.Gaps > n.GapThreshold {
+			e.Type = EventDegraded
+		}
+	case recording.StatusFailed:
+		e.Type = EventFailed
+	default:
+		return
+	}
+	n.Notify(e)
+}
+
+// SummaryEvent fills an event with the summary of a stopped recording
+// The event type is left for the caller.
+func SummaryEvent(r *recorder.Recorder, summary recorder.Summary) Event {
+	return Event{
+		Channel:  r.Channel,
+		Job:      r.Job,
+		Window:   Window{Start: summary.ScheduledStart, End: summary.ScheduledEnd},
+		Path:     summary.Path,
+		Status:   summary.Status,
+		Bytes:    summary.Bytes,
+		Segments: summary.Segments,
+		Duration: summary.Duration.Seconds(),
+		Gaps:     Gaps{Count: summary.Gaps, MissingSegments: summary.MissingSegments},
+		Error:    summary.Error,
+	}
+}
+
+// PostProcessEvent reports a post-processing command of a recording
+func PostProcessEvent(meta recording.Metadata, path string, result hook.Result) Event {
+	e := Event{
+		Type:     EventPostProcessed,
+		Channel:  meta.Channel,
+		Job:      meta.Job,
+		Window:   Window{Start: meta.ScheduledStart, End: meta.ScheduledEnd},
+		Path:     path,
+		Status:   meta.Status,
+		Bytes:    meta.Bytes,
+		Segments: meta.Segments,
+		Duration: meta.Duration.Seconds(),
+		Gaps:     Gaps{Count: meta.Gaps, MissingSegments: meta.MissingSegments},
+		Command: &Command{
+			Args:     result.Args,
+			ExitCode: result.ExitCode,
+			Output:   result.Output,
+			Duration: result.Duration.Seconds(),
+		},
+	}
+	if result.Err != nil {
+		e.Type = EventPostProcessFailed
+		e.Error = result.Err.Error()
+	}
+	return e
+}
+
+// Notify queues the event for delivery
+// The event is dropped when it is filtered, or the queue is full or closed.
+func (n *Notifier) Notify(e Event) {
+	if !n.wants(e.Type) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if n.queue == nil {
+		n.queue = make(chan Event, QueueSize)
+		n.done = make(chan struct{})
+		go n.deliver(n.queue, n.done)
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.logger().Warn("Notification queue is full, event dropped",
+			"event", e.Type, logging.KeyChannel, e.Channel)
+	}
+}
+
+// Close stops accepting events and waits for the queued events to be delivered
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	queue, done := n.queue, n.done
+	n.mu.Unlock()
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+	return nil
+}
+
+func (n *Notifier) wants(t EventType) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, want := range n.Events {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Notifier) deliver(queue <-chan Event, done chan<- struct{}) {
+	defer close(done)
+	for e := range queue {
+		delay := n.RetryDelay
+		for attempt := 0; ; attempt++ {
+			err := n.send(e)
+			if err == nil {
+				break
+			}
+			if attempt >= n.Retries {
+				n.logger().Error("Notification failed, giving up",
+					"event", e.Type, logging.KeyChannel, e.Channel, logging.KeyAttempt, attempt+1, logging.Err(err))
+				break
+			}
+			n.logger().Warn("Notification failed, retrying",
+				"event", e.Type, logging.KeyChannel, e.Channel, logging.KeyAttempt, attempt+1, logging.Err(err))
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func (n *Notifier) send(e Event) error {
+	ctx := context.Background()
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	return n.Sender.Send(ctx, e)
+}
+
+func (n *Notifier) logger() *slog.Logger {
+	if n.Logger == nil {
+		return slog.Default()
+	}
+	return n.Logger
+}
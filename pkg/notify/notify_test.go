@@ -0,0 +1,119 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+)
+
+// fakeSender fails the first deliveries
+type fakeSender struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	events   []notify.Event
+}
+
+func (s *fakeSender) Send(ctx context.Context, e notify.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.failures {
+		return errors.New("unavailable")
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *fakeSender) types() []notify.EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []notify.EventType
+	for _, e := range s.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func summary(status recording.Status, gaps int) recorder.Summary {
+	return recorder.Summary{
+		Metadata: recording.Metadata{Status: status, Gaps: gaps, MissingSegments: 2 * gaps, Bytes: 1024},
+		Path:     "/tmp/881.aac",
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	sender := &fakeSender{}
+	n := notify.New(sender)
+	n.GapThreshold = 1
+	rcdr := recorder.NewRecorder("881")
+	rcdr.Job = "morning"
+	now := time.Now()
+
+	n.OnScheduled(rcdr, now, now.Add(time.Hour))
+	n.OnStart(rcdr, "/tmp/881.aac", now, now.Add(time.Hour))
+	n.OnStop(rcdr, summary(recording.StatusCompleted, 1))
+	n.OnStop(rcdr, summary(recording.StatusCompleted, 2))
+	n.OnStop(rcdr, summary(recording.StatusFailed, 0))
+	n.OnStop(rcdr, summary(recording.StatusInterrupted, 0))
+	n.Close()
+
+	assert.Equal(t, []notify.EventType{
+		notify.EventScheduled, notify.EventStarted, notify.EventCompleted, notify.EventDegraded, notify.EventFailed,
+	}, sender.types())
+	degraded := sender.events[3]
+	assert.Equal(t, "881", degraded.Channel)
+	assert.Equal(t, "morning", degraded.Job)
+	assert.Equal(t, "/tmp/881.aac", degraded.Path)
+	assert.Equal(t, int64(1024), degraded.Bytes)
+	assert.Equal(t, notify.Gaps{Count: 2, MissingSegments: 4}, degraded.Gaps)
+	assert.False(t, degraded.Time.IsZero())
+}
+
+func TestNotifier_Events(t *testing.T) {
+	sender := &fakeSender{}
+	n := notify.New(sender)
+	n.Events = []notify.EventType{notify.EventFailed}
+	rcdr := recorder.NewRecorder("881")
+
+	n.OnStart(rcdr, "/tmp/881.aac", time.Now(), time.Now())
+	n.OnStop(rcdr, summary(recording.StatusFailed, 0))
+	n.Close()
+
+	assert.Equal(t, []notify.EventType{notify.EventFailed}, sender.types())
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	sender := &fakeSender{failures: 2}
+	n := notify.New(sender)
+	n.RetryDelay = time.Millisecond
+	n.Notify(notify.Event{Type: notify.EventFailed})
+	n.Close()
+	assert.Equal(t, 3, sender.attempts)
+	assert.Len(t, sender.events, 1)
+
+	sender = &fakeSender{failures: 5}
+	n = notify.New(sender)
+	n.Retries = 1
+	n.RetryDelay = time.Millisecond
+	n.Notify(notify.Event{Type: notify.EventFailed})
+	n.Close()
+	assert.Equal(t, 2, sender.attempts)
+	assert.Empty(t, sender.events)
+}
+
+func TestParseEventType(t *testing.T) {
+	e, err := notify.ParseEventType("degraded")
+	assert.NoError(t, err)
+	assert.Equal(t, notify.EventDegraded, e)
+	_, err = notify.ParseEventType("exploded")
+	assert.Error(t, err)
+}
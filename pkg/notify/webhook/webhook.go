@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+)
+
+// Request headers of the webhook
+const (
+	EventHeader     = "X-CRHK-Event"
+	SignatureHeader = "X-CRHK-Signature"
+)
+
+// Webhook posts the events as JSON to a URL
+type Webhook struct {
+	URL    string
+	Secret string       // signs the payload with HMAC-SHA256 when set
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+// New creates a Webhook to the URL
+func New(url, secret string) *Webhook {
+	return &Webhook{URL: url, Secret: secret}
+}
+
+// Send posts the event
+// A response other than 2xx is an error.
+func (w *Webhook) Send(ctx context.Context, e notify.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(e.Type))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, payload))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: unsuccessful HTTP request. response code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign gives the signature header value of the payload
+// It is "sha256=" followed by the hex encoded HMAC-SHA256 of the payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/notify"
+	"github.com/antonyho/crhk-recorder/pkg/notify/webhook"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	var (
+		body      []byte
+		event     string
+		signature string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		event = r.Header.Get(webhook.EventHeader)
+		signature = r.Header.Get(webhook.SignatureHeader)
+	}))
+	defer server.Close()
+
+	w := webhook.New(server.URL, "secret")
+	err := w.Send(context.Background(), notify.Event{Type: notify.EventCompleted, Channel: "881", Bytes: 42})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "completed", event)
+	assert.Equal(t, webhook.Sign("secret", body), signature)
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "completed", payload["event"])
+	assert.Equal(t, "881", payload["channel"])
+	assert.Equal(t, float64(42), payload["bytes"])
+}
+
+func TestWebhook_Send_Unsigned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(webhook.SignatureHeader))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	err := webhook.New(server.URL, "").Send(context.Background(), notify.Event{Type: notify.EventFailed})
+	assert.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	// RFC 4231 test case 2
+	assert.Equal(t,
+		"sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		webhook.Sign("Jefe", []byte("what do ya want for nothing?")))
+}
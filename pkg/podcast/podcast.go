@@ -0,0 +1,151 @@
+package podcast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/encoder"
+)
+
+// ContentType of the RSS feed
+const ContentType = "application/rss+xml; charset=utf-8"
+
+// DateLayout of the episode titles
+const DateLayout = "2006-01-02"
+
+// ITunesNamespace is the XML namespace of the iTunes podcast tags
+const ITunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// RSS is an RSS 2.0 podcast feed
+type RSS struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	ITunes  string   `xml:"xmlns:itunes,attr"`
+	Channel Channel  `xml:"channel"`
+}
+
+// Channel of the feed
+type Channel struct {
+	Title         string `xml:"title"`
+	Link          string `xml:"link"`
+	Description   string `xml:"description"`
+	Language      string `xml:"language,omitempty"`
+	LastBuildDate string `xml:"lastBuildDate,omitempty"`
+	Author        string `xml:"itunes:author"`
+	Summary       string `xml:"itunes:summary"`
+	Explicit      string `xml:"itunes:explicit"`
+	Items         []Item `xml:"item"`
+}
+
+// Item is an episode of the feed
+type Item struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description"`
+	GUID        GUID      `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Enclosure   Enclosure `xml:"enclosure"`
+	Duration    string    `xml:"itunes:duration"`
+}
+
+// GUID identifies an episode
+type GUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Enclosure is the audio file of an episode
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// New creates the feed of the recordings
+// enclosureURL gives the absolute URL of the audio file of a recording.
+// Recordings without media, and those in progress, are left out.
+func New(title, link string, entries []recording.Entry, enclosureURL func(recording.Entry) string) *RSS {
+	channel := Channel{
+		Title:       title,
+		Link:        link,
+		Description: fmt.Sprintf("Recordings of %s", title),
+		Language:    "zh-hk",
+		Author:      "crhk-recorder",
+		Summary:     fmt.Sprintf("Recordings of %s", title),
+		Explicit:    "false",
+	}
+
+	var lastBuild time.Time
+	for _, e := range entries {
+		if e.Bytes == 0 || e.Status == recording.StatusScheduled || e.Status == recording.StatusRecording {
+			continue
+		}
+		published := e.Started
+		if published.IsZero() {
+			published = e.ScheduledStart
+		}
+		if e.Stopped.After(lastBuild) {
+			lastBuild = e.Stopped
+		}
+		channel.Items = append(channel.Items, Item{
+			Title:       EpisodeTitle(e),
+			Description: description(e),
+			GUID:        GUID{Value: e.File},
+			PubDate:     published.Format(time.RFC1123Z),
+			Enclosure:   Enclosure{URL: enclosureURL(e), Length: size(e), Type: encoder.ContentType(e.File)},
+			Duration:    Duration(e.Duration),
+		})
+	}
+	if !lastBuild.IsZero() {
+		channel.LastBuildDate = lastBuild.Format(time.RFC1123Z)
+	}
+
+	return &RSS{Version: "2.0", ITunes: ITunesNamespace, Channel: channel}
+}
+
+// Write the feed as XML
+func (f *RSS) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(f)
+}
+
+// EpisodeTitle is the job name, or the channel of an ad-hoc recording,
+// followed by the date of the scheduled start
+func EpisodeTitle(e recording.Entry) string {
+	label := e.Job
+	if label == "" {
+		label = e.Channel
+	}
+	return fmt.Sprintf("%s %s", label, e.ScheduledStart.Format(DateLayout))
+}
+
+// Duration in the iTunes HH:MM:SS format
+func Duration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+func description(e recording.Entry) string {
+	desc := fmt.Sprintf("Channel %s recorded from %s to %s (%s).",
+		e.Channel, e.ScheduledStart.Format(time.RFC3339), e.ScheduledEnd.Format(time.RFC3339), e.Status)
+	if e.Gaps > 0 {
+		desc += fmt.Sprintf(" %d segments missing in %d gaps.", e.MissingSegments, e.Gaps)
+	}
+	return desc
+}
+
+// size of the media file, which differs from the recorded bytes
+// when the recording is replaced by an encoded file
+func size(e recording.Entry) int64 {
+	if info, err := os.Stat(e.Path); err == nil {
+		return info.Size()
+	}
+	return e.Bytes
+}
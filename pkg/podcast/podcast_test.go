@@ -0,0 +1,57 @@
+package podcast_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/podcast"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+func TestNew(t *testing.T) {
+	hk := time.FixedZone("HKT", 8*60*60)
+	start := time.Date(2021, time.January, 25, 7, 0, 0, 0, hk)
+	entries := []recording.Entry{
+		{Metadata: recording.Metadata{
+			Channel: "881", Job: "morning", File: "morning-2021-01-25-070000.aac",
+			ScheduledStart: start, ScheduledEnd: start.Add(2 * time.Hour), Started: start.Add(time.Second),
+			Stopped: start.Add(2 * time.Hour), Status: recording.StatusCompleted,
+			Bytes: 1024, Duration: 2*time.Hour - 10*time.Second, Gaps: 1, MissingSegments: 2,
+		}},
+		{Metadata: recording.Metadata{Channel: "881", File: "881-failed.aac", Status: recording.StatusFailed}},
+		{Metadata: recording.Metadata{Channel: "881", File: "881-now.aac", Status: recording.StatusRecording, Bytes: 10}},
+	}
+
+	feed := podcast.New("morning", "http://localhost:8080/", entries, func(e recording.Entry) string {
+		return "http://localhost:8080/api/recordings/files/" + e.File
+	})
+	if !assert.Len(t, feed.Channel.Items, 1) {
+		t.FailNow()
+	}
+	item := feed.Channel.Items[0]
+	assert.Equal(t, "morning 2021-01-25", item.Title)
+	assert.Equal(t, "Mon, 25 Jan 2021 07:00:01 +0800", item.PubDate)
+	assert.Equal(t, "01:59:50", item.Duration)
+	assert.Equal(t, podcast.Enclosure{
+		URL: "http://localhost:8080/api/recordings/files/morning-2021-01-25-070000.aac", Length: 1024, Type: "audio/aac",
+	}, item.Enclosure)
+	assert.Contains(t, item.Description, "2 segments missing in 1 gaps")
+
+	var buf bytes.Buffer
+	if assert.NoError(t, feed.Write(&buf)) {
+		var parsed podcast.RSS
+		assert.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+		assert.Contains(t, buf.String(), `<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`)
+		assert.Contains(t, buf.String(), `<itunes:duration>01:59:50</itunes:duration>`)
+		assert.Contains(t, buf.String(), `<guid isPermaLink="false">morning-2021-01-25-070000.aac</guid>`)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	assert.Equal(t, "00:00:00", podcast.Duration(0))
+	assert.Equal(t, "25:01:02", podcast.Duration(25*time.Hour+time.Minute+2*time.Second))
+}
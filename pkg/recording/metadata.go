@@ -0,0 +1,129 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SidecarExtension is the file extension of the metadata sidecar
+const SidecarExtension = ".json"
+
+// Status of a recording
+type Status string
+
+// Recording statuses
+const (
+	StatusScheduled   Status = "scheduled"
+	StatusRecording   Status = "recording"
+	StatusCompleted   Status = "completed"
+	StatusInterrupted Status = "interrupted"
+	StatusFailed      Status = "failed"
+)
+
+// Metadata of a recording which is kept in a sidecar file
+// next to the recorded media file
+type Metadata struct {
+	Channel         string        `json:"channel"`
+	Job             string        `json:"job,omitempty"` // name of the scheduled job
+	File            string        `json:"file"`          // media filename
+	ScheduledStart  time.Time     `json:"scheduled_start"`
+	ScheduledEnd    time.Time     `json:"scheduled_end"`
+	Started         time.Time     `json:"started"`
+	Stopped         time.Time     `json:"stopped"`
+	Status          Status        `json:"status"`
+	Segments        int           `json:"segments"`
+	Bytes           int64         `json:"bytes"`
+	Duration        time.Duration `json:"duration"`         // duration of the recorded segments
+	Gaps            int           `json:"gaps"`             // number of interruptions in the media sequence
+	MissingSegments int           `json:"missing_segments"` // number of segments lost in the gaps
+	Error           string        `json:"error,omitempty"`
+	Files           []string      `json:"files,omitempty"` // paths of the other files of the recording, e.g. encoded files and mirror copies
+}
+
+// SidecarPath returns the metadata sidecar path of a media file
+func SidecarPath(mediaPath string) string {
+	return strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath)) + SidecarExtension
+}
+
+// Finish sets the stop time and the final status by the recording error
+// A cancelled context means the recording was interrupted.
+func (m *Metadata) Finish(err error) {
+	m.Stopped = time.Now()
+	switch {
+	case err == nil:
+		m.Status = StatusCompleted
+		m.Error = ""
+	case errors.Is(err, context.Canceled):
+		m.Status = StatusInterrupted
+		m.Error = ""
+	default:
+		m.Status = StatusFailed
+		m.Error = err.Error()
+	}
+}
+
+// Save the metadata to the sidecar of the media file
+// The sidecar is replaced atomically, so readers never see a partial file.
+func (m *Metadata) Save(mediaPath string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	sidecarPath := SidecarPath(mediaPath)
+	tmpPath := sidecarPath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, sidecarPath)
+}
+
+// Load the metadata from the sidecar of the media file
+func Load(mediaPath string) (*Metadata, error) {
+	content, err := os.ReadFile(SidecarPath(mediaPath))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Metadata)
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Entry is a recording listed in a directory
+type Entry struct {
+	Metadata
+	Path string `json:"path"` // media file path
+}
+
+// List the recordings of the sidecars in the directory
+// The recordings are sorted by the scheduled start, latest first.
+// A missing directory has no recording.
+func List(dir string) ([]Entry, error) {
+	sidecars, err := filepath.Glob(filepath.Join(dir, "*"+SidecarExtension))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, sidecar := range sidecars {
+		content, err := os.ReadFile(sidecar)
+		if err != nil {
+			return nil, err
+		}
+		var m Metadata
+		if err := json.Unmarshal(content, &m); err != nil || m.File == "" {
+			continue // not a recording sidecar
+		}
+		entries = append(entries, Entry{Metadata: m, Path: filepath.Join(dir, m.File)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ScheduledStart.After(entries[j].ScheduledStart)
+	})
+	return entries, nil
+}
@@ -0,0 +1,80 @@
+package recording_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+func TestSidecarPath(t *testing.T) {
+	assert.Equal(t, "/tmp/881-2021-01-24-150405.json", recording.SidecarPath("/tmp/881-2021-01-24-150405.aac"))
+}
+
+func TestMetadata_Finish(t *testing.T) {
+	m := new(recording.Metadata)
+	m.Finish(nil)
+	assert.Equal(t, recording.StatusCompleted, m.Status)
+	assert.False(t, m.Stopped.IsZero())
+
+	m.Finish(fmt.Errorf("stopped: %w", context.Canceled))
+	assert.Equal(t, recording.StatusInterrupted, m.Status)
+
+	m.Finish(errors.New("empty media file"))
+	assert.Equal(t, recording.StatusFailed, m.Status)
+	assert.Equal(t, "empty media file", m.Error)
+}
+
+func TestMetadata_Save(t *testing.T) {
+	mediaPath := filepath.Join(t.TempDir(), "881-2021-01-24-150405.aac")
+	start := time.Date(2021, time.January, 24, 15, 4, 5, 0, time.UTC)
+	m := &recording.Metadata{
+		Channel:        "881",
+		File:           filepath.Base(mediaPath),
+		ScheduledStart: start,
+		ScheduledEnd:   start.Add(time.Hour),
+		Status:         recording.StatusRecording,
+		Segments:       3,
+		Bytes:          1024,
+	}
+	if err := m.Save(mediaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := recording.Load(mediaPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, m.Channel, loaded.Channel)
+		assert.True(t, m.ScheduledStart.Equal(loaded.ScheduledStart))
+		assert.Equal(t, recording.StatusRecording, loaded.Status)
+		assert.EqualValues(t, 1024, loaded.Bytes)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2021, time.January, 24, 15, 4, 5, 0, time.UTC)
+	for i, status := range []recording.Status{recording.StatusCompleted, recording.StatusFailed} {
+		scheduled := start.Add(time.Duration(i) * time.Hour)
+		file := fmt.Sprintf("881-%d.aac", i)
+		m := recording.Metadata{Channel: "881", File: file, ScheduledStart: scheduled, Status: status}
+		if err := m.Save(filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := recording.List(dir)
+	if assert.NoError(t, err) && assert.Len(t, entries, 2) {
+		assert.Equal(t, recording.StatusFailed, entries[0].Status, "latest recording shall be first")
+		assert.Equal(t, filepath.Join(dir, "881-0.aac"), entries[1].Path)
+	}
+
+	entries, err = recording.List(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,29 @@
+package recording
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	channelPattern = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	namePattern    = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z_-]*$`)
+)
+
+// ValidateChannel checks that the channel is alphanumeric
+// The channel names the recording files and directories.
+func ValidateChannel(channel string) error {
+	if !channelPattern.MatchString(channel) {
+		return fmt.Errorf("channel [%s] must be alphanumeric", channel)
+	}
+	return nil
+}
+
+// ValidateName checks that the job name or file prefix is alphanumeric
+// with dashes and underscores, so it stays within the output directory
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("name [%s] must be alphanumeric with dashes and underscores", name)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package recording
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateChannel(t *testing.T) {
+	assert.NoError(t, ValidateChannel("881"))
+	assert.NoError(t, ValidateChannel("bbc1"))
+	for _, channel := range []string{"", "../../etc/x", "881/903", "881 903", ".."} {
+		assert.Error(t, ValidateChannel(channel), channel)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("mid-month"))
+	assert.NoError(t, ValidateName("adhoc-881-20240101-070000"))
+	for _, name := range []string{"", "..", "-rf", "a/b", "a\nb"} {
+		assert.Error(t, ValidateName(name), name)
+	}
+}
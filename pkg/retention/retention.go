@@ -0,0 +1,137 @@
+package retention
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// Day is the unit of Policy.KeepDays
+const Day = 24 * time.Hour
+
+// StaleGrace is how long after the scheduled end a recording still in
+// progress is kept, e.g. one left behind by a crash is removable afterwards
+const StaleGrace = time.Hour
+
+// Policy limits the recordings of a channel or a job
+// The recordings beyond any of the limits are removed, oldest first.
+// A zero limit is unlimited.
+type Policy struct {
+	Channel  string // recordings of the channel, every channel when empty
+	Job      string // recordings of the job, every job when empty
+	KeepDays int    // remove the recordings started more than the days ago
+	KeepLast int    // keep the latest recordings
+	MaxSize  int64  // maximum total size in bytes
+}
+
+// Matches reports whether the recording is limited by the policy
+func (p Policy) Matches(e recording.Entry) bool {
+	return (p.Channel == "" || p.Channel == e.Channel) && (p.Job == "" || p.Job == e.Job)
+}
+
+// Expired returns the recordings beyond the limits of the policy
+// The recordings in progress are never expired, unless they are stale
+// for StaleGrace after their scheduled end.
+func (p Policy) Expired(entries []recording.Entry, now time.Time) []recording.Entry {
+	var matched []recording.Entry
+	for _, e := range entries {
+		if p.Matches(e) && !inProgress(e, now) {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return started(matched[i]).After(started(matched[j]))
+	})
+
+	var expired []recording.Entry
+	var total int64
+	for i, e := range matched {
+		total += Size(e)
+		switch {
+		case p.KeepDays > 0 && now.Sub(started(e)) > time.Duration(p.KeepDays)*Day,
+			p.KeepLast > 0 && i >= p.KeepLast,
+			p.MaxSize > 0 && total > p.MaxSize:
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+// Report of enforcing the policies
+type Report struct {
+	DryRun  bool              `json:"dry_run"`
+	Removed []recording.Entry `json:"removed"` // recordings removed, or to be removed on a dry run
+	Bytes   int64             `json:"bytes"`   // total size of the removed recordings
+}
+
+// Enforce the policies on the recordings
+// A dry run only reports the recordings which would be removed.
+func Enforce(entries []recording.Entry, policies []Policy, now time.Time, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, Removed: []recording.Entry{}}
+	removed := make(map[string]bool)
+	for _, p := range policies {
+		for _, e := range p.Expired(entries, now) {
+			if removed[e.Path] {
+				continue
+			}
+			removed[e.Path] = true
+			report.Removed = append(report.Removed, e)
+			report.Bytes += Size(e)
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+	var errs []error
+	for _, e := range report.Removed {
+		errs = append(errs, Remove(e))
+	}
+	return report, errors.Join(errs...)
+}
+
+// Remove the media file, the other files and the sidecar of the recording
+func Remove(e recording.Entry) error {
+	var errs []error
+	paths := append([]string{e.Path}, e.Files...)
+	for _, path := range append(paths, recording.SidecarPath(e.Path)) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Size of the media file, or the recorded bytes when the file is missing,
+// and the other files of the recording
+func Size(e recording.Entry) int64 {
+	size := e.Bytes
+	if info, err := os.Stat(e.Path); err == nil {
+		size = info.Size()
+	}
+	for _, path := range e.Files {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// inProgress reports whether the recording is scheduled or recording
+// and not yet past the grace after its scheduled end
+func inProgress(e recording.Entry, now time.Time) bool {
+	if e.Status != recording.StatusScheduled && e.Status != recording.StatusRecording {
+		return false
+	}
+	return e.ScheduledEnd.IsZero() || now.Before(e.ScheduledEnd.Add(StaleGrace))
+}
+
+// started is the start of the recording, or the scheduled start before it started
+func started(e recording.Entry) time.Time {
+	if e.Started.IsZero() {
+		return e.ScheduledStart
+	}
+	return e.Started
+}
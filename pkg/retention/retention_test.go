@@ -0,0 +1,113 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+)
+
+// entry saves a recording of the size started days ago
+func entry(t *testing.T, dir, channel, job string, daysAgo, size int, status recording.Status) recording.Entry {
+	started := time.Now().Add(-time.Duration(daysAgo) * Day)
+	path := filepath.Join(dir, channel+"-"+started.Format("2006-01-02-150405")+".aac")
+	m := recording.Metadata{
+		Channel: channel, Job: job, File: filepath.Base(path),
+		ScheduledStart: started, Started: started, Status: status, Bytes: int64(size),
+	}
+	assert.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+	assert.NoError(t, m.Save(path))
+	return recording.Entry{Metadata: m, Path: path}
+}
+
+func files(e []recording.Entry) []string {
+	var names []string
+	for _, r := range e {
+		names = append(names, r.File)
+	}
+	return names
+}
+
+func TestPolicy_Expired(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	e1 := entry(t, dir, "881", "morning", 1, 100, recording.StatusCompleted)
+	e2 := entry(t, dir, "881", "morning", 3, 100, recording.StatusCompleted)
+	e3 := entry(t, dir, "881", "", 5, 100, recording.StatusFailed)
+	e4 := entry(t, dir, "903", "", 10, 100, recording.StatusCompleted)
+	recordingNow := entry(t, dir, "881", "morning", 20, 100, recording.StatusRecording)
+	entries := []recording.Entry{e1, e2, e3, e4, recordingNow}
+
+	assert.Empty(t, Policy{}.Expired(entries, now))
+	assert.Equal(t, files([]recording.Entry{e3, e4}), files(Policy{KeepDays: 4}.Expired(entries, now)))
+	assert.Equal(t, files([]recording.Entry{e3}), files(Policy{Channel: "881", KeepLast: 2}.Expired(entries, now)))
+	assert.Equal(t, files([]recording.Entry{e2}), files(Policy{Job: "morning", KeepLast: 1}.Expired(entries, now)))
+	assert.Equal(t, files([]recording.Entry{e3, e4}), files(Policy{MaxSize: 250}.Expired(entries, now)))
+}
+
+func TestPolicy_Expired_Stale(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	crashed := entry(t, dir, "881", "morning", 2, 100, recording.StatusRecording)
+	crashed.ScheduledEnd = crashed.Started.Add(time.Hour)
+	ending := entry(t, dir, "903", "night", 2, 100, recording.StatusRecording)
+	ending.ScheduledEnd = now.Add(-time.Minute)
+
+	assert.Equal(t, files([]recording.Entry{crashed}), files(Policy{KeepDays: 1}.Expired([]recording.Entry{crashed, ending}, now)),
+		"recording shall be stale after the grace of its scheduled end")
+}
+
+func TestEnforce(t *testing.T) {
+	dir := t.TempDir()
+	e1 := entry(t, dir, "881", "", 1, 100, recording.StatusCompleted)
+	e2 := entry(t, dir, "881", "", 3, 100, recording.StatusCompleted)
+	e3 := entry(t, dir, "903", "", 5, 100, recording.StatusCompleted)
+	entries := []recording.Entry{e1, e2, e3}
+	policies := []Policy{{KeepDays: 2}, {Channel: "881", KeepLast: 1}}
+
+	report, err := Enforce(entries, policies, time.Now(), true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, files([]recording.Entry{e2, e3}), files(report.Removed))
+	assert.Equal(t, int64(200), report.Bytes)
+	listed, err := recording.List(dir)
+	assert.NoError(t, err)
+	assert.Len(t, listed, 3, "dry run shall remove nothing")
+
+	report, err = Enforce(entries, policies, time.Now(), false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Removed, 2)
+	listed, err = recording.List(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, files([]recording.Entry{e1}), files(listed))
+	assert.NoFileExists(t, e2.Path)
+	assert.NoFileExists(t, recording.SidecarPath(e3.Path))
+}
+
+func TestEnforce_Files(t *testing.T) {
+	dir, mirror := t.TempDir(), t.TempDir()
+	e := entry(t, dir, "881", "", 5, 100, recording.StatusCompleted)
+	encoded := e.Path[:len(e.Path)-len(".aac")] + ".mp3"
+	copied := filepath.Join(mirror, e.File)
+	assert.NoError(t, os.WriteFile(encoded, make([]byte, 50), 0644))
+	assert.NoError(t, os.WriteFile(copied, make([]byte, 100), 0644))
+	e.Files = []string{encoded, copied}
+	assert.NoError(t, e.Save(e.Path))
+	listed, err := recording.List(dir)
+	if !assert.NoError(t, err) || !assert.Len(t, listed, 1) {
+		return
+	}
+
+	assert.Empty(t, Policy{MaxSize: 250}.Expired(listed, time.Now()))
+	assert.Len(t, Policy{MaxSize: 200}.Expired(listed, time.Now()), 1, "other files shall count in the size")
+	report, err := Enforce(listed, []Policy{{KeepDays: 2}}, time.Now(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(250), report.Bytes)
+	assert.NoFileExists(t, e.Path)
+	assert.NoFileExists(t, encoded)
+	assert.NoFileExists(t, copied)
+}
@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ClockLayout is the time of day format accepted by ParseClock
+	ClockLayout = "15:04:05"
+
+	// ShortClockLayout is the time of day format without seconds
+	ShortClockLayout = "15:04"
+
+	// OffsetClockLayout is the legacy time of day format with a fixed timezone offset
+	OffsetClockLayout = "15:04:05 -0700"
+)
+
+// Clock is a wall clock time of day
+type Clock struct {
+	Hour   int
+	Minute int
+	Second int
+}
+
+// ParseClock parses a time of day in "15:04:05" or "15:04" format.
+// The legacy "15:04:05 -0700" format is still accepted, in which case
+// the fixed offset is returned as the location. Otherwise the returned
+// location is nil and the caller decides which timezone applies.
+func ParseClock(value string) (Clock, *time.Location, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(OffsetClockLayout, value); err == nil {
+		_, offset := t.Zone()
+		return clockOf(t), time.FixedZone(t.Format("-0700"), offset), nil
+	}
+	for _, layout := range []string{ClockLayout, ShortClockLayout} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return clockOf(t), nil, nil
+		}
+	}
+	return Clock{}, nil, fmt.Errorf("incorrect time of day [%s]", value)
+}
+
+func clockOf(t time.Time) Clock {
+	return Clock{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second()}
+}
+
+// On returns the clock time on the given date in the given location
+func (c Clock) On(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, c.Hour, c.Minute, c.Second, 0, loc)
+}
+
+// Add a duration to the clock, wrapping around midnight
+func (c Clock) Add(d time.Duration) Clock {
+	return clockOf(c.On(2000, time.January, 1, time.UTC).Add(d))
+}
+
+// Before reports whether the clock is earlier in the day than u
+func (c Clock) Before(u Clock) bool {
+	return c.seconds() < u.seconds()
+}
+
+func (c Clock) seconds() int {
+	return c.Hour*3600 + c.Minute*60 + c.Second
+}
+
+// String formats the clock in "15:04:05" format
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", c.Hour, c.Minute, c.Second)
+}
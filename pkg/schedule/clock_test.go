@@ -0,0 +1,42 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+)
+
+func TestParseClock(t *testing.T) {
+	c, loc, err := schedule.ParseClock("23:06:00")
+	if assert.NoError(t, err) {
+		assert.Equal(t, schedule.Clock{Hour: 23, Minute: 6}, c)
+		assert.Nil(t, loc)
+	}
+
+	c, loc, err = schedule.ParseClock("07:30")
+	if assert.NoError(t, err) {
+		assert.Equal(t, schedule.Clock{Hour: 7, Minute: 30}, c)
+		assert.Nil(t, loc)
+	}
+
+	c, loc, err = schedule.ParseClock("23:06:00 +0800")
+	if assert.NoError(t, err) {
+		assert.Equal(t, schedule.Clock{Hour: 23, Minute: 6}, c)
+		if assert.NotNil(t, loc) {
+			_, offset := time.Date(2021, time.January, 1, 0, 0, 0, 0, loc).Zone()
+			assert.Equal(t, 8*60*60, offset)
+		}
+	}
+
+	_, _, err = schedule.ParseClock("25:00:00")
+	assert.Error(t, err)
+}
+
+func TestClock_Add(t *testing.T) {
+	c := schedule.Clock{Hour: 23, Minute: 30}
+	assert.Equal(t, schedule.Clock{Hour: 1, Minute: 30}, c.Add(2*time.Hour))
+	assert.Equal(t, "01:30:00", c.Add(2*time.Hour).String())
+}
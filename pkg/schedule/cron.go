@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard five fields cron expressions and
+// six fields expressions with a leading seconds field
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Cron is a recording schedule starting on every activation of a cron
+// expression and lasting for a fixed duration
+type Cron struct {
+	Expression string
+	Duration   time.Duration
+	Location   *time.Location
+	spec       cron.Schedule
+}
+
+// NewCron creates a Cron schedule from a five or six fields cron expression
+// The expression is evaluated in loc (e.g. "0 7 * * 1-5" with 2h duration)
+func NewCron(expression string, duration time.Duration, loc *time.Location) (*Cron, error) {
+	if duration <= 0 {
+		return nil, errors.New("cron schedule requires a positive duration")
+	}
+	spec, err := cronParser.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cron{
+		Expression: expression,
+		Duration:   duration,
+		Location:   loc,
+		spec:       spec,
+	}
+	// An expression of an impossible date, e.g. "0 0 30 2 *", never activates
+	if start, _ := c.Next(time.Now()); start.IsZero() {
+		return nil, fmt.Errorf("cron expression [%s]: %w", expression, ErrNoOccurrence)
+	}
+	return c, nil
+}
+
+// Next returns the first activation of the cron expression
+// starting no earlier than the given time
+// Zero times are returned when the expression does not activate again.
+func (c *Cron) Next(after time.Time) (start, end time.Time) {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	// The cron activation is strictly after the given time
+	start = c.spec.Next(after.In(loc).Add(-time.Nanosecond))
+	if start.IsZero() {
+		return time.Time{}, time.Time{}
+	}
+	end = start.Add(c.Duration)
+	return
+}
@@ -0,0 +1,61 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+)
+
+func TestNewCron(t *testing.T) {
+	_, err := schedule.NewCron("0 7 * * 1-5", 2*time.Hour, nil)
+	assert.NoError(t, err)
+
+	_, err = schedule.NewCron("30 0 7 * * 1-5", 2*time.Hour, nil)
+	assert.NoError(t, err)
+
+	_, err = schedule.NewCron("0 7 * * 1-5", 0, nil)
+	assert.Error(t, err)
+
+	_, err = schedule.NewCron("0 7 * *", time.Hour, nil)
+	assert.Error(t, err)
+
+	// February never has a 30th
+	_, err = schedule.NewCron("0 0 30 2 *", time.Hour, nil)
+	assert.ErrorIs(t, err, schedule.ErrNoOccurrence)
+}
+
+func TestCron_Next(t *testing.T) {
+	hk, err := schedule.LoadLocation(schedule.DefaultTimezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := schedule.NewCron("0 7 * * 1-5", 2*time.Hour, hk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2021-01-22 is a Friday, the next weekday is Monday
+	start, end := c.Next(time.Date(2021, time.January, 22, 8, 0, 0, 0, hk))
+	assert.True(t, time.Date(2021, time.January, 25, 7, 0, 0, 0, hk).Equal(start))
+	assert.True(t, time.Date(2021, time.January, 25, 9, 0, 0, 0, hk).Equal(end))
+
+	// An activation at the given time is included
+	start, _ = c.Next(time.Date(2021, time.January, 25, 7, 0, 0, 0, hk))
+	assert.True(t, time.Date(2021, time.January, 25, 7, 0, 0, 0, hk).Equal(start))
+}
+
+func TestCron_Next_DayOfMonth(t *testing.T) {
+	c, err := schedule.NewCron("0 12,20 15 * *", time.Hour, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start, _ := c.Next(time.Date(2021, time.January, 15, 13, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2021, time.January, 15, 20, 0, 0, 0, time.UTC).Equal(start))
+
+	start, _ = c.Next(start.Add(time.Hour))
+	assert.True(t, time.Date(2021, time.February, 15, 12, 0, 0, 0, time.UTC).Equal(start))
+}
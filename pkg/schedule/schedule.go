@@ -0,0 +1,17 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoOccurrence is the error of a schedule without further occurrences
+var ErrNoOccurrence = errors.New("schedule has no further occurrence")
+
+// Schedule provides the occurrences of a recording
+type Schedule interface {
+	// Next returns the start and end time of the first occurrence
+	// starting no earlier than the given time
+	// Zero times are returned when there is no further occurrence.
+	Next(after time.Time) (start, end time.Time)
+}
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+
+	dow "github.com/antonyho/crhk-recorder/pkg/dayofweek"
+)
+
+const (
+	// DefaultTimezone is the timezone of the CRHK radio station
+	DefaultTimezone = "Asia/Hong_Kong"
+
+	// TimeLayout is the layout for logging a scheduled time with its timezone
+	TimeLayout = "2006-01-02 15:04:05 MST"
+)
+
+// LoadLocation loads the IANA timezone with the given name
+// The station timezone is used when the name is empty
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	return time.LoadLocation(name)
+}
+
+// Window is a daily recording window in a timezone
+type Window struct {
+	Start    Clock
+	End      Clock
+	Weekdays dow.Bitmask // no day enabled means everyday
+	Location *time.Location
+}
+
+// ErrEmptyWindow is the error of a window ending at its start time
+var ErrEmptyWindow = errors.New("recording window ends at its start time")
+
+// NewWindow creates a daily Window from start and end time of day strings
+// loc is used unless the time of day carries a legacy timezone offset
+// A window cannot end at its start time, so it is shorter than a day.
+func NewWindow(startTime, endTime string, weekdays dow.Bitmask, loc *time.Location) (Window, error) {
+	start, startLoc, err := ParseClock(startTime)
+	if err != nil {
+		return Window{}, err
+	}
+	end, endLoc, err := ParseClock(endTime)
+	if err != nil {
+		return Window{}, err
+	}
+	if start == end {
+		return Window{}, ErrEmptyWindow
+	}
+	if startLoc != nil {
+		loc = startLoc
+	} else if endLoc != nil {
+		loc = endLoc
+	}
+	return Window{Start: start, End: end, Weekdays: weekdays, Location: loc}, nil
+}
+
+func (w Window) location() *time.Location {
+	if w.Location == nil {
+		return time.UTC
+	}
+	return w.Location
+}
+
+// Next returns the first occurrence of the window starting no earlier than
+// the given time. Dates and weekdays are evaluated in the window timezone,
+// so occurrences keep their wall clock time across DST changes.
+// An end time before the start time ends on the following day.
+func (w Window) Next(after time.Time) (start, end time.Time) {
+	loc := w.location()
+	year, month, day := after.In(loc).Date()
+	for i := 0; ; i++ {
+		start = w.Start.On(year, month, day+i, loc)
+		if start.Before(after) {
+			continue
+		}
+		if !w.Weekdays.AllEnabled() && !w.Weekdays.Enabled(start.Weekday()) {
+			continue
+		}
+		endDay := day + i
+		if !w.Start.Before(w.End) { // To cover an overnight recording
+			endDay++
+		}
+		end = w.End.On(year, month, endDay, loc)
+		return
+	}
+}
@@ -0,0 +1,73 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/dayofweek"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+)
+
+func TestLoadLocation(t *testing.T) {
+	loc, err := schedule.LoadLocation("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, schedule.DefaultTimezone, loc.String())
+	}
+
+	_, err = schedule.LoadLocation("Mars/Olympus_Mons")
+	assert.Error(t, err)
+}
+
+func TestNewWindow_Empty(t *testing.T) {
+	_, err := schedule.NewWindow("07:00", "07:00:00", *dayofweek.New(), nil)
+	assert.ErrorIs(t, err, schedule.ErrEmptyWindow)
+}
+
+func TestWindow_Next(t *testing.T) {
+	hk, err := schedule.LoadLocation(schedule.DefaultTimezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := schedule.NewWindow("23:00:00", "01:00:00", *dayofweek.New(), hk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2021-01-24 16:00 UTC is 2021-01-25 00:00 in Hong Kong
+	now := time.Date(2021, time.January, 24, 16, 0, 0, 0, time.UTC)
+	start, end := w.Next(now)
+	assert.Equal(t, time.Date(2021, time.January, 25, 23, 0, 0, 0, hk), start)
+	assert.Equal(t, time.Date(2021, time.January, 26, 1, 0, 0, 0, hk), end)
+}
+
+func TestWindow_Next_DayOfWeek(t *testing.T) {
+	mask := dayofweek.New()
+	mask.Enable(time.Tuesday)
+	w, err := schedule.NewWindow("15:04:10 +0000", "15:04:35 +0000", *mask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, time.January, 24, 15, 4, 5, 0, time.UTC) // Sunday
+	start, end := w.Next(now)
+	assert.True(t, time.Date(2021, time.January, 26, 15, 4, 10, 0, time.UTC).Equal(start))
+	assert.True(t, time.Date(2021, time.January, 26, 15, 4, 35, 0, time.UTC).Equal(end))
+}
+
+func TestWindow_Next_DST(t *testing.T) {
+	london, err := schedule.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := schedule.NewWindow("07:00", "09:00", *dayofweek.New(), london)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clocks go forward on 2021-03-28 in London
+	start, end := w.Next(time.Date(2021, time.March, 27, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2021, time.March, 28, 6, 0, 0, 0, time.UTC), start.UTC())
+	assert.Equal(t, 2*time.Hour, end.Sub(start))
+}
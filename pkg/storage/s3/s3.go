@@ -0,0 +1,289 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/encoder"
+)
+
+// Defaults of the uploads
+const (
+	DefaultKeyTemplate = `{{.Channel}}/{{.ScheduledStart.Format "2006/01/02"}}/{{.Name}}`
+	DefaultRegion      = "us-east-1"
+	DefaultPartSize    = 16 << 20 // size of the multipart upload parts
+	MinPartSize        = 5 << 20  // the smallest part size allowed by S3
+)
+
+// ErrChecksumMismatch is the error of an uploaded object which differs from the local file
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Config of an S3-compatible bucket
+type Config struct {
+	Endpoint     string // host[:port] of the S3 API
+	Insecure     bool   // plain HTTP instead of HTTPS
+	Region       string // defaults to DefaultRegion
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	KeyTemplate  string // object key template of KeyData, defaults to DefaultKeyTemplate
+	StorageClass string // e.g. STANDARD_IA or GLACIER, the bucket default when empty
+	PartSize     uint64 // defaults to DefaultPartSize
+	DeleteLocal  bool   // delete the local files after a verified upload
+}
+
+// KeyData is the data of the object key template
+// It has the recording metadata, and the Name of the uploaded file,
+// which is either the media file or the sidecar.
+type KeyData struct {
+	recording.Metadata
+	Name string
+}
+
+// Object is an uploaded file
+type Object struct {
+	Key  string
+	Path string
+	Size int64
+	ETag string
+}
+
+// Uploader uploads the recordings to an S3-compatible bucket
+type Uploader struct {
+	Bucket       string
+	StorageClass string
+	PartSize     uint64
+	DeleteLocal  bool
+	Logger       *slog.Logger // defaults to slog.Default()
+
+	client *minio.Client
+	key    *template.Template
+}
+
+// New creates the Uploader of the bucket
+func New(cfg Config) (*Uploader, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket must be provided")
+	}
+	key, err := template.New("key").Parse(firstNonEmpty(cfg.KeyTemplate, DefaultKeyTemplate))
+	if err != nil {
+		return nil, fmt.Errorf("s3 key template: %w", err)
+	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	} else if partSize < MinPartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", MinPartSize)
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.Insecure,
+		Region: firstNonEmpty(cfg.Region, DefaultRegion),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Uploader{
+		Bucket:       cfg.Bucket,
+		StorageClass: cfg.StorageClass,
+		PartSize:     partSize,
+		DeleteLocal:  cfg.DeleteLocal,
+		client:       client,
+		key:          key,
+	}, nil
+}
+
+// Key of the object of a file of the recording
+func (u *Uploader) Key(meta recording.Metadata, name string) (string, error) {
+	var b strings.Builder
+	if err := u.key.Execute(&b, KeyData{Metadata: meta, Name: name}); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(b.String(), "/"), nil
+}
+
+// Upload the media file and the sidecar of the recording
+// Every object is verified against the local file. The local files
+// are deleted afterwards when DeleteLocal is set.
+func (u *Uploader) Upload(ctx context.Context, mediaPath string) ([]Object, error) {
+	meta, err := recording.Load(mediaPath)
+	if err != nil {
+		return nil, err
+	}
+	if meta.File != "" {
+		// the recording file may be replaced, e.g. by an encoded file
+		mediaPath = filepath.Join(filepath.Dir(mediaPath), meta.File)
+	}
+	var objects []Object
+	for _, path := range []string{mediaPath, recording.SidecarPath(mediaPath)} {
+		key, err := u.Key(*meta, filepath.Base(path))
+		if err != nil {
+			return objects, err
+		}
+		object, err := u.uploadFile(ctx, key, path)
+		if err != nil {
+			return objects, fmt.Errorf("uploading [%s]: %w", path, err)
+		}
+		u.logger().Info("Recording uploaded", logging.KeyFile, path, "bucket", u.Bucket, "key", key, "bytes", object.Size)
+		objects = append(objects, object)
+	}
+
+	if u.DeleteLocal {
+		for _, object := range objects {
+			if err := os.Remove(object.Path); err != nil {
+				return objects, err
+			}
+		}
+	}
+	return objects, nil
+}
+
+// uploadFile uploads a file in parts, each verified with Content-MD5,
+// and verifies the object size and ETag. An identical object, e.g.
+// streamed while recording, is not uploaded again.
+func (u *Uploader) uploadFile(ctx context.Context, key, path string) (Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Object{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return Object{}, err
+	}
+	expected, err := ETag(file, info.Size(), u.PartSize)
+	if err != nil {
+		return Object{}, err
+	}
+	if stat, err := u.client.StatObject(ctx, u.Bucket, key, minio.StatObjectOptions{}); err == nil &&
+		stat.Size == info.Size() && strings.Trim(stat.ETag, `"`) == expected {
+		return Object{Key: key, Path: path, Size: stat.Size, ETag: expected}, nil // streamed while recording
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Object{}, err
+	}
+
+	_, err = u.client.PutObject(ctx, u.Bucket, key, file, info.Size(), minio.PutObjectOptions{
+		ContentType:    contentType(path),
+		StorageClass:   u.StorageClass,
+		PartSize:       u.PartSize,
+		SendContentMd5: true,
+	})
+	if err != nil {
+		return Object{}, err
+	}
+	stat, err := u.client.StatObject(ctx, u.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, err
+	}
+	etag := strings.Trim(stat.ETag, `"`)
+	if stat.Size != info.Size() || etag != expected {
+		return Object{}, fmt.Errorf("%w: object %s of %d bytes, file %s of %d bytes",
+			ErrChecksumMismatch, etag, stat.Size, expected, info.Size())
+	}
+	return Object{Key: key, Path: path, Size: stat.Size, ETag: etag}, nil
+}
+
+func (u *Uploader) logger() *slog.Logger {
+	if u.Logger == nil {
+		return slog.Default()
+	}
+	return u.Logger
+}
+
+// ETag is the S3 ETag of the content uploaded in parts of the part size
+// It is the MD5 of a single part upload, or the MD5 of the part MD5s
+// followed by the number of parts.
+func ETag(r io.Reader, size int64, partSize uint64) (string, error) {
+	if size <= int64(partSize) {
+		h := md5.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	_, partLength, _, err := minio.OptimalPartInfo(size, partSize)
+	if err != nil {
+		return "", err
+	}
+	h := newPartHash(partLength)
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return h.ETag(), nil
+}
+
+// partHash computes the ETag of a multipart upload while it is written
+type partHash struct {
+	partSize int64
+	part     hash.Hash // MD5 of the current part
+	length   int64     // length of the current part
+	sums     hash.Hash // MD5 of the part MD5s
+	parts    int       // number of the completed parts
+}
+
+func newPartHash(partSize int64) *partHash {
+	return &partHash{partSize: partSize, part: md5.New(), sums: md5.New()}
+}
+
+// Write the content of the parts
+func (h *partHash) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if h.length == h.partSize {
+			h.complete()
+		}
+		chunk := min(int64(len(p)), h.partSize-h.length)
+		h.part.Write(p[:chunk])
+		h.length += chunk
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+func (h *partHash) complete() {
+	h.sums.Write(h.part.Sum(nil))
+	h.parts++
+	h.part.Reset()
+	h.length = 0
+}
+
+// ETag of the parts written so far
+// An empty content is uploaded as a single empty part.
+func (h *partHash) ETag() string {
+	if h.length > 0 || h.parts == 0 {
+		h.complete()
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(h.sums.Sum(nil)), h.parts)
+}
+
+func contentType(path string) string {
+	if filepath.Ext(path) == recording.SidecarExtension {
+		return "application/json"
+	}
+	return encoder.ContentType(path)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,354 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+type object struct {
+	data         []byte
+	etag         string
+	storageClass string
+}
+
+// fakeS3 is a MinIO-style stand-in serving the object and multipart
+// upload requests of a bucket. Every part is verified with Content-MD5.
+type fakeS3 struct {
+	mu       sync.Mutex
+	bucket   string
+	objects  map[string]object
+	uploads  map[string]map[int][]byte
+	classes  map[string]string // storage classes of the multipart uploads
+	parts    int               // number of uploaded parts
+	tamper   bool              // corrupt the stored objects
+	uploadID int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: make(map[string]object), uploads: make(map[string]map[int][]byte), classes: make(map[string]string)}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, found := strings.CutPrefix(r.URL.Path, "/"+s.bucket+"/")
+	if !found {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.uploadID++
+		id := strconv.Itoa(s.uploadID)
+		s.uploads[id] = make(map[int][]byte)
+		s.classes[id] = r.Header.Get("X-Amz-Storage-Class")
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: s.bucket, Key: key, UploadID: id})
+
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		data, ok := readVerified(w, r)
+		if !ok {
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")][n] = data
+		s.parts++
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := s.uploads[query.Get("uploadId")]
+		var content []byte
+		sums := md5.New()
+		for n := 1; n <= len(parts); n++ {
+			content = append(content, parts[n]...)
+			sum := md5.Sum(parts[n])
+			sums.Write(sum[:])
+		}
+		etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(parts))
+		s.store(key, content, etag, s.classes[query.Get("uploadId")])
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: s.bucket, Key: key, ETag: `"` + etag + `"`})
+
+	case r.Method == http.MethodPut:
+		data, ok := readVerified(w, r)
+		if !ok {
+			return
+		}
+		sum := md5.Sum(data)
+		etag := hex.EncodeToString(sum[:])
+		s.store(key, data, etag, r.Header.Get("X-Amz-Storage-Class"))
+		w.Header().Set("ETag", `"`+etag+`"`)
+
+	case r.Method == http.MethodHead:
+		o, found := s.objects[key]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		w.Header().Set("ETag", `"`+o.etag+`"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("X-Amz-Storage-Class", o.storageClass)
+
+	default:
+		http.Error(w, "NotImplemented", http.StatusNotImplemented)
+	}
+}
+
+// store the object, s.mu must be held
+func (s *fakeS3) store(key string, data []byte, etag, storageClass string) {
+	if s.tamper {
+		data = append(data, 0)
+		etag = "tampered"
+	}
+	s.objects[key] = object{data: data, etag: etag, storageClass: storageClass}
+}
+
+// readVerified reads the request body verified with its Content-MD5
+func readVerified(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		data, err = decodeChunked(data)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	sum := md5.Sum(data)
+	if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		http.Error(w, "BadDigest", http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+// decodeChunked decodes the aws-chunked body of the streaming signature
+// The chunk signatures are not verified.
+func decodeChunked(body []byte) ([]byte, error) {
+	var data []byte
+	for {
+		header, rest, found := bytes.Cut(body, []byte("\r\n"))
+		if !found {
+			return nil, io.ErrUnexpectedEOF
+		}
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		if int64(len(rest)) < size+2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		data = append(data, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+// saveRecording saves a recording of the size with its sidecar
+func saveRecording(t *testing.T, size int) string {
+	path := filepath.Join(t.TempDir(), "881-2024-05-01-070000.aac")
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16+1)[:size]
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := recording.Metadata{
+		Channel: "881", Job: "morning", File: filepath.Base(path),
+		ScheduledStart: time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC),
+		Status:         recording.StatusCompleted, Bytes: int64(size),
+	}
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newUploader(t *testing.T, s3 *fakeS3, cfg Config) *Uploader {
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+	cfg.Endpoint = strings.TrimPrefix(server.URL, "http://")
+	cfg.Insecure = true
+	cfg.Bucket = s3.bucket
+	cfg.AccessKey, cfg.SecretKey = "access", "secret"
+	u, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestUploader_Upload(t *testing.T) {
+	fake := newFakeS3("archive")
+	u := newUploader(t, fake, Config{StorageClass: "STANDARD_IA", PartSize: MinPartSize})
+	path := saveRecording(t, MinPartSize*2+1000)
+
+	objects, err := u.Upload(context.Background(), path)
+	if !assert.NoError(t, err) || !assert.Len(t, objects, 2) {
+		t.FailNow()
+	}
+	assert.Equal(t, "881/2024/05/01/881-2024-05-01-070000.aac", objects[0].Key)
+	assert.Equal(t, "881/2024/05/01/881-2024-05-01-070000.json", objects[1].Key)
+	assert.True(t, strings.HasSuffix(objects[0].ETag, "-3"), "media shall be uploaded in 3 parts")
+	assert.Equal(t, 3, fake.parts)
+
+	media, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, media, fake.objects[objects[0].Key].data)
+	assert.Equal(t, "STANDARD_IA", fake.objects[objects[0].Key].storageClass)
+	assert.FileExists(t, path, "local files shall be kept")
+}
+
+func TestUploader_Upload_DeleteLocal(t *testing.T) {
+	fake := newFakeS3("archive")
+	u := newUploader(t, fake, Config{
+		KeyTemplate: `{{.Job}}/{{.ScheduledStart.Format "2006-01"}}/{{.Name}}`,
+		DeleteLocal: true,
+	})
+	path := saveRecording(t, 1000)
+
+	objects, err := u.Upload(context.Background(), path)
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 2) {
+		assert.Equal(t, "morning/2024-05/881-2024-05-01-070000.aac", objects[0].Key)
+	}
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, recording.SidecarPath(path))
+}
+
+func TestUploader_Upload_Mismatch(t *testing.T) {
+	fake := newFakeS3("archive")
+	fake.tamper = true
+	u := newUploader(t, fake, Config{DeleteLocal: true})
+	path := saveRecording(t, 1000)
+
+	_, err := u.Upload(context.Background(), path)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.FileExists(t, path, "local files shall be kept after a failed upload")
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(Config{Bucket: "archive"})
+	assert.Error(t, err)
+	_, err = New(Config{Endpoint: "localhost:9000", Bucket: "archive", PartSize: 1024})
+	assert.Error(t, err)
+	_, err = New(Config{Endpoint: "localhost:9000", Bucket: "archive", KeyTemplate: "{{.Channel"})
+	assert.Error(t, err)
+}
+
+func TestETag(t *testing.T) {
+	data := []byte("recording")
+	sum := md5.Sum(data)
+	etag, err := ETag(bytes.NewReader(data), int64(len(data)), MinPartSize)
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), etag)
+}
+
+func TestStream(t *testing.T) {
+	fake := newFakeS3("archive")
+	u := newUploader(t, fake, Config{PartSize: MinPartSize})
+	s := u.Stream()
+	info := sink.Info{
+		Channel: "881",
+		Path:    "/srv/881-2024-05-01-070000.aac",
+		Start:   time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC),
+	}
+
+	var media []byte
+	assert.NoError(t, s.Open(info))
+	for i, size := range []int{MinPartSize - 10, MinPartSize, 100} {
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		media = append(media, data...)
+		assert.NoError(t, s.Write(fetcher.Segment{Sequence: int64(i + 1), Data: data}))
+	}
+	assert.NoError(t, s.Close())
+	assert.Equal(t, 3, fake.parts)
+	assert.Equal(t, media, fake.objects["881/2024/05/01/881-2024-05-01-070000.aac"].data)
+
+	fake.tamper = true
+	assert.NoError(t, s.Open(info))
+	assert.ErrorIs(t, s.Close(), ErrChecksumMismatch)
+}
+
+func TestUploader_Upload_Streamed(t *testing.T) {
+	fake := newFakeS3("archive")
+	u := newUploader(t, fake, Config{PartSize: MinPartSize})
+	path := saveRecording(t, MinPartSize*2+1000)
+	media, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := u.Stream()
+	assert.NoError(t, s.Open(sink.Info{Channel: "881", Job: "morning", Path: path, Start: time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)}))
+	assert.NoError(t, s.Write(fetcher.Segment{Sequence: 1, Data: media}))
+	assert.NoError(t, s.Close())
+	assert.Equal(t, 3, fake.parts)
+
+	objects, err := u.Upload(context.Background(), path)
+	if assert.NoError(t, err) && assert.Len(t, objects, 2) {
+		assert.Equal(t, "881/2024/05/01/881-2024-05-01-070000.aac", objects[0].Key)
+	}
+	assert.Equal(t, 3, fake.parts, "streamed media shall not be uploaded again")
+	assert.Contains(t, fake.objects, "881/2024/05/01/881-2024-05-01-070000.json")
+}
+
+func TestPartHash(t *testing.T) {
+	data := []byte("recording")
+	sum := md5.Sum(data)
+	sums := md5.Sum(sum[:])
+	h := newPartHash(int64(len(data)))
+	h.Write(data[:3])
+	h.Write(data[3:])
+	assert.Equal(t, hex.EncodeToString(sums[:])+"-1", h.ETag())
+
+	parts := md5.New()
+	for _, part := range []string{"reco", "rdin", "g"} {
+		sum := md5.Sum([]byte(part))
+		parts.Write(sum[:])
+	}
+	h = newPartHash(4)
+	h.Write(data)
+	assert.Equal(t, hex.EncodeToString(parts.Sum(nil))+"-3", h.ETag())
+
+	empty := md5.Sum(nil)
+	emptySums := md5.Sum(empty[:])
+	assert.Equal(t, hex.EncodeToString(emptySums[:])+"-1", newPartHash(4).ETag(), "an empty content is a single empty part")
+}
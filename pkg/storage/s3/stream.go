@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// Stream is a sink uploading the media to the bucket while recording
+// The segments are uploaded in parts of the part size, so a write
+// blocks while a part is uploaded. Wrap it with sink.NewAsync to keep
+// the recording going. The sidecar is not uploaded, Upload after the
+// recording uploads it and skips the streamed media.
+type Stream struct {
+	Uploader *Uploader
+
+	path   string
+	key    string
+	pipe   *io.PipeWriter
+	hash   *partHash
+	size   int64
+	cancel context.CancelFunc // aborts the upload
+	result chan error
+}
+
+// Stream creates the sink uploading to the bucket
+func (u *Uploader) Stream() *Stream {
+	return &Stream{Uploader: u}
+}
+
+// Open starts the upload of the recording
+func (s *Stream) Open(info sink.Info) error {
+	meta := recording.Metadata{
+		Channel:        info.Channel,
+		Job:            info.Job,
+		File:           filepath.Base(info.Path),
+		ScheduledStart: info.Start,
+		ScheduledEnd:   info.End,
+	}
+	key, err := s.Uploader.Key(meta, meta.File)
+	if err != nil {
+		return err
+	}
+	r, w := io.Pipe()
+	s.path, s.key, s.pipe = info.Path, key, w
+	s.hash = newPartHash(int64(s.Uploader.PartSize))
+	s.size = 0
+	s.result = make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		_, err := s.Uploader.client.PutObject(ctx, s.Uploader.Bucket, key, r, -1, minio.PutObjectOptions{
+			ContentType:    contentType(info.Path),
+			StorageClass:   s.Uploader.StorageClass,
+			PartSize:       s.Uploader.PartSize,
+			SendContentMd5: true,
+		})
+		r.CloseWithError(err)
+		s.result <- err
+	}()
+	return nil
+}
+
+// Write the segment to the upload
+// The upload is aborted when the segment cannot be written.
+func (s *Stream) Write(seg fetcher.Segment) error {
+	if _, err := s.pipe.Write(seg.Data); err != nil {
+		s.cancel()
+		return err
+	}
+	s.hash.Write(seg.Data)
+	s.size += int64(len(seg.Data))
+	return nil
+}
+
+// Close completes the upload and verifies the object size and ETag
+func (s *Stream) Close() error {
+	if s.pipe == nil {
+		return nil
+	}
+	s.pipe.Close()
+	s.pipe = nil
+	defer s.cancel()
+	if err := <-s.result; err != nil {
+		return err
+	}
+	stat, err := s.Uploader.client.StatObject(context.Background(), s.Uploader.Bucket, s.key, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	etag, expected := strings.Trim(stat.ETag, `"`), s.hash.ETag()
+	if stat.Size != s.size || etag != expected {
+		return fmt.Errorf("%w: object %s of %d bytes, stream %s of %d bytes",
+			ErrChecksumMismatch, etag, stat.Size, expected, s.size)
+	}
+	s.Uploader.logger().Info("Recording streamed", logging.KeyFile, s.path, "bucket", s.Uploader.Bucket, "key", s.key, "bytes", s.size)
+	return nil
+}
+
+// String is the bucket of the uploads
+func (s *Stream) String() string {
+	return s.Uploader.Bucket
+}
@@ -0,0 +1,232 @@
+package encoder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// Defaults of the encoder
+const (
+	DefaultCommand = "ffmpeg"
+	CloseTimeout   = 30 * time.Second // wait for the encoder to finish the output
+	maxStderr      = 4 << 10          // bytes of the encoder errors kept
+)
+
+// ErrNoEncoder is the error of a missing encoder executable
+var ErrNoEncoder = errors.New("encoder not found")
+
+// Format is an output format of the encoder
+type Format struct {
+	Name        string
+	Extension   string
+	ContentType string
+	Args        []string // output arguments of an ffmpeg-compatible encoder
+}
+
+// Output formats
+var (
+	MP3 = Format{
+		Name:        "mp3",
+		Extension:   ".mp3",
+		ContentType: "audio/mpeg",
+		Args:        []string{"-c:a", "libmp3lame", "-b:a", "128k", "-f", "mp3"},
+	}
+	Opus = Format{
+		Name:        "opus",
+		Extension:   ".opus",
+		ContentType: "audio/ogg",
+		Args:        []string{"-c:a", "libopus", "-b:a", "64k", "-f", "ogg"},
+	}
+)
+
+// Formats lists the output formats
+var Formats = []Format{MP3, Opus}
+
+// ParseFormat finds the output format by name
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unknown encoding format [%s]", name)
+}
+
+// ContentType of the media file by its extension
+func ContentType(path string) string {
+	for _, f := range Formats {
+		if filepath.Ext(path) == f.Extension {
+			return f.ContentType
+		}
+	}
+	return "audio/aac"
+}
+
+// Encoder is a sink piping the ADTS stream through an external
+// ffmpeg-compatible encoder, which writes the encoded file next to
+// the recording file, e.g. 881-2024-05-01-070000.mp3
+// A failed encoder removes its incomplete output, so that the
+// recording file is the fallback.
+type Encoder struct {
+	Format  Format
+	Command string   // encoder executable, defaults to DefaultCommand
+	Args    []string // output arguments, defaults to the Format arguments
+	Replace bool     // the encoded file replaces the recording file
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stderr  *limitedBuffer
+	path    string
+	encoded string // path of the last complete output
+	failed  error
+}
+
+// New creates the encoder of the format
+func New(format Format) *Encoder {
+	return &Encoder{Format: format}
+}
+
+// Path of the encoded file of the recording file
+func (e *Encoder) Path(recordingPath string) string {
+	return strings.TrimSuffix(recordingPath, filepath.Ext(recordingPath)) + e.Format.Extension
+}
+
+// Open starts the encoder of the recording
+func (e *Encoder) Open(info sink.Info) error {
+	e.path = e.Path(info.Path)
+	e.encoded = ""
+	e.failed = nil
+	args := e.Args
+	if len(args) == 0 {
+		args = e.Format.Args
+	}
+	cmdArgs := append([]string{"-hide_banner", "-loglevel", "error", "-f", "aac", "-i", "pipe:0"}, args...)
+	cmdArgs = append(cmdArgs, "-y", e.path)
+	e.cmd = exec.Command(e.command(), cmdArgs...)
+	e.stderr = &limitedBuffer{limit: maxStderr}
+	e.cmd.Stderr = e.stderr
+	stdin, err := e.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := e.cmd.Start(); err != nil {
+		return err
+	}
+	e.stdin = stdin
+	return nil
+}
+
+// Write the segment to the encoder
+// A failed write stops the encoder.
+func (e *Encoder) Write(seg fetcher.Segment) error {
+	if _, err := e.stdin.Write(seg.Data); err != nil {
+		e.failed = err
+		return e.Close()
+	}
+	return nil
+}
+
+// Close waits for the encoder to finish the output
+// The encoder is killed after CloseTimeout.
+func (e *Encoder) Close() error {
+	if e.cmd == nil {
+		return nil
+	}
+	cmd := e.cmd
+	e.cmd = nil
+	e.stdin.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(CloseTimeout):
+		cmd.Process.Kill()
+		<-done
+		err = fmt.Errorf("encoder timed out after %s", CloseTimeout)
+	}
+	if err == nil {
+		err = e.failed
+	}
+	if err != nil {
+		os.Remove(e.path)
+		return e.error(err)
+	}
+	e.encoded = e.path
+	return nil
+}
+
+// Encoded returns the path of the complete output of the last
+// recording, or an empty path when the encoder failed
+func (e *Encoder) Encoded() string {
+	return e.encoded
+}
+
+// Replacement returns the encoded file which replaces the recording
+// file, if any
+func (e *Encoder) Replacement() string {
+	if !e.Replace {
+		return ""
+	}
+	return e.encoded
+}
+
+// Produced returns the encoded file kept besides the recording file, if any
+func (e *Encoder) Produced() string {
+	if e.Replace {
+		return ""
+	}
+	return e.encoded
+}
+
+// String is the output format
+func (e *Encoder) String() string {
+	return e.Format.Name
+}
+
+// error describes the encoder failure with its error output
+func (e *Encoder) error(err error) error {
+	if output := strings.TrimSpace(e.stderr.String()); output != "" {
+		return fmt.Errorf("%s encoder: %w: %s", e.Format.Name, err, output)
+	}
+	return fmt.Errorf("%s encoder: %w", e.Format.Name, err)
+}
+
+// Check that the encoder executable is available
+func (e *Encoder) Check() error {
+	if _, err := exec.LookPath(e.command()); err != nil {
+		return fmt.Errorf("%w: %s", ErrNoEncoder, e.command())
+	}
+	return nil
+}
+
+func (e *Encoder) command() string {
+	if e.Command == "" {
+		return DefaultCommand
+	}
+	return e.Command
+}
+
+// limitedBuffer keeps the first bytes written to it
+type limitedBuffer struct {
+	strings.Builder
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Builder.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,99 @@
+package encoder
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
+)
+
+// fakeEncoder writes a shell script standing in for ffmpeg
+func fakeEncoder(t *testing.T, script string) string {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encode(t *testing.T, e *Encoder, segments ...string) (sink.Info, error) {
+	info := sink.Info{Channel: "881", Path: filepath.Join(t.TempDir(), "881-2024-05-01-070000.aac")}
+	if err := e.Open(info); err != nil {
+		return info, err
+	}
+	for i, data := range segments {
+		if err := e.Write(fetcher.Segment{Sequence: int64(i + 1), Data: []byte(data)}); err != nil {
+			return info, err
+		}
+	}
+	return info, e.Close()
+}
+
+func TestEncoder(t *testing.T) {
+	e := New(MP3)
+	e.Command = fakeEncoder(t, `for last; do :; done; echo "$@" > "$last.args"; cat > "$last"`)
+	e.Replace = true
+
+	info, err := encode(t, e, "abc", "def")
+	assert.NoError(t, err)
+	encoded := strings.TrimSuffix(info.Path, ".aac") + ".mp3"
+	assert.Equal(t, encoded, e.Encoded())
+	assert.Equal(t, encoded, e.Replacement())
+	assert.Empty(t, e.Produced(), "the replacement is the recording file")
+	data, err := os.ReadFile(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef", string(data))
+	args, err := os.ReadFile(encoded + ".args")
+	assert.NoError(t, err)
+	assert.Equal(t, "-hide_banner -loglevel error -f aac -i pipe:0 -c:a libmp3lame -b:a 128k -f mp3 -y "+encoded+"\n", string(args))
+
+	e.Replace = false
+	assert.Empty(t, e.Replacement(), "the recording file shall be kept")
+	assert.Equal(t, encoded, e.Produced())
+}
+
+func TestEncoder_Failed(t *testing.T) {
+	e := New(Opus)
+	e.Command = fakeEncoder(t, `for last; do :; done; cat > "$last"; echo "Unknown encoder 'libopus'" >&2; exit 1`)
+	e.Replace = true
+
+	info, err := encode(t, e, "abc")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unknown encoder 'libopus'")
+	}
+	assert.Empty(t, e.Replacement())
+	assert.NoFileExists(t, strings.TrimSuffix(info.Path, ".aac")+".opus", "incomplete output shall be removed")
+
+	e.Command = fakeEncoder(t, "exit 1")
+	_, err = encode(t, e, strings.Repeat("a", 1<<20), "b")
+	assert.Error(t, err, "a stopped encoder shall fail")
+	assert.Empty(t, e.Replacement())
+
+	e.Command = filepath.Join(t.TempDir(), "missing")
+	_, err = encode(t, e, "abc")
+	assert.Error(t, err)
+	assert.ErrorIs(t, e.Check(), ErrNoEncoder)
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("opus")
+	assert.NoError(t, err)
+	assert.Equal(t, ".opus", f.Extension)
+	_, err = ParseFormat("wma")
+	assert.Error(t, err)
+}
+
+func TestContentType(t *testing.T) {
+	assert.Equal(t, "audio/mpeg", ContentType("/srv/881.mp3"))
+	assert.Equal(t, "audio/ogg", ContentType("881.opus"))
+	assert.Equal(t, "audio/aac", ContentType("881.aac"))
+}
@@ -0,0 +1,262 @@
+package fetcher
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/stream/url"
+)
+
+const (
+	// ConsecutiveErrorTolerance is the number of failures on downloading a stream
+	// which shall be tolerated
+	ConsecutiveErrorTolerance = 15
+
+	// TwoSeconds time value
+	TwoSeconds = 2 * time.Second
+)
+
+// Segment is a media segment of the channel stream
+type Segment struct {
+	Path     string // playlist entry of the segment
+	Sequence int64  // media sequence number, 0 when unknown
+	Data     []byte
+	Duration time.Duration
+	Fetched  time.Time
+}
+
+// Fetcher owns the stream resolution and segment downloads of a channel
+// Every segment is downloaded once and fanned out to all subscriptions.
+// It runs while there is any subscription.
+type Fetcher struct {
+	Channel      string
+	PollInterval time.Duration // wait before polling again when the playlist has no new segment
+	Logger       *slog.Logger  // defaults to slog.Default()
+
+	source      Source
+	mu          sync.Mutex
+	subscribers map[*Subscription]bool
+	recent      []Segment // downloaded segments in the latest playlist
+	running     bool
+}
+
+// New creates a Fetcher of the channel downloading from the source
+func New(channel string, source Source) *Fetcher {
+	return &Fetcher{
+		Channel:      channel,
+		PollInterval: TwoSeconds,
+		source:       source,
+		subscribers:  make(map[*Subscription]bool),
+	}
+}
+
+// Subscribe to the segments fetched between start and end
+// The segments of the latest playlist which have been downloaded
+// are delivered immediately once the start time is reached.
+// The listener receives the fetcher events and may be nil.
+func (f *Fetcher) Subscribe(start, end time.Time, listener Listener) *Subscription {
+	sub := newSubscription(f, start, end, listener)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers[sub] = true
+	if !time.Now().Before(start) {
+		for _, seg := range f.recent {
+			sub.deliver(seg)
+		}
+	}
+	if !f.running {
+		f.running = true
+		go f.run()
+	}
+
+	return sub
+}
+
+func (f *Fetcher) unsubscribe(sub *Subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribers[sub] {
+		delete(f.subscribers, sub)
+		sub.close(nil)
+	}
+}
+
+// active removes the ended subscriptions and reports whether
+// any subscription remains. The fetcher stops when there is none.
+func (f *Fetcher) active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for sub := range f.subscribers {
+		if !now.Before(sub.End) {
+			delete(f.subscribers, sub)
+			sub.close(nil)
+		}
+	}
+	if len(f.subscribers) == 0 {
+		f.stop()
+		return false
+	}
+	return true
+}
+
+// fail closes all subscriptions with the error and stops the fetcher
+func (f *Fetcher) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subscribers {
+		delete(f.subscribers, sub)
+		sub.close(err)
+	}
+	f.stop()
+}
+
+// stop resets the fetcher state
+// It must be called with the lock held
+func (f *Fetcher) stop() {
+	f.running = false
+	f.recent = nil
+}
+
+func (f *Fetcher) publish(seg Segment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recent = append(f.recent, seg)
+	for sub := range f.subscribers {
+		if sub.wants(seg.Fetched) && !sub.deliver(seg) {
+			f.logger().Warn("Subscriber lagging, segment dropped",
+				logging.KeySequence, seg.Sequence, "dropped", sub.dropped)
+		}
+	}
+}
+
+func (f *Fetcher) logger() *slog.Logger {
+	logger := f.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(logging.KeyChannel, f.Channel)
+}
+
+// listeners returns the listeners of the current subscriptions
+func (f *Fetcher) listeners() []Listener {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var listeners []Listener
+	for sub := range f.subscribers {
+		if sub.listener != nil {
+			listeners = append(listeners, sub.listener)
+		}
+	}
+	return listeners
+}
+
+func (f *Fetcher) run() {
+	downloaded := make(map[string]bool)
+	failCount := 0
+	for f.active() {
+		wait, err := f.fetch(downloaded)
+		if err != nil {
+			if failCount >= ConsecutiveErrorTolerance {
+				f.logger().Error("Download failed, giving up",
+					logging.KeyAttempt, failCount+1, logging.Err(err))
+				f.fail(err)
+				return
+			}
+			f.source.Reset() // Probably stream source was wrong
+			failCount++
+			f.logger().Warn("Download failed, retrying",
+				logging.KeyAttempt, failCount, logging.Err(err))
+			for _, l := range f.listeners() {
+				l.OnRetry(failCount, err)
+			}
+			wait = calculateRetryDelay(failCount - 1)
+		} else {
+			failCount = 0
+		}
+		if r, ok := f.source.(Resolver); ok {
+			if src, renewed := r.Resolved(); renewed {
+				for _, l := range f.listeners() {
+					l.OnResolve(src)
+				}
+			}
+		}
+		time.Sleep(wait)
+	}
+}
+
+// fetch downloads the new segments in the playlist
+// It returns how long to wait before fetching again.
+func (f *Fetcher) fetch(downloaded map[string]bool) (time.Duration, error) {
+	requested := time.Now()
+	playlist, err := f.source.Playlist()
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(requested)
+	for _, l := range f.listeners() {
+		l.OnPlaylist(latency)
+	}
+
+	// Forget the segments which are no longer in the playlist
+	listed := make(map[string]bool)
+	for _, track := range playlist {
+		listed[track.Path] = true
+	}
+	for path := range downloaded {
+		if !listed[path] {
+			delete(downloaded, path)
+		}
+	}
+	f.mu.Lock()
+	recent := f.recent[:0]
+	for _, seg := range f.recent {
+		if listed[seg.Path] {
+			recent = append(recent, seg)
+		}
+	}
+	f.recent = recent
+	f.mu.Unlock()
+
+	var lastTrackDuration time.Duration
+	playlistDownloadStartTime := time.Now()
+	for _, track := range playlist {
+		if downloaded[track.Path] {
+			// Skip if the same track has been downloaded
+			continue
+		}
+		media, err := f.source.Media(track.Path)
+		if err != nil {
+			return 0, err
+		}
+		downloaded[track.Path] = true
+		lastTrackDuration = time.Duration(track.Time) * time.Second
+		sequence, _ := url.MediaSequence(track.Path)
+		f.logger().Debug("Segment downloaded", logging.KeySequence, sequence, logging.KeyURL, track.Path)
+		f.publish(Segment{
+			Path:     track.Path,
+			Sequence: sequence,
+			Data:     media,
+			Duration: lastTrackDuration,
+			Fetched:  time.Now(),
+		})
+	}
+
+	if lastTrackDuration <= 0 {
+		return f.PollInterval, nil
+	}
+	if time.Since(playlistDownloadStartTime) < lastTrackDuration {
+		return lastTrackDuration - TwoSeconds, nil // Wait 2 seconds less to be secure
+	}
+	return 0, nil
+}
+
+func calculateRetryDelay(count int) time.Duration {
+	if count > 0 {
+		return time.Duration(count) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ushis/m3u"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// fakeSource lists a new segment on every playlist request.
+type fakeSource struct {
+	mu        sync.Mutex
+	sequence  int
+	downloads map[string]int
+	err       error
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{downloads: make(map[string]int)}
+}
+
+func (s *fakeSource) Playlist() (m3u.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.sequence++
+	var playlist m3u.Playlist
+	for seq := s.sequence - 2; seq <= s.sequence; seq++ {
+		if seq > 0 {
+			playlist = append(playlist, m3u.Track{Path: fmt.Sprintf("l_46_%d.aac", seq)})
+		}
+	}
+	return playlist, nil
+}
+
+func (s *fakeSource) Media(path string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloads[path]++
+	return []byte(path), nil
+}
+
+func (s *fakeSource) Reset() {}
+
+func (s *fakeSource) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func collect(sub *Subscription) []string {
+	var paths []string
+	for seg := range sub.Segments() {
+		paths = append(paths, string(seg.Data))
+	}
+	return paths
+}
+
+func TestFetcher_Subscribe(t *testing.T) {
+	source := newFakeSource()
+	f := New("881", source)
+	f.PollInterval = 10 * time.Millisecond
+
+	now := time.Now()
+	first := f.Subscribe(now, now.Add(200*time.Millisecond), nil)
+	second := f.Subscribe(now.Add(100*time.Millisecond), now.Add(300*time.Millisecond), nil)
+
+	var firstPaths, secondPaths []string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		firstPaths = collect(first)
+	}()
+	go func() {
+		defer wg.Done()
+		secondPaths = collect(second)
+	}()
+	wg.Wait()
+
+	assert.NotEmpty(t, firstPaths)
+	assert.NotEmpty(t, secondPaths)
+	assert.Equal(t, "l_46_1.aac", firstPaths[0])
+	assert.NotEqual(t, "l_46_1.aac", secondPaths[0], "segments before start shall be trimmed")
+	assert.Contains(t, firstPaths, secondPaths[0], "overlapping subscriptions shall share segments")
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	for path, count := range source.downloads {
+		assert.Equal(t, 1, count, "segment %s shall be downloaded once", path)
+	}
+}
+
+func TestFetcher_Subscribe_Recent(t *testing.T) {
+	source := newFakeSource()
+	f := New("881", source)
+	f.PollInterval = time.Hour
+
+	now := time.Now()
+	first := f.Subscribe(now, now.Add(time.Hour), nil)
+	defer first.Cancel()
+	<-first.Segments()
+
+	second := f.Subscribe(time.Now(), now.Add(time.Hour), nil)
+	defer second.Cancel()
+	seg := <-second.Segments()
+	assert.Equal(t, "l_46_1.aac", seg.Path, "downloaded segments of the latest playlist shall be delivered")
+}
+
+func TestFetcher_Subscribe_Cancel(t *testing.T) {
+	f := New("881", newFakeSource())
+	f.PollInterval = 10 * time.Millisecond
+
+	sub := f.Subscribe(time.Now(), time.Now().Add(time.Hour), nil)
+	sub.Cancel()
+	collect(sub)
+	assert.NoError(t, sub.Err())
+
+	assert.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return !f.running
+	}, time.Second, 10*time.Millisecond, "fetcher shall stop without subscription")
+}
+
+func TestFetcher_fail(t *testing.T) {
+	source := newFakeSource()
+	source.fail(errors.New("playlist fetching failed"))
+	f := New("881", source)
+
+	sub := f.Subscribe(time.Now(), time.Now().Add(time.Hour), nil)
+	f.fail(source.err)
+	collect(sub)
+	assert.EqualError(t, sub.Err(), "playlist fetching failed")
+}
+
+func TestPool_Fetcher(t *testing.T) {
+	p := NewPool()
+	assert.Same(t, p.Fetcher("881"), p.Fetcher("881"))
+	assert.NotSame(t, p.Fetcher("881"), p.Fetcher("903"))
+}
+
+type retryListener struct {
+	retried chan error
+}
+
+func (l retryListener) OnRetry(attempt int, err error) {
+	select {
+	case l.retried <- err:
+	default:
+	}
+}
+
+func (l retryListener) OnResolve(resolver.StreamSource) {}
+
+func (l retryListener) OnPlaylist(time.Duration) {}
+
+func TestFetcher_Subscribe_Listener(t *testing.T) {
+	source := newFakeSource()
+	source.fail(errors.New("playlist fetching failed"))
+	f := New("881", source)
+
+	l := retryListener{retried: make(chan error, 1)}
+	sub := f.Subscribe(time.Now(), time.Now().Add(time.Hour), l)
+	defer sub.Cancel()
+
+	select {
+	case err := <-l.retried:
+		assert.EqualError(t, err, "playlist fetching failed")
+	case <-time.After(time.Second):
+		t.Error("listener shall be notified on retry")
+	}
+}
+
+func TestFetcher_Segment_Sequence(t *testing.T) {
+	f := New("881", newFakeSource())
+	sub := f.Subscribe(time.Now(), time.Now().Add(time.Hour), nil)
+	defer sub.Cancel()
+
+	seg := <-sub.Segments()
+	assert.EqualValues(t, 1, seg.Sequence)
+}
+
+func TestFetcher_Subscribe_Lagging(t *testing.T) {
+	source := newFakeSource()
+	f := New("881", source)
+	f.PollInterval = time.Millisecond
+
+	now := time.Now()
+	stalled := f.Subscribe(now, now.Add(time.Hour), nil)
+	defer stalled.Cancel()
+	active := f.Subscribe(now, now.Add(time.Hour), nil)
+	defer active.Cancel()
+
+	// The active subscriber keeps receiving while the stalled one is full
+	for i := 0; i < 2*SubscriptionBuffer; i++ {
+		select {
+		case <-active.Segments():
+		case <-time.After(time.Second):
+			t.Fatalf("segment %d not delivered behind a stalled subscriber", i)
+		}
+	}
+	stalled.Cancel()
+	assert.Len(t, collect(stalled), SubscriptionBuffer)
+	assert.Positive(t, stalled.Dropped())
+}
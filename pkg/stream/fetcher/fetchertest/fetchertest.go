@@ -0,0 +1,50 @@
+// Package fetchertest provides a fake stream source for the tests
+// of the packages recording through a fetcher.Pool.
+package fetchertest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ushis/m3u"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+)
+
+// Source lists a new segment on every playlist request.
+// The media of a segment is its path.
+type Source struct {
+	SkipEvery int // skips every nth segment to produce gaps, none when zero
+
+	mu       sync.Mutex
+	sequence int
+}
+
+// Playlist lists the next segment
+func (s *Source) Playlist() (m3u.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequence++
+	if s.SkipEvery > 0 && s.sequence%s.SkipEvery == 0 {
+		s.sequence++
+	}
+	return m3u.Playlist{{Path: fmt.Sprintf("l_46_%d.aac", s.sequence)}}, nil
+}
+
+// Media returns the path of the segment
+func (s *Source) Media(path string) ([]byte, error) {
+	return []byte(path), nil
+}
+
+// Reset does nothing
+func (s *Source) Reset() {}
+
+// NewPool creates a pool fetching every channel from a new Source
+// skipping every nth segment, none when zero
+func NewPool(skipEvery int) *fetcher.Pool {
+	pool := fetcher.NewPool()
+	pool.NewSource = func(channel string) fetcher.Source {
+		return &Source{SkipEvery: skipEvery}
+	}
+	return pool
+}
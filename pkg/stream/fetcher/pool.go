@@ -0,0 +1,42 @@
+package fetcher
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// DefaultPool is the Pool shared in the process
+var DefaultPool = NewPool()
+
+// Pool shares a Fetcher per channel
+type Pool struct {
+	NewSource func(channel string) Source
+	Logger    *slog.Logger // logger of the fetchers, defaults to slog.Default()
+
+	mu       sync.Mutex
+	fetchers map[string]*Fetcher
+}
+
+// NewPool creates a Pool of CRHK channel fetchers
+func NewPool() *Pool {
+	return &Pool{
+		NewSource: NewSource,
+		fetchers:  make(map[string]*Fetcher),
+	}
+}
+
+// Fetcher returns the shared Fetcher of the channel
+func (p *Pool) Fetcher(channel string) *Fetcher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, found := p.fetchers[channel]
+	if !found {
+		f = New(channel, p.NewSource(channel))
+		f.Logger = p.Logger
+		if s, ok := f.source.(*crhkSource); ok {
+			s.client.Logger = f.logger()
+		}
+		p.fetchers[channel] = f
+	}
+	return f
+}
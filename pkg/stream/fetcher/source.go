@@ -0,0 +1,77 @@
+package fetcher
+
+import (
+	"time"
+
+	"github.com/ushis/m3u"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// Source resolves and downloads the stream of a channel
+type Source interface {
+	// Playlist returns the segments listed in the channel playlist
+	Playlist() (m3u.Playlist, error)
+
+	// Media downloads the segment of a playlist entry
+	Media(path string) ([]byte, error)
+
+	// Reset clears the resolved stream source
+	Reset()
+}
+
+// Resolver is implemented by a Source which resolves the stream source
+type Resolver interface {
+	// Resolved returns the current stream source and reports
+	// whether it was renewed since the last call
+	Resolved() (src resolver.StreamSource, renewed bool)
+}
+
+// crhkSource is the Source of CRHK radio channel stream
+// The stream source is resolved through the shared resolver cache
+type crhkSource struct {
+	channel  string
+	cache    *resolver.Cache
+	client   *resolver.Client // logs with the fetcher attributes
+	current  resolver.StreamSource
+	reported time.Time // resolved time of the last reported stream source
+}
+
+// NewSource creates the Source of CRHK radio channel
+func NewSource(channel string) Source {
+	return &crhkSource{channel: channel, cache: resolver.DefaultCache, client: new(resolver.Client)}
+}
+
+// Playlist returns the segments listed in the channel playlist
+func (s *crhkSource) Playlist() (m3u.Playlist, error) {
+	src, err := s.cache.FindWith(s.client, s.channel)
+	if err != nil {
+		return nil, err
+	}
+	s.current = src
+	return s.client.GetPlaylist(src.ChannelName, src.StreamServer, src.CloudfrontCookie)
+}
+
+// Media downloads the segment of a playlist entry
+func (s *crhkSource) Media(path string) ([]byte, error) {
+	src, err := s.cache.FindWith(s.client, s.channel)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.GetMedia(src.ChannelName, src.StreamServer, src.CloudfrontCookie, path)
+}
+
+// Reset clears the resolved stream source
+func (s *crhkSource) Reset() {
+	s.cache.Invalidate(s.channel)
+}
+
+// Resolved returns the current stream source and reports
+// whether it was renewed since the last call
+func (s *crhkSource) Resolved() (resolver.StreamSource, bool) {
+	if s.current.Resolved.IsZero() || s.current.Resolved.Equal(s.reported) {
+		return s.current, false
+	}
+	s.reported = s.current.Resolved
+	return s.current, true
+}
@@ -0,0 +1,106 @@
+package fetcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// SubscriptionBuffer is the number of segments buffered for a subscriber
+// A subscriber lagging behind by more segments misses the newer ones.
+const SubscriptionBuffer = 64
+
+// Listener receives the events of the Fetcher
+// The methods are called from the fetcher goroutine.
+type Listener interface {
+	// OnRetry is called when fetching failed and will be retried
+	OnRetry(attempt int, err error)
+
+	// OnResolve is called when the stream source has been resolved
+	OnResolve(src resolver.StreamSource)
+
+	// OnPlaylist is called when the playlist has been fetched
+	OnPlaylist(latency time.Duration)
+}
+
+// Subscription receives the segments of a channel
+// which are fetched between Start and End
+type Subscription struct {
+	Start time.Time
+	End   time.Time
+
+	fetcher   *Fetcher
+	listener  Listener
+	segments  chan Segment
+	cancelled chan struct{}
+	closeOnce sync.Once
+	err       error
+	dropped   int
+}
+
+func newSubscription(f *Fetcher, start, end time.Time, listener Listener) *Subscription {
+	return &Subscription{
+		Start:     start,
+		End:       end,
+		fetcher:   f,
+		listener:  listener,
+		segments:  make(chan Segment, SubscriptionBuffer),
+		cancelled: make(chan struct{}),
+	}
+}
+
+// Segments returns the channel of the subscribed segments
+// The channel is closed when End is reached or the fetcher failed
+func (s *Subscription) Segments() <-chan Segment {
+	return s.segments
+}
+
+// Err returns the error which stopped the fetcher
+// It is only valid after the segments channel is closed
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Cancel the subscription
+func (s *Subscription) Cancel() {
+	s.closeOnce.Do(func() {
+		close(s.cancelled)
+	})
+	s.fetcher.unsubscribe(s)
+}
+
+// wants reports whether the segment fetched at the given time is subscribed
+func (s *Subscription) wants(fetched time.Time) bool {
+	return !fetched.Before(s.Start) && fetched.Before(s.End)
+}
+
+// Dropped returns the number of segments missed by lagging behind
+// It is only valid after the segments channel is closed
+func (s *Subscription) Dropped() int {
+	return s.dropped
+}
+
+// deliver the segment without waiting for the subscriber, so that a
+// stalled subscriber does not hold up the others. The segment is dropped
+// when the buffer is full, which leaves a gap in the media sequence.
+// It reports whether the segment is delivered.
+// It must be called with the fetcher lock held
+func (s *Subscription) deliver(seg Segment) bool {
+	select {
+	case s.segments <- seg:
+		return true
+	case <-s.cancelled:
+		return true
+	default:
+		s.dropped++
+		return false
+	}
+}
+
+// close the segments channel with the error
+// It must be called with the fetcher lock held
+func (s *Subscription) close(err error) {
+	s.err = err
+	close(s.segments)
+}
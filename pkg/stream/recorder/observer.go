@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
+)
+
+// Observer receives the recording progress of a Recorder
+// The methods may be called from different goroutines
+// and shall return promptly.
+type Observer interface {
+	// OnScheduled is called when the next recording has been scheduled
+	OnScheduled(r *Recorder, start, end time.Time)
+
+	// OnStart is called when the recording to the file has started
+	OnStart(r *Recorder, path string, start, end time.Time)
+
+	// OnSegment is called when a media segment has been written
+	OnSegment(r *Recorder, sequence int64, bytes int, duration time.Duration)
+
+	// OnGap is called when the media sequence from..to is missing
+	OnGap(r *Recorder, from, to int64)
+
+	// OnRetry is called when downloading failed and will be retried
+	OnRetry(r *Recorder, attempt int, err error)
+
+	// OnResolve is called when the stream source has been resolved
+	OnResolve(r *Recorder, src resolver.StreamSource)
+
+	// OnPlaylist is called when the channel playlist has been fetched
+	OnPlaylist(r *Recorder, latency time.Duration)
+
+	// OnStop is called when the recording has stopped
+	OnStop(r *Recorder, summary Summary)
+}
+
+// Summary of a stopped recording
+type Summary struct {
+	recording.Metadata
+	Path string
+	Err  error // nil when the recording has completed
+}
+
+// NopObserver implements Observer with no operation
+// It can be embedded to implement only a part of Observer.
+type NopObserver struct{}
+
+// OnScheduled does nothing
+func (NopObserver) OnScheduled(*Recorder, time.Time, time.Time) {}
+
+// OnStart does nothing
+func (NopObserver) OnStart(*Recorder, string, time.Time, time.Time) {}
+
+// OnSegment does nothing
+func (NopObserver) OnSegment(*Recorder, int64, int, time.Duration) {}
+
+// OnGap does nothing
+func (NopObserver) OnGap(*Recorder, int64, int64) {}
+
+// OnRetry does nothing
+func (NopObserver) OnRetry(*Recorder, int, error) {}
+
+// OnResolve does nothing
+func (NopObserver) OnResolve(*Recorder, resolver.StreamSource) {}
+
+// OnPlaylist does nothing
+func (NopObserver) OnPlaylist(*Recorder, time.Duration) {}
+
+// OnStop does nothing
+func (NopObserver) OnStop(*Recorder, Summary) {}
+
+// AddObserver registers an observer of the recording progress
+func (r *Recorder) AddObserver(o Observer) {
+	r.observersMu.Lock()
+	defer r.observersMu.Unlock()
+	r.observers = append(r.observers, o)
+}
+
+// notify calls the function with every registered observer
+func (r *Recorder) notify(call func(Observer)) {
+	r.observersMu.RLock()
+	observers := r.observers
+	r.observersMu.RUnlock()
+	for _, o := range observers {
+		call(o)
+	}
+}
+
+// fetcherListener passes the fetcher events to the observers
+type fetcherListener struct {
+	r *Recorder
+}
+
+func (l fetcherListener) OnRetry(attempt int, err error) {
+	l.r.notify(func(o Observer) { o.OnRetry(l.r, attempt, err) })
+}
+
+func (l fetcherListener) OnResolve(src resolver.StreamSource) {
+	l.r.notify(func(o Observer) { o.OnResolve(l.r, src) })
+}
+
+func (l fetcherListener) OnPlaylist(latency time.Duration) {
+	l.r.notify(func(o Observer) { o.OnPlaylist(l.r, latency) })
+}
@@ -1,25 +1,29 @@
 package recorder
 
 import (
-	"bufio"
-	"errors"
+	"context"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	dow "github.com/antonyho/crhk-recorder/pkg/dayofweek"
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/schedule"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
 	"github.com/antonyho/crhk-recorder/pkg/stream/resolver"
-	"github.com/antonyho/crhk-recorder/pkg/stream/url"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
 )
 
 const (
 	// ConsecutiveErrorTolerance is the number of failures on downloading a stream
 	// which shall be tolerated
-	ConsecutiveErrorTolerance = 15
+	ConsecutiveErrorTolerance = fetcher.ConsecutiveErrorTolerance
 
 	// OneDay time value
 	OneDay = 24 * time.Hour
@@ -29,12 +33,26 @@ const (
 )
 
 // Recorder CRHK radio channel broadcasted online
+// A Recorder is safe for concurrent use once its settings are assigned.
 type Recorder struct {
 	Channel                 string
-	ChannelName             string // specifies with stream sound quality (e.g. 881HD)
-	StreamServer            string
+	ChannelName             string           // specifies with stream sound quality (e.g. 881HD), guarded by mu
+	StreamServer            string           // guarded by mu
+	Location                *time.Location   // timezone of the schedule, defaults to the station timezone
+	Pool                    *fetcher.Pool    // shares channel downloads, defaults to fetcher.DefaultPool
+	OutputDir               string           // directory of recorded files, defaults to the working directory
+	Prefix                  string           // filename prefix of recorded files, defaults to the channel
+	Job                     string           // name of the scheduled job, if any
+	Logger                  *slog.Logger     // defaults to slog.Default()
+	Guard                   *diskspace.Guard // keeps free disk space for the recordings, nil disables
+	Output                  sink.Sink        // replaces the recording file and its sidecar, e.g. with a pipe
+	Sinks                   []sink.Sink      // more destinations of the segments, which may fail without stopping the recording
+	observersMu             sync.RWMutex
+	observers               []Observer
+	mu                      sync.Mutex // guards the stream source, downloaded media and bitrate
 	cloudfrontSessionCookie *resolver.CloudfrontCookie
 	downloaded              map[string]bool
+	bitrate                 float64 // bytes per second observed on the last recording
 }
 
 // NewRecorder is a constructor for Recorder
@@ -51,29 +69,47 @@ func (r *Recorder) clearStreamSource() {
 	r.cloudfrontSessionCookie = nil
 }
 
-func (r *Recorder) cleanup() {
-	r.downloaded = make(map[string]bool)
-	r.clearStreamSource()
-}
-
 // Download the media from channel playlist
+// The stream source is resolved through the shared resolver cache
 func (r *Recorder) Download(targetFile io.Writer) error {
+	r.mu.Lock()
+	lastTrackDuration, err := r.download(targetFile)
+	if err != nil {
+		// Probably stream source was wrong
+		r.clearStreamSource()
+		resolver.DefaultCache.Invalidate(r.Channel)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if lastTrackDuration > 0 {
+		time.Sleep(lastTrackDuration - TwoSeconds) // Wait 2 seconds less to be secure
+	}
+
+	return nil
+}
+
+// download the new media in the playlist
+// It returns the track duration to wait for the next media.
+func (r *Recorder) download(targetFile io.Writer) (time.Duration, error) {
 	if r.ChannelName == "" ||
 		r.StreamServer == "" ||
 		r.cloudfrontSessionCookie == nil ||
 		!r.cloudfrontSessionCookie.Assigned() {
-		channelName, streamServer, cloudfrontCookie, err := resolver.Find(r.Channel)
+		src, err := resolver.DefaultCache.FindWith(r.client(), r.Channel)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		r.ChannelName = channelName
-		r.StreamServer = streamServer
-		r.cloudfrontSessionCookie = &cloudfrontCookie
+		r.ChannelName = src.ChannelName
+		r.StreamServer = src.StreamServer
+		r.cloudfrontSessionCookie = &src.CloudfrontCookie
 	}
 
-	playlist, err := resolver.GetPlaylist(r.ChannelName, r.StreamServer, *r.cloudfrontSessionCookie)
+	playlist, err := r.client().GetPlaylist(r.ChannelName, r.StreamServer, *r.cloudfrontSessionCookie)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	var lastTrackDuration time.Duration
@@ -84,165 +120,375 @@ func (r *Recorder) Download(targetFile io.Writer) error {
 			continue
 		}
 
-		// Add CloudFront headers to the request
-		req, err := http.NewRequest(http.MethodGet, url.StreamMediaURL(r.ChannelName, r.StreamServer, track.Path), nil)
-		if err != nil {
-			return err
-		}
-		req.AddCookie(&http.Cookie{Name: resolver.CloudFrontCookieNamePolicy, Value: r.cloudfrontSessionCookie.Policy})
-		req.AddCookie(&http.Cookie{Name: resolver.CloudFrontCookieNameKeyPairID, Value: r.cloudfrontSessionCookie.KeyPairID})
-		req.AddCookie(&http.Cookie{Name: resolver.CloudFrontCookieNameSignature, Value: r.cloudfrontSessionCookie.Signature})
-
-		c := &http.Client{}
-		resp, err := c.Do(req)
+		media, err := resolver.GetMedia(r.ChannelName, r.StreamServer, *r.cloudfrontSessionCookie, track.Path)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("media file: unsuccessful HTTP request. response code: %d", resp.StatusCode)
-		}
-		media, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		resp.Body.Close()
 		contentSize := len(media)
-		if contentSize == 0 {
-			return errors.New("empty media file")
-		}
 
 		written, err := targetFile.Write(media)
 		if err != nil {
-			return err
+			return 0, err
 		} else if written != contentSize {
-			return fmt.Errorf("written byte size %d does not match with file size %d", written, contentSize)
+			return 0, fmt.Errorf("written byte size %d does not match with file size %d", written, contentSize)
 		}
 		r.downloaded[track.Path] = true
 		lastTrackDuration = time.Duration(track.Time) * time.Second
 	}
 
 	if time.Since(playlistDownloadStartTime) < lastTrackDuration {
-		time.Sleep(lastTrackDuration - TwoSeconds) // Wait 2 seconds less to be secure
+		return lastTrackDuration, nil
 	}
+	return 0, nil
+}
 
-	return nil
+// OutputPath returns the path of the file recording from the given time
+func (r *Recorder) OutputPath(startFrom time.Time) (string, error) {
+	dir := r.OutputDir
+	if dir == "" {
+		currExecDirPath, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		dir = currExecDirPath
+	}
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = r.Channel
+	}
+	mediaFilename := fmt.Sprintf("%s-%s.aac", prefix, startFrom.Format("2006-01-02-150405"))
+	return filepath.Join(dir, mediaFilename), nil
 }
 
 // Record the given channel
+// Overlapping recordings of the same channel share the segment downloads
 func (r *Recorder) Record(startFrom, until time.Time) error {
+	return r.RecordContext(context.Background(), startFrom, until)
+}
+
+// RecordContext records the given channel until the end time or the
+// context is cancelled. On cancellation the segments written so far are
+// flushed, the metadata sidecar is finalised as interrupted and the
+// context error is returned.
+func (r *Recorder) RecordContext(ctx context.Context, startFrom, until time.Time) (err error) {
 	if startFrom.After(until) {
 		panic("incorrect time sequence")
 	}
 
-	currExecDirPath, err := os.Getwd()
+	fileDestPath, err := r.OutputPath(startFrom)
 	if err != nil {
 		return err
 	}
-	mediaFilename := fmt.Sprintf("%s-%s.aac", r.Channel, startFrom.Format("2006-01-02-150405"))
-	fileDestPath := filepath.Join(currExecDirPath, mediaFilename)
-	f, err := os.Create(fileDestPath)
-	if err != nil {
+	out := r.output()
+	if err := out.Open(sink.Info{
+		Channel: r.Channel,
+		Job:     r.Job,
+		Path:    fileDestPath,
+		Start:   startFrom,
+		End:     until,
+	}); err != nil {
 		return err
 	}
-	defer f.Close()
-	bufFile := bufio.NewWriter(f)
-	defer bufFile.Flush()
-
-	diffFromStartTime := time.Until(startFrom)
-	diffFromEndTime := time.Until(until)
-
-	termination := make(chan bool)
-	go func() {
-		<-time.After(diffFromEndTime)
-		termination <- true
+	meta := &recording.Metadata{
+		Channel:        r.Channel,
+		Job:            r.Job,
+		File:           filepath.Base(fileDestPath),
+		ScheduledStart: startFrom,
+		ScheduledEnd:   until,
+		Status:         recording.StatusScheduled,
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		mediaPath := r.replace(meta, fileDestPath)
+		meta.Files = r.produced()
+		meta.Finish(err)
+		r.observeBitrate(meta)
+		if saveErr := r.save(meta, fileDestPath); err == nil {
+			err = saveErr
+		}
+		summary := Summary{Metadata: *meta, Path: mediaPath, Err: err}
+		r.logger().Info("Recording stopped", logging.KeyFile, mediaPath,
+			"status", meta.Status, "segments", meta.Segments, "bytes", meta.Bytes,
+			"gaps", meta.Gaps, logging.Err(err))
+		r.notify(func(o Observer) { o.OnStop(r, summary) })
 	}()
+	if err := r.save(meta, fileDestPath); err != nil {
+		return err
+	}
+
+	pool := r.Pool
+	if pool == nil {
+		pool = fetcher.DefaultPool
+	}
 
-	failCount := 0
+	if err := r.preflight(fileDestPath, startFrom, until); err != nil {
+		return err
+	}
+	if err := sleepContext(ctx, time.Until(startFrom)); err != nil {
+		return err
+	}
+	sub := pool.Fetcher(r.Channel).Subscribe(startFrom, until, fetcherListener{r})
+	defer sub.Cancel()
+	meta.Started = time.Now()
+	meta.Status = recording.StatusRecording
+	if err := r.save(meta, fileDestPath); err != nil {
+		return err
+	}
+	r.logger().Info("Recording started", logging.KeyFile, fileDestPath)
+	r.notify(func(o Observer) { o.OnStart(r, fileDestPath, startFrom, until) })
 
-	<-time.After(diffFromStartTime)
+	var lastSequence int64
+	termination := time.NewTimer(time.Until(until))
+	defer termination.Stop()
 	for {
 		select {
-		case <-termination:
-			r.cleanup()
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-termination.C:
 			return nil
 
-		default:
-			if err := r.Download(bufFile); err != nil {
-				if failCount < ConsecutiveErrorTolerance {
-					log.Printf("Download Error: %+v", err)
-					r.clearStreamSource() // Probably stream source was wrong
-					time.Sleep(calculateRetryDelay(failCount))
-					failCount++
-					continue
-				} else {
+		case seg, ok := <-sub.Segments():
+			if !ok {
+				// Fetcher gave up after consecutive errors
+				return sub.Err()
+			}
+			if r.Guard != nil {
+				if err := r.Guard.Check(filepath.Dir(fileDestPath), uint64(len(seg.Data))); err != nil {
+					r.logger().Error("Recording stopped before the disk is full", logging.Err(err))
 					return err
 				}
 			}
-			if err := bufFile.Flush(); err != nil {
+			if err := out.Write(seg); err != nil {
 				return err
 			}
-			failCount = 0
+			written := len(seg.Data)
+			if lastSequence > 0 && seg.Sequence > lastSequence+1 {
+				meta.Gaps++
+				meta.MissingSegments += int(seg.Sequence - lastSequence - 1)
+				from, to := lastSequence+1, seg.Sequence-1
+				r.logger().Warn("Media sequence gap", "from", from, "to", to)
+				r.notify(func(o Observer) { o.OnGap(r, from, to) })
+			}
+			if seg.Sequence > 0 {
+				lastSequence = seg.Sequence
+			}
+			meta.Segments++
+			meta.Bytes += int64(written)
+			meta.Duration += seg.Duration
+			r.logger().Debug("Segment written", logging.KeySequence, seg.Sequence, "bytes", written)
+			r.notify(func(o Observer) { o.OnSegment(r, seg.Sequence, written, seg.Duration) })
+		}
+	}
+}
+
+// output fans the segments out to the recording file, or the Output, and the sinks
+func (r *Recorder) output() *sink.Fanout {
+	out := &sink.Fanout{
+		OnError: func(s sink.Sink, err error) {
+			r.logger().Error("Sink failed", "sink", sink.Name(s), logging.Err(err))
+		},
+	}
+	if r.Output != nil {
+		out.Add(r.Output, true)
+	} else {
+		out.Add(sink.NewFile(), true)
+	}
+	for _, s := range r.Sinks {
+		out.Add(s, false)
+	}
+	return out
+}
+
+// replace the recording file with the file of a sink, e.g. an encoder
+// of another format, which shares the metadata sidecar
+// It returns the path of the recorded media.
+func (r *Recorder) replace(meta *recording.Metadata, path string) string {
+	if r.Output != nil {
+		return path
+	}
+	for _, s := range r.Sinks {
+		replacement := sink.Replacement(s)
+		if replacement == "" || recording.SidecarPath(replacement) != recording.SidecarPath(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			r.logger().Error("Recording file not replaced", logging.KeyFile, path, logging.Err(err))
+			return path
 		}
+		meta.File = filepath.Base(replacement)
+		return replacement
+	}
+	return path
+}
+
+// produced lists the files made by the sinks besides the recording file
+// They are removed together with the recording.
+func (r *Recorder) produced() []string {
+	var files []string
+	for _, s := range r.Sinks {
+		if path := sink.Produced(s); path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// save the metadata sidecar of the recording file, if any
+func (r *Recorder) save(meta *recording.Metadata, path string) error {
+	if r.Output != nil {
+		return nil
+	}
+	return meta.Save(path)
+}
+
+// preflight checks the free disk space for the estimated recording size
+// Insufficient space fails the recording when the guard refuses it,
+// otherwise it is logged as a warning.
+func (r *Recorder) preflight(path string, startFrom, until time.Time) error {
+	if r.Guard == nil {
+		return nil
+	}
+	if now := time.Now(); startFrom.Before(now) {
+		startFrom = now
+	}
+	r.mu.Lock()
+	bitrate := r.bitrate
+	r.mu.Unlock()
+	needed := diskspace.Estimate(until.Sub(startFrom), bitrate)
+	err := r.Guard.Check(filepath.Dir(path), needed)
+	if err != nil && !r.Guard.Refuse {
+		r.logger().Warn("Recording may run out of disk space", logging.KeyFile, path, logging.Err(err))
+		return nil
+	}
+	return err
+}
+
+// observeBitrate keeps the bitrate of the recording for the next estimate
+func (r *Recorder) observeBitrate(meta *recording.Metadata) {
+	if meta.Duration <= 0 || meta.Bytes <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bitrate = float64(meta.Bytes) / meta.Duration.Seconds()
+}
+
+// sleepContext waits for the duration unless the context is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// client of the stream servers logging with the recorder attributes
+func (r *Recorder) client() *resolver.Client {
+	return &resolver.Client{Logger: r.logger()}
+}
+
+func (r *Recorder) logger() *slog.Logger {
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With(logging.KeyChannel, r.Channel)
+	if r.Job != "" {
+		logger = logger.With(logging.KeyJob, r.Job)
+	}
+	return logger
+}
+
+// SetTimezone sets the timezone of the schedule by IANA timezone name
+func (r *Recorder) SetTimezone(name string) error {
+	loc, err := schedule.LoadLocation(name)
+	if err != nil {
+		return err
 	}
+	r.Location = loc
+	return nil
+}
+
+func (r *Recorder) location() (*time.Location, error) {
+	if r.Location != nil {
+		return r.Location, nil
+	}
+	return schedule.LoadLocation(schedule.DefaultTimezone)
 }
 
 // Schedule a time to start and end recording everyday
 // wd is a flag mask to control which day of week should be recorded
 // endless controls if the schedule would continue endlessly on next scheduled day
-// startTime format: 13:23:45 +0100 (24H with timezone offset)
+// startTime format: 13:23:45 (24H in the recorder timezone)
+// The legacy format with timezone offset 13:23:45 +0100 is also accepted
 func (r *Recorder) Schedule(startTime, endTime string, wd dow.Bitmask, endless bool) error {
-	var timeDelay time.Duration
-	thisYear, thisMonth, thisDay := time.Now().Date()
-	start, err := time.Parse("15:04:05 -0700", startTime)
+	loc, err := r.location()
 	if err != nil {
 		return err
 	}
-	start = start.AddDate(thisYear, int(thisMonth)-1, thisDay-1)
-	end, err := time.Parse("15:04:05 -0700", endTime)
+	window, err := schedule.NewWindow(startTime, endTime, wd, loc)
 	if err != nil {
 		return err
 	}
-	end = end.AddDate(thisYear, int(thisMonth)-1, thisDay-1)
-	if end.Before(start) { // To cover an overnight recording
-		end = end.Add(OneDay)
-	}
-	for !wd.AllEnabled() && !wd.Enabled(start.Weekday()) {
-		start = start.Add(OneDay)
-		end = end.Add(OneDay)
+
+	return r.Run(window, endless)
+}
+
+// ScheduleCron records for the given duration on every activation
+// of a five or six fields cron expression (e.g. "0 7 * * 1-5")
+// The expression is evaluated in the recorder timezone
+func (r *Recorder) ScheduleCron(expression string, duration time.Duration) error {
+	loc, err := r.location()
+	if err != nil {
+		return err
 	}
-	if start.Before(time.Now()) { // To cover start time already passed
-		timeDelay = OneDay
-		start = start.Add(timeDelay)
-		end = end.Add(timeDelay)
+	c, err := schedule.NewCron(expression, duration, loc)
+	if err != nil {
+		return err
 	}
 
+	return r.Run(c, true)
+}
+
+// Run records on the occurrences of the given schedule
+// endless controls if it would continue on the next occurrence
+// An occurrence overlapping with the previous recording is skipped
+func (r *Recorder) Run(s schedule.Schedule, endless bool) error {
+	return r.RunContext(context.Background(), s, endless)
+}
+
+// RunContext records on the occurrences of the given schedule
+// until the context is cancelled
+func (r *Recorder) RunContext(ctx context.Context, s schedule.Schedule, endless bool) error {
+	start, end := s.Next(time.Now())
 	for {
-		log.Printf("The next recording schedule: %s - %s", start.Format("2006-01-02 15:04:05 -0700"), end.Format("2006-01-02 15:04:05 -0700"))
+		if start.IsZero() {
+			return schedule.ErrNoOccurrence
+		}
+		r.notify(func(o Observer) { o.OnScheduled(r, start, end) })
+		r.logger().Info("Next recording scheduled",
+			"start", start.Format(schedule.TimeLayout), "end", end.Format(schedule.TimeLayout),
+			"local_start", start.Local().Format(schedule.TimeLayout), "local_end", end.Local().Format(schedule.TimeLayout))
 		if time.Until(start) > time.Minute {
 			// Wait a bit if the start time to more than 1 minute apart
-			<-time.After(time.Until(start.Add(-10 * time.Second)))
+			if err := sleepContext(ctx, time.Until(start.Add(-10*time.Second))); err != nil {
+				return err
+			}
 		}
-		if err := r.Record(start, end); err != nil {
+		if err := r.RecordContext(ctx, start, end); err != nil {
 			return err
 		}
-		if endless {
-			start = start.Add(OneDay)
-			end = end.Add(OneDay)
-			for !wd.AllEnabled() && !wd.Enabled(start.Weekday()) {
-				start = start.Add(OneDay)
-				end = end.Add(OneDay)
-			}
-		} else {
+		if !endless {
 			break
 		}
+		start, end = s.Next(end)
 	}
 
 	return nil
 }
-
-func calculateRetryDelay(count int) time.Duration {
-	if count > 0 {
-		return time.Duration(count) * time.Second
-	}
-	return 0
-}
@@ -1,19 +1,34 @@
 package recorder_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/antonyho/crhk-recorder/pkg/dayofweek"
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher/fetchertest"
 	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/stream/sink"
 )
 
 const (
-	channel  = "881"
-	filename = "881hd.aac"
+	channel   = "881"
+	filename  = "881hd.aac"
+	skipEvery = 3 // every third segment is skipped to produce gaps
 )
 
 func TestRecorder_Download(t *testing.T) {
@@ -155,3 +170,237 @@ func TestRecorder_Schedule_DayOfWeek(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRecorder_RecordContext_Cancel(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	start := time.Now()
+	err := rcdr.RecordContext(ctx, start, start.Add(time.Hour))
+	assert.Equal(t, context.Canceled, err)
+
+	mediaPath, err := rcdr.OutputPath(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := os.ReadFile(mediaPath)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, media, "segments shall be flushed on cancellation")
+	}
+	meta, err := recording.Load(mediaPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, recording.StatusInterrupted, meta.Status)
+		assert.EqualValues(t, len(media), meta.Bytes)
+		assert.False(t, meta.Stopped.IsZero())
+	}
+}
+
+type eventObserver struct {
+	recorder.NopObserver
+	mu       sync.Mutex
+	events   []string
+	segments int
+	summary  recorder.Summary
+}
+
+func (o *eventObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *eventObserver) OnStart(*recorder.Recorder, string, time.Time, time.Time) {
+	o.record("start")
+}
+
+func (o *eventObserver) OnSegment(*recorder.Recorder, int64, int, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.segments++
+}
+
+func (o *eventObserver) OnGap(_ *recorder.Recorder, from, to int64) {
+	o.record(fmt.Sprintf("gap %d-%d", from, to))
+}
+
+func (o *eventObserver) OnStop(_ *recorder.Recorder, summary recorder.Summary) {
+	o.record("stop")
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.summary = summary
+}
+
+func TestRecorder_AddObserver(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+	rcdr.Pool.Fetcher(channel).PollInterval = 50 * time.Millisecond
+	observer := new(eventObserver)
+	rcdr.AddObserver(observer)
+
+	start := time.Now()
+	if err := rcdr.Record(start, start.Add(500*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if assert.True(t, len(observer.events) >= 3) {
+		assert.Equal(t, "start", observer.events[0])
+		assert.Contains(t, observer.events, "gap 3-3")
+		assert.Equal(t, "stop", observer.events[len(observer.events)-1])
+	}
+	assert.Equal(t, observer.segments, observer.summary.Segments)
+	assert.Equal(t, recording.StatusCompleted, observer.summary.Status)
+	assert.True(t, observer.summary.Gaps > 0)
+	assert.NoError(t, observer.summary.Err)
+}
+
+func TestRecorder_Guard(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+	rcdr.Pool.Fetcher(channel).PollInterval = 50 * time.Millisecond
+	var mu sync.Mutex
+	free := uint64(32 << 20)
+	rcdr.Guard = &diskspace.Guard{
+		Reserve: 1 << 20,
+		Refuse:  true,
+		Free: func(string) (uint64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return free, nil
+		},
+	}
+
+	start := time.Now()
+	err := rcdr.Record(start, start.Add(time.Hour))
+	assert.ErrorIs(t, err, diskspace.ErrInsufficientSpace, "an hour needs more than the free space")
+
+	rcdr.Guard.Refuse = false
+	observer := new(eventObserver)
+	rcdr.AddObserver(observer)
+	time.AfterFunc(200*time.Millisecond, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		free = 1 << 20
+	})
+	start = time.Now().Add(time.Second)
+	err = rcdr.Record(start, start.Add(time.Hour))
+	assert.ErrorIs(t, err, diskspace.ErrInsufficientSpace, "recording shall stop before the disk is full")
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	assert.Equal(t, recording.StatusFailed, observer.summary.Status)
+}
+
+// brokenSink fails on every write
+type brokenSink struct {
+	sink.Writer
+}
+
+func (brokenSink) Write(fetcher.Segment) error {
+	return errors.New("broken")
+}
+
+func TestRecorder_Sinks(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+	rcdr.Pool.Fetcher(channel).PollInterval = 50 * time.Millisecond
+	mirror := t.TempDir()
+	var pipe bytes.Buffer
+	rcdr.Sinks = []sink.Sink{new(brokenSink), sink.NewDir(mirror), sink.NewWriter(&pipe)}
+
+	start := time.Now()
+	err := rcdr.Record(start, start.Add(500*time.Millisecond))
+	assert.NoError(t, err, "a failing sink shall not stop the recording")
+
+	mediaPath, err := rcdr.OutputPath(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := os.ReadFile(mediaPath)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, media)
+	}
+	mirrored, err := os.ReadFile(filepath.Join(mirror, filepath.Base(mediaPath)))
+	assert.NoError(t, err)
+	assert.Equal(t, media, mirrored)
+	assert.Equal(t, media, pipe.Bytes())
+}
+
+// closedPipe fails like a pipe without reader after the first write
+type closedPipe struct {
+	bytes.Buffer
+}
+
+func (p *closedPipe) Write(data []byte) (int, error) {
+	if p.Len() > 0 {
+		return 0, syscall.EPIPE
+	}
+	return p.Buffer.Write(data)
+}
+
+func TestRecorder_Output(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+	rcdr.Pool.Fetcher(channel).PollInterval = 50 * time.Millisecond
+	pipe := new(closedPipe)
+	rcdr.Output = sink.NewWriter(pipe)
+
+	start := time.Now()
+	err := rcdr.Record(start, start.Add(time.Hour))
+	assert.ErrorIs(t, err, syscall.EPIPE, "a broken pipe shall stop the recording")
+	assert.NotEmpty(t, pipe.Bytes())
+
+	entries, err := os.ReadDir(rcdr.OutputDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "no recording file or sidecar shall be written")
+}
+
+// replacingSink writes a copy which replaces the recording file
+type replacingSink struct {
+	sink.File
+	path string
+}
+
+func (s *replacingSink) Open(info sink.Info) error {
+	s.path = strings.TrimSuffix(info.Path, ".aac") + ".mp3"
+	return s.File.Open(sink.Info{Path: s.path})
+}
+
+func (s *replacingSink) Replacement() string {
+	return s.path
+}
+
+func TestRecorder_Replacement(t *testing.T) {
+	rcdr := recorder.NewRecorder(channel)
+	rcdr.OutputDir = t.TempDir()
+	rcdr.Pool = fetchertest.NewPool(skipEvery)
+	rcdr.Pool.Fetcher(channel).PollInterval = 50 * time.Millisecond
+	replacing := new(replacingSink)
+	rcdr.Sinks = []sink.Sink{sink.NewAsync(replacing)}
+	observer := new(eventObserver)
+	rcdr.AddObserver(observer)
+
+	start := time.Now()
+	assert.NoError(t, rcdr.Record(start, start.Add(300*time.Millisecond)))
+
+	mediaPath, err := rcdr.OutputPath(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoFileExists(t, mediaPath, "the recording file shall be replaced")
+	assert.FileExists(t, replacing.path)
+	meta, err := recording.Load(mediaPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Base(replacing.path), meta.File)
+	}
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	assert.Equal(t, replacing.path, observer.summary.Path)
+}
@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheTTL is how long a resolved stream source is reused
+	DefaultCacheTTL = 30 * time.Minute
+
+	// CookieExpiryMargin is how long before the CloudFront policy expiry
+	// a resolved stream source is renewed
+	CookieExpiryMargin = time.Minute
+
+	// MinCacheTTL is the least time a resolved stream source is reused,
+	// even when its policy expiry has passed, e.g. on a skewed clock
+	MinCacheTTL = 30 * time.Second
+)
+
+// DefaultCache is the resolver Cache shared in the process
+var DefaultCache = NewCache(DefaultCacheTTL)
+
+// StreamSource is the resolved stream of a channel
+type StreamSource struct {
+	ChannelName      string // specifies with stream sound quality (e.g. 881HD)
+	StreamServer     string
+	CloudfrontCookie CloudfrontCookie
+	Resolved         time.Time
+	Expires          time.Time
+}
+
+// Cache keeps the resolved stream source of channels for a TTL
+// Concurrent lookups of the same channel are resolved once.
+type Cache struct {
+	TTL time.Duration
+
+	find    func(client *Client, channel string) (string, string, CloudfrontCookie, error)
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu     sync.Mutex
+	source StreamSource
+}
+
+// NewCache creates a Cache with the given TTL
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		TTL:     ttl,
+		find:    (*Client).Find,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (c *Cache) entry(channel string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[channel]
+	if !found {
+		e = new(cacheEntry)
+		c.entries[channel] = e
+	}
+	return e
+}
+
+// Find the stream source of the channel
+// The cached stream source is returned until the TTL or
+// the CloudFront policy expires, but at least for MinCacheTTL.
+func (c *Cache) Find(channel string) (StreamSource, error) {
+	return c.FindWith(nil, channel)
+}
+
+// FindWith finds the stream source of the channel like Find, and
+// resolves it with the client, e.g. to log with the caller attributes
+func (c *Cache) FindWith(client *Client, channel string) (StreamSource, error) {
+	e := c.entry(channel)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.source.CloudfrontCookie.Assigned() && now.Before(e.source.Expires) {
+		return e.source, nil
+	}
+
+	channelName, streamServer, cloudfrontCookie, err := c.find(client, channel)
+	if err != nil {
+		return StreamSource{}, err
+	}
+	expires := now.Add(c.TTL)
+	if policyExpiry, err := cloudfrontCookie.Expiry(); err == nil && policyExpiry.Add(-CookieExpiryMargin).Before(expires) {
+		expires = policyExpiry.Add(-CookieExpiryMargin)
+	}
+	if minExpires := now.Add(MinCacheTTL); expires.Before(minExpires) {
+		expires = minExpires
+	}
+	e.source = StreamSource{
+		ChannelName:      channelName,
+		StreamServer:     streamServer,
+		CloudfrontCookie: cloudfrontCookie,
+		Resolved:         now,
+		Expires:          expires,
+	}
+	return e.source, nil
+}
+
+// Invalidate the cached stream source of the channel
+func (c *Cache) Invalidate(channel string) {
+	e := c.entry(channel)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.source = StreamSource{}
+}
@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Find(t *testing.T) {
+	var calls int32
+	c := NewCache(time.Hour)
+	c.find = func(_ *Client, channel string) (string, string, CloudfrontCookie, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return channel + "hd", "live.881903.com", CloudfrontCookie{"policy-dummy", "keypair-dummy", "sig-dummy"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			src, err := c.Find("881")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "881hd", src.ChannelName)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "concurrent lookups shall be resolved once")
+
+	src, err := c.Find("903")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "903hd", src.ChannelName)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "channels shall be cached separately")
+
+	c.Invalidate("881")
+	_, err = c.Find("881")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls), "invalidated channel shall be resolved again")
+}
+
+func TestCache_Find_Expiry(t *testing.T) {
+	var calls int32
+	c := NewCache(time.Hour)
+	c.find = func(_ *Client, channel string) (string, string, CloudfrontCookie, error) {
+		atomic.AddInt32(&calls, 1)
+		// The policy expired on 2020-01-18
+		return "881hd", "live.881903.com", CloudfrontCookie{
+			"eyJTdGF0ZW1lbnQiOlt7IlJlc291cmNlIjoiaHR0cHM6Ly9saXZlLjg4MTkwMy5jb20vZWRnZS1hYWMvKiIsIkNvbmRpdGlvbiI6eyJJcEFkZHJlc3MiOnsiQVdTOlNvdXJjZUlwIjoiOTUuOTEuMjEyLjMvMjQifSwiRGF0ZUxlc3NUaGFuIjp7IkFXUzpFcG9jaFRpbWUiOjE1NzkzOTA4Njh9fX1dfQ__",
+			"keypair-dummy",
+			"sig-dummy",
+		}, nil
+	}
+
+	src, err := c.Find("881")
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now().Add(MinCacheTTL), src.Expires, time.Second)
+	}
+	_, err = c.Find("881")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "expired policy shall be reused for the minimum TTL")
+
+	c.Invalidate("881")
+	_, err = c.Find("881")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "expired policy shall be resolved again when it fails")
+}
+
+func TestCache_Find_Error(t *testing.T) {
+	c := NewCache(time.Hour)
+	c.find = func(_ *Client, channel string) (string, string, CloudfrontCookie, error) {
+		return "", "", CloudfrontCookie{}, errors.New("playlist URL not found")
+	}
+	_, err := c.Find("881")
+	assert.Error(t, err)
+}
@@ -1,5 +1,13 @@
 package resolver
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
 // CloudFront cookie names
 const (
 	// CloudFrontCookieNamePolicy is the cookie name for CloudFront policy
@@ -21,3 +29,35 @@ type CloudfrontCookie struct {
 func (c CloudfrontCookie) Assigned() bool {
 	return c.Policy != "" && c.KeyPairID != "" && c.Signature != ""
 }
+
+// cloudfrontPolicy is the custom policy statement of CloudFront signed cookies
+type cloudfrontPolicy struct {
+	Statement []struct {
+		Condition struct {
+			DateLessThan struct {
+				EpochTime int64 `json:"AWS:EpochTime"`
+			}
+		}
+	}
+}
+
+// Expiry decodes the time when the policy expires
+// CloudFront encodes the policy in base64 with '-', '_' and '~'
+// replacing '+', '=' and '/'
+func (c CloudfrontCookie) Expiry() (time.Time, error) {
+	encoded := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(c.Policy)
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var policy cloudfrontPolicy
+	if err := json.Unmarshal(decoded, &policy); err != nil {
+		return time.Time{}, err
+	}
+	for _, statement := range policy.Statement {
+		if epoch := statement.Condition.DateLessThan.EpochTime; epoch > 0 {
+			return time.Unix(epoch, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("policy has no expiry")
+}
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"testing"
+	"time"
 )
 
 func TestCloudfrontCookie_Assigned(t *testing.T) {
@@ -39,3 +40,22 @@ func TestCloudfrontCookie_Assigned(t *testing.T) {
 		}
 	}
 }
+
+func TestCloudfrontCookie_Expiry(t *testing.T) {
+	cookies := CloudfrontCookie{
+		Policy:    "eyJTdGF0ZW1lbnQiOlt7IlJlc291cmNlIjoiaHR0cHM6Ly9saXZlLjg4MTkwMy5jb20vZWRnZS1hYWMvKiIsIkNvbmRpdGlvbiI6eyJJcEFkZHJlc3MiOnsiQVdTOlNvdXJjZUlwIjoiOTUuOTEuMjEyLjMvMjQifSwiRGF0ZUxlc3NUaGFuIjp7IkFXUzpFcG9jaFRpbWUiOjE1NzkzOTA4Njh9fX1dfQ__",
+		KeyPairID: "keypair-dummy",
+		Signature: "sig-dummy",
+	}
+	expiry, err := cookies.Expiry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.Equal(time.Unix(1579390868, 0)) {
+		t.Errorf("Wanted: %v Got: %v", time.Unix(1579390868, 0), expiry)
+	}
+
+	if _, err := (CloudfrontCookie{Policy: "policy-dummy"}).Expiry(); err == nil {
+		t.Error("Malformed policy shall not have expiry")
+	}
+}
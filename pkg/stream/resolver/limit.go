@@ -0,0 +1,41 @@
+package resolver
+
+import (
+	"sync"
+)
+
+// DefaultMaxConcurrentDownloads is the default limit of concurrent media downloads
+const DefaultMaxConcurrentDownloads = 4
+
+var (
+	downloadSlotsMu sync.Mutex
+	downloadSlots   = make(chan struct{}, DefaultMaxConcurrentDownloads)
+)
+
+// SetMaxConcurrentDownloads limits the concurrent media downloads in the process
+// A limit less than 1 is treated as 1. The downloads in progress keep
+// their slots when the limit is unchanged.
+func SetMaxConcurrentDownloads(n int) {
+	if n < 1 {
+		n = 1
+	}
+	downloadSlotsMu.Lock()
+	defer downloadSlotsMu.Unlock()
+	if cap(downloadSlots) == n {
+		return // keep the slots of the downloads in progress
+	}
+	downloadSlots = make(chan struct{}, n)
+}
+
+// acquireDownloadSlot blocks until a download is allowed
+// It returns the function releasing the slot.
+func acquireDownloadSlot() (release func()) {
+	downloadSlotsMu.Lock()
+	slots := downloadSlots
+	downloadSlotsMu.Unlock()
+
+	slots <- struct{}{}
+	return func() {
+		<-slots
+	}
+}
@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetMaxConcurrentDownloads(t *testing.T) {
+	SetMaxConcurrentDownloads(2)
+	defer SetMaxConcurrentDownloads(DefaultMaxConcurrentDownloads)
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := acquireDownloadSlot()
+			defer release()
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&peak))
+}
+
+func TestSetMaxConcurrentDownloads_Unchanged(t *testing.T) {
+	SetMaxConcurrentDownloads(1)
+	defer SetMaxConcurrentDownloads(DefaultMaxConcurrentDownloads)
+
+	release := acquireDownloadSlot()
+	SetMaxConcurrentDownloads(1) // e.g. a reload of the same limit
+	acquired := make(chan struct{})
+	go func() {
+		acquireDownloadSlot()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("download in progress shall keep its slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	<-acquired
+}
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/ushis/m3u"
 
+	"github.com/antonyho/crhk-recorder/pkg/logging"
 	crhk "github.com/antonyho/crhk-recorder/pkg/stream/url"
 )
 
@@ -17,24 +19,67 @@ const (
 	PlaylistLocationHeaderName = "location"
 )
 
+// ErrEmptyMedia is returned when the downloaded media file is empty
+var ErrEmptyMedia = errors.New("empty media file")
+
+// StatusError is an unsuccessful HTTP response from the stream servers
+type StatusError struct {
+	Resource   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unsuccessful HTTP request. response code: %d", e.Resource, e.StatusCode)
+}
+
 const (
 	// UserAgentCamouflage disguises our HTTP client as a common browser agent
 	UserAgentCamouflage = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:71.0) Gecko/20100101 Firefox/71.0"
+
+	// RequestTimeout limits a request to the stream servers, including
+	// reading the body, so a stalled connection releases its download slot
+	RequestTimeout = 30 * time.Second
 )
 
+// httpClient is shared by the requests to the stream servers
+var httpClient = &http.Client{Timeout: RequestTimeout}
+
+// Client requests the CRHK stream servers
+// Its logger keeps the attributes of the caller, e.g. the channel and job.
+type Client struct {
+	Logger *slog.Logger // defaults to slog.Default()
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c == nil || c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
 // Find channel M3U format playlist
 func Find(channel string) (
 	channelName string,
 	livestreamServer string,
 	cloudfrontCookie CloudfrontCookie,
 	err error,
+) {
+	return new(Client).Find(channel)
+}
+
+// Find channel M3U format playlist
+func (c *Client) Find(channel string) (
+	channelName string,
+	livestreamServer string,
+	cloudfrontCookie CloudfrontCookie,
+	err error,
 ) {
 	playlistCloudFrontURL, channelName, channelPageURL, err := GetCloudFrontResolverURL(channel)
 	if err != nil {
 		return
 	}
 
-	cloudfrontCookie, livestreamServer, err = GetPlaylistAuthentication(channelPageURL, playlistCloudFrontURL)
+	cloudfrontCookie, livestreamServer, err = c.GetPlaylistAuthentication(channelPageURL, playlistCloudFrontURL)
 	if err != nil {
 		return
 	}
@@ -46,7 +91,7 @@ func Find(channel string) (
 func GetCloudFrontResolverURL(channel string) (string, string, string, error) {
 	channelPageURL := crhk.RadioChannelPageURL(channel)
 
-	resp, err := http.Get(channelPageURL)
+	resp, err := httpClient.Get(channelPageURL)
 	if err != nil {
 		return "", "", "", err
 	}
@@ -74,6 +119,15 @@ func GetPlaylistAuthentication(
 	refererURL, playlistCloudFrontURL string,
 ) (
 	cloudfrontCookie CloudfrontCookie, livestreamServerHostname string, err error,
+) {
+	return new(Client).GetPlaylistAuthentication(refererURL, playlistCloudFrontURL)
+}
+
+// GetPlaylistAuthentication gets the playlist access authentication cookies
+func (c *Client) GetPlaylistAuthentication(
+	refererURL, playlistCloudFrontURL string,
+) (
+	cloudfrontCookie CloudfrontCookie, livestreamServerHostname string, err error,
 ) {
 	req, err := http.NewRequest(http.MethodGet, playlistCloudFrontURL, nil)
 	if err != nil {
@@ -82,15 +136,15 @@ func GetPlaylistAuthentication(
 	req.Header.Set("User-Agent", UserAgentCamouflage)
 	req.Header.Set("Referer", refererURL)
 
-	httpClient := &http.Client{}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Getting CloudFront cookies HTTP request failed. URL: %s \nResponse code: %d", playlistCloudFrontURL, resp.StatusCode)
-		err = errors.New("http request getting CloudFront cookies failed")
+		c.logger().Warn("Getting CloudFront cookies HTTP request failed",
+			logging.KeyURL, playlistCloudFrontURL, "status", resp.StatusCode)
+		err = &StatusError{Resource: "CloudFront cookies", StatusCode: resp.StatusCode}
 		return
 	}
 
@@ -117,6 +171,15 @@ func GetPlaylist(
 	channelName string,
 	streamServer string,
 	cloudfrontCookie CloudfrontCookie,
+) (m3u.Playlist, error) {
+	return new(Client).GetPlaylist(channelName, streamServer, cloudfrontCookie)
+}
+
+// GetPlaylist gets the playlist using the given authentication cookie values
+func (c *Client) GetPlaylist(
+	channelName string,
+	streamServer string,
+	cloudfrontCookie CloudfrontCookie,
 ) (m3u.Playlist, error) {
 	playlistURL, err := crhk.PlaylistURL(channelName, streamServer)
 	if err != nil {
@@ -131,16 +194,55 @@ func GetPlaylist(
 	req.AddCookie(&http.Cookie{Name: CloudFrontCookieNameKeyPairID, Value: cloudfrontCookie.KeyPairID})
 	req.AddCookie(&http.Cookie{Name: CloudFrontCookieNameSignature, Value: cloudfrontCookie.Signature})
 
-	c := &http.Client{}
-	resp, err := c.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Playlist HTTP request failed. URL: %s \nResponse code: %d", playlistURL, resp.StatusCode)
-		return nil, fmt.Errorf("playlist fetching failed")
+		c.logger().Warn("Playlist HTTP request failed",
+			logging.KeyURL, playlistURL.String(), "status", resp.StatusCode)
+		return nil, &StatusError{Resource: "playlist", StatusCode: resp.StatusCode}
 	}
 
 	return m3u.Parse(resp.Body)
 }
+
+// GetMedia downloads the media file of a playlist entry
+// using the given authentication cookie values
+// The concurrent downloads are limited by SetMaxConcurrentDownloads
+func GetMedia(
+	channelName string,
+	streamServer string,
+	cloudfrontCookie CloudfrontCookie,
+	path string,
+) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, crhk.StreamMediaURL(channelName, streamServer, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(&http.Cookie{Name: CloudFrontCookieNamePolicy, Value: cloudfrontCookie.Policy})
+	req.AddCookie(&http.Cookie{Name: CloudFrontCookieNameKeyPairID, Value: cloudfrontCookie.KeyPairID})
+	req.AddCookie(&http.Cookie{Name: CloudFrontCookieNameSignature, Value: cloudfrontCookie.Signature})
+
+	release := acquireDownloadSlot()
+	defer release()
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Resource: "media file", StatusCode: resp.StatusCode}
+	}
+	media, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(media) == 0 {
+		return nil, ErrEmptyMedia
+	}
+
+	return media, nil
+}
@@ -1,9 +1,16 @@
 package resolver
 
 import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
 )
 
 func TestGetCloudFrontResolverURL(t *testing.T) {
@@ -54,3 +61,36 @@ func TestGetPlaylist(t *testing.T) {
 		t.Logf("Playlist: %+v", playlist)
 	}
 }
+
+func TestClient_GetPlaylistAuthentication_Logger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	client := &Client{Logger: slog.New(slog.NewTextHandler(&buf, nil)).With(logging.KeyChannel, "881")}
+	_, _, err := client.GetPlaylistAuthentication("http://localhost/", srv.URL)
+	var statusErr *StatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, http.StatusForbidden, statusErr.StatusCode)
+	}
+	assert.Contains(t, buf.String(), logging.KeyChannel+"=881")
+	assert.Contains(t, buf.String(), "status=403")
+}
+
+func TestClient_GetPlaylistAuthentication_Timeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	timeout := httpClient.Timeout
+	httpClient.Timeout = 50 * time.Millisecond
+	defer func() { httpClient.Timeout = timeout }()
+
+	_, _, err := new(Client).GetPlaylistAuthentication("http://localhost/", srv.URL)
+	assert.Error(t, err)
+}
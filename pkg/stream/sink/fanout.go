@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+)
+
+// Fanout writes the segments to several sinks
+// An error of a required sink fails the fan-out. An optional sink
+// which fails is reported to OnError, closed and dropped until the
+// next recording, while the other sinks carry on.
+type Fanout struct {
+	OnError func(s Sink, err error) // reports the failures of the optional sinks
+
+	outputs []*output
+}
+
+type output struct {
+	sink     Sink
+	required bool
+	open     bool
+}
+
+// Add a sink to the fan-out
+func (f *Fanout) Add(s Sink, required bool) {
+	f.outputs = append(f.outputs, &output{sink: s, required: required})
+}
+
+// Open every sink
+// The sinks opened so far are closed when a required sink fails to open.
+func (f *Fanout) Open(info Info) error {
+	for _, o := range f.outputs {
+		if err := o.sink.Open(info); err != nil {
+			if o.required {
+				f.Close()
+				return err
+			}
+			f.report(o, err)
+			continue
+		}
+		o.open = true
+	}
+	return nil
+}
+
+// Write the segment to every open sink
+func (f *Fanout) Write(seg fetcher.Segment) error {
+	for _, o := range f.outputs {
+		if !o.open {
+			continue
+		}
+		if err := o.sink.Write(seg); err != nil {
+			if o.required {
+				return err
+			}
+			o.open = false
+			f.report(o, err)
+			o.sink.Close()
+		}
+	}
+	return nil
+}
+
+// Close every open sink
+// It returns the first error of the required sinks.
+func (f *Fanout) Close() error {
+	var err error
+	for _, o := range f.outputs {
+		if !o.open {
+			continue
+		}
+		o.open = false
+		closeErr := o.sink.Close()
+		switch {
+		case closeErr == nil:
+		case o.required:
+			if err == nil {
+				err = closeErr
+			}
+		default:
+			f.report(o, closeErr)
+		}
+	}
+	return err
+}
+
+func (f *Fanout) report(o *output, err error) {
+	if f.OnError != nil {
+		f.OnError(o.sink, err)
+	}
+}
@@ -0,0 +1,293 @@
+package sink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+)
+
+// DefaultQueueSize is the number of segments queued for an Async sink
+const DefaultQueueSize = 64
+
+// Errors of the sinks
+var (
+	ErrQueueFull = errors.New("sink queue is full")
+	ErrClosed    = errors.New("sink is closed")
+)
+
+// Info describes the recording written to a sink
+type Info struct {
+	Channel string
+	Job     string
+	Path    string // path of the recording file
+	Start   time.Time
+	End     time.Time
+}
+
+// Sink is a destination of the recorded segments
+// A sink is opened for every recording, receives the segments in
+// order, and is closed when the recording stops. It can be opened
+// again for the next recording after it is closed.
+type Sink interface {
+	Open(info Info) error
+	Write(seg fetcher.Segment) error
+	Close() error
+}
+
+// Replacer is a sink producing a file which replaces the recording file,
+// e.g. an encoder of another format
+type Replacer interface {
+	// Replacement returns the path of the replacing file after the sink
+	// is closed, or an empty path to keep the recording file
+	Replacement() string
+}
+
+// Producer is a sink producing a file besides the recording file,
+// e.g. a copy or an encoded file
+type Producer interface {
+	// Produced returns the path of the file of the last recording after
+	// the sink is closed, or an empty path when there is none
+	Produced() string
+}
+
+// Produced returns the file made by the sink besides the recording file, if any
+func Produced(s Sink) string {
+	if a, ok := s.(*Async); ok {
+		s = a.Sink
+	}
+	if p, ok := s.(Producer); ok {
+		return p.Produced()
+	}
+	return ""
+}
+
+// Replacement returns the file replacing the recording file made by the sink, if any
+func Replacement(s Sink) string {
+	if a, ok := s.(*Async); ok {
+		s = a.Sink
+	}
+	if r, ok := s.(Replacer); ok {
+		return r.Replacement()
+	}
+	return ""
+}
+
+// Name describes the sink in the logs
+func Name(s Sink) string {
+	if stringer, ok := s.(fmt.Stringer); ok {
+		return fmt.Sprintf("%T(%s)", s, stringer)
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// File writes the segments to the recording file
+// Every segment is flushed, so the file is readable while recording.
+type File struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewFile creates the sink of the recording file
+func NewFile() *File {
+	return new(File)
+}
+
+// Open creates the recording file
+func (f *File) Open(info Info) error {
+	return f.create(info.Path)
+}
+
+func (f *File) create(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.w = bufio.NewWriter(file)
+	return nil
+}
+
+// Write the segment to the file
+func (f *File) Write(seg fetcher.Segment) error {
+	if _, err := f.w.Write(seg.Data); err != nil {
+		return err
+	}
+	return f.w.Flush()
+}
+
+// Close the file
+func (f *File) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.w.Flush()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file = nil
+	return err
+}
+
+// Dir writes a copy of the recording file in another directory,
+// e.g. on a second disk
+type Dir struct {
+	File
+	Dir  string
+	path string // of the last copy
+}
+
+// NewDir creates the sink of the copies in the directory
+func NewDir(dir string) *Dir {
+	return &Dir{Dir: dir}
+}
+
+// Open creates the copy of the recording file
+func (d *Dir) Open(info Info) error {
+	d.path = filepath.Join(d.Dir, filepath.Base(info.Path))
+	return d.create(d.path)
+}
+
+// Produced returns the path of the last copy
+func (d *Dir) Produced() string {
+	return d.path
+}
+
+// String is the directory of the copies
+func (d *Dir) String() string {
+	return d.Dir
+}
+
+// Writer writes the segments to a writer, e.g. a pipe
+// The writer is not closed.
+type Writer struct {
+	W io.Writer
+}
+
+// NewWriter creates the sink of the writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{W: w}
+}
+
+// Open does nothing
+func (w *Writer) Open(Info) error {
+	return nil
+}
+
+// Write the segment to the writer
+func (w *Writer) Write(seg fetcher.Segment) error {
+	_, err := w.W.Write(seg.Data)
+	return err
+}
+
+// Close does nothing
+func (w *Writer) Close() error {
+	return nil
+}
+
+// Async writes to a slow sink in the background, so that it
+// does not hold up the recording. The sink fails when its queue
+// is full.
+type Async struct {
+	Sink      Sink
+	QueueSize int // defaults to DefaultQueueSize
+
+	queue chan fetcher.Segment
+	done  chan struct{}
+	mu    sync.Mutex
+	err   error // first error of the sink
+}
+
+// NewAsync wraps the sink to write in the background
+func NewAsync(s Sink) *Async {
+	return &Async{Sink: s, QueueSize: DefaultQueueSize}
+}
+
+// Open the sink and start writing in the background
+func (a *Async) Open(info Info) error {
+	if err := a.Sink.Open(info); err != nil {
+		return err
+	}
+	size := a.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	a.queue = make(chan fetcher.Segment, size)
+	a.done = make(chan struct{})
+	a.err = nil
+	go a.run(a.queue, a.done)
+	return nil
+}
+
+func (a *Async) run(queue <-chan fetcher.Segment, done chan<- struct{}) {
+	defer close(done)
+	for seg := range queue {
+		if a.failed() != nil {
+			continue // drain
+		}
+		if err := a.Sink.Write(seg); err != nil {
+			a.fail(err)
+		}
+	}
+}
+
+// Write queues the segment
+// It returns the error of the previous writes, if any.
+func (a *Async) Write(seg fetcher.Segment) error {
+	if err := a.failed(); err != nil {
+		return err
+	}
+	if a.queue == nil {
+		return ErrClosed
+	}
+	select {
+	case a.queue <- seg:
+		return nil
+	default:
+		a.fail(ErrQueueFull)
+		return ErrQueueFull
+	}
+}
+
+// Close waits for the queued segments and closes the sink
+func (a *Async) Close() error {
+	if a.queue == nil {
+		return nil
+	}
+	close(a.queue)
+	<-a.done
+	a.queue = nil
+	err := a.Sink.Close()
+	if failed := a.failed(); failed != nil {
+		return failed
+	}
+	return err
+}
+
+func (a *Async) fail(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+func (a *Async) failed() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// String describes the sink written in the background
+func (a *Async) String() string {
+	return Name(a.Sink)
+}
@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+)
+
+// failingSink fails to write after the given number of segments
+type failingSink struct {
+	Writer
+	writes int
+	closed bool
+}
+
+var errFailed = errors.New("sink failed")
+
+func (s *failingSink) Write(seg fetcher.Segment) error {
+	if s.writes == 0 {
+		return errFailed
+	}
+	s.writes--
+	return s.Writer.Write(seg)
+}
+
+func (s *failingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func segments(data ...string) []fetcher.Segment {
+	var segs []fetcher.Segment
+	for i, d := range data {
+		segs = append(segs, fetcher.Segment{Sequence: int64(i + 1), Data: []byte(d)})
+	}
+	return segs
+}
+
+func TestFanout(t *testing.T) {
+	dir := t.TempDir()
+	info := Info{Channel: "881", Path: filepath.Join(dir, "recording", "881.aac")}
+	var pipe bytes.Buffer
+	failing := &failingSink{Writer: Writer{W: new(bytes.Buffer)}, writes: 1}
+	var failures []error
+
+	out := &Fanout{OnError: func(s Sink, err error) {
+		assert.Same(t, failing, s)
+		failures = append(failures, err)
+	}}
+	out.Add(NewFile(), true)
+	out.Add(failing, false)
+	mirror := NewDir(filepath.Join(dir, "mirror"))
+	out.Add(mirror, false)
+	out.Add(NewWriter(&pipe), false)
+
+	assert.NoError(t, out.Open(info))
+	for _, seg := range segments("a", "b", "c") {
+		assert.NoError(t, out.Write(seg), "an optional sink shall not fail the fan-out")
+	}
+	assert.NoError(t, out.Close())
+
+	assert.Equal(t, []error{errFailed}, failures)
+	assert.True(t, failing.closed, "a failed sink shall be closed")
+	assert.Equal(t, "abc", pipe.String())
+	assert.Equal(t, filepath.Join(dir, "mirror", "881.aac"), Produced(mirror))
+	assert.Empty(t, Produced(NewFile()))
+	for _, path := range []string{info.Path, filepath.Join(dir, "mirror", "881.aac")} {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", string(data))
+	}
+}
+
+func TestFanout_Required(t *testing.T) {
+	failing := &failingSink{Writer: Writer{W: new(bytes.Buffer)}, writes: 1}
+	optional := &failingSink{Writer: Writer{W: new(bytes.Buffer)}, writes: 10}
+	out := new(Fanout)
+	out.Add(failing, true)
+	out.Add(optional, false)
+
+	assert.NoError(t, out.Open(Info{}))
+	segs := segments("a", "b")
+	assert.NoError(t, out.Write(segs[0]))
+	assert.ErrorIs(t, out.Write(segs[1]), errFailed)
+	assert.NoError(t, out.Close())
+	assert.True(t, optional.closed)
+
+	out = new(Fanout)
+	out.Add(NewFile(), true)
+	assert.Error(t, out.Open(Info{Path: t.TempDir()}), "a directory cannot be the recording file")
+}
+
+// blockingSink blocks the writes until released
+type blockingSink struct {
+	Writer
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(seg fetcher.Segment) error {
+	<-s.release
+	return s.Writer.Write(seg)
+}
+
+func TestAsync(t *testing.T) {
+	var buf bytes.Buffer
+	slow := &blockingSink{Writer: Writer{W: &buf}, release: make(chan struct{})}
+	async := NewAsync(slow)
+	async.QueueSize = 2
+
+	assert.NoError(t, async.Open(Info{}))
+	segs := segments("a", "b", "c", "d", "e")
+	assert.NoError(t, async.Write(segs[0]))
+	assert.NoError(t, async.Write(segs[1]))
+	var err error
+	for _, seg := range segs[2:] {
+		if err = async.Write(seg); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, ErrQueueFull)
+	close(slow.release)
+	assert.ErrorIs(t, async.Close(), ErrQueueFull)
+
+	buf.Reset()
+	assert.NoError(t, async.Open(Info{}), "the sink shall be reopened for the next recording")
+	assert.NoError(t, async.Write(segs[0]))
+	assert.NoError(t, async.Close())
+	assert.Equal(t, "a", buf.String())
+	assert.ErrorIs(t, async.Write(segs[1]), ErrClosed)
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "*sink.Dir(/mnt/backup)", Name(NewDir("/mnt/backup")))
+	assert.Equal(t, "*sink.Async(*sink.Dir(/mnt/backup))", Name(NewAsync(NewDir("/mnt/backup"))))
+	assert.Equal(t, "*sink.File", Name(NewFile()))
+}
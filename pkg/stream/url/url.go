@@ -2,7 +2,9 @@ package url
 
 import (
 	"net/url"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -124,3 +126,15 @@ func StreamMediaURL(channelName, streamServer, filename string) string {
 
 	return streamMediaURLStr.String()
 }
+
+// MediaSequence parses the media sequence number from the stream media
+// filename (e.g. l_46_5506776131_458898.aac is 458898)
+func MediaSequence(filename string) (sequence int64, found bool) {
+	name := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	parts := strings.Split(name, "_")
+	sequence, err := strconv.ParseInt(parts[len(parts)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return sequence, true
+}
@@ -34,3 +34,12 @@ func TestStreamMediaURL(t *testing.T) {
 
 	assert.Equal(t, "https://live.881903.com/edge-aac/881hd/audio_chunk.aac", StreamMediaURL)
 }
+
+func TestMediaSequence(t *testing.T) {
+	seq, found := MediaSequence("l_46_5506776131_458898.aac")
+	assert.True(t, found)
+	assert.EqualValues(t, 458898, seq)
+
+	_, found = MediaSequence("chunks.m3u8")
+	assert.False(t, found)
+}
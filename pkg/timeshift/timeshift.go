@@ -0,0 +1,290 @@
+package timeshift
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher"
+)
+
+// Defaults of the buffer
+const (
+	DefaultWindow      = 6 * time.Hour
+	DefaultRetryDelay  = 30 * time.Second
+	SegmentExtension   = ".aac"
+	subscriptionLength = 100 * 365 * 24 * time.Hour
+)
+
+// ErrEmptyRange is the error of exporting a range without buffered segment
+var ErrEmptyRange = errors.New("no buffered segment in the range")
+
+// Segment is a buffered media segment
+// The file name keeps the fetched time, media sequence and duration,
+// so the buffer can be read without the buffering process.
+type Segment struct {
+	Path     string
+	Fetched  time.Time
+	Sequence int64
+	Duration time.Duration
+	Size     int64
+}
+
+// Start of the segment audio, which ends about the fetched time
+func (s Segment) Start() time.Time {
+	return s.Fetched.Add(-s.Duration)
+}
+
+// Buffer keeps a rolling on-disk buffer of the latest segments of a channel
+// It shares the channel downloads with the recordings through the pool.
+type Buffer struct {
+	Channel    string
+	Dir        string        // root directory of the buffers, one subdirectory per channel
+	Window     time.Duration // how long the segments are kept
+	RetryDelay time.Duration // delay before buffering again after the fetcher gave up
+	Pool       *fetcher.Pool // defaults to fetcher.DefaultPool
+	Logger     *slog.Logger  // defaults to slog.Default()
+}
+
+// NewBuffer creates the buffer of the channel in the directory
+func NewBuffer(dir, channel string, window time.Duration) *Buffer {
+	return &Buffer{Channel: channel, Dir: dir, Window: window, RetryDelay: DefaultRetryDelay}
+}
+
+// Run buffers the channel until the context is cancelled
+func (b *Buffer) Run(ctx context.Context) error {
+	dir, err := ChannelDir(b.Dir, b.Channel)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	pool := b.Pool
+	if pool == nil {
+		pool = fetcher.DefaultPool
+	}
+	b.logger().Info("Timeshift buffering started", "dir", dir, "window", b.Window)
+
+	for {
+		now := time.Now()
+		sub := pool.Fetcher(b.Channel).Subscribe(now, now.Add(subscriptionLength), nil)
+		err := b.buffer(ctx, sub)
+		sub.Cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.logger().Error("Timeshift buffering failed, retrying", logging.Err(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.RetryDelay):
+		}
+	}
+}
+
+// buffer the segments of the subscription until it is closed
+func (b *Buffer) buffer(ctx context.Context, sub *fetcher.Subscription) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case seg, ok := <-sub.Segments():
+			if !ok {
+				return sub.Err()
+			}
+			if err := b.write(seg); err != nil {
+				return err
+			}
+			if err := b.prune(time.Now()); err != nil {
+				b.logger().Warn("Pruning timeshift buffer failed", logging.Err(err))
+			}
+		}
+	}
+}
+
+// write the segment to the buffer directory
+func (b *Buffer) write(seg fetcher.Segment) error {
+	name := fmt.Sprintf("%d_%d_%d%s",
+		seg.Fetched.UnixMilli(), seg.Sequence, seg.Duration.Milliseconds(), SegmentExtension)
+	dir, err := ChannelDir(b.Dir, b.Channel)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	b.logger().Debug("Segment buffered", logging.KeySequence, seg.Sequence, logging.KeyFile, path)
+	return os.WriteFile(path, seg.Data, 0644)
+}
+
+// prune the segments older than the window
+func (b *Buffer) prune(now time.Time) error {
+	segments, err := Segments(b.Dir, b.Channel)
+	if err != nil {
+		return err
+	}
+	window := b.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	for _, seg := range segments {
+		if now.Sub(seg.Fetched) <= window {
+			break
+		}
+		if err := os.Remove(seg.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Buffer) logger() *slog.Logger {
+	logger := b.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(logging.KeyChannel, b.Channel)
+}
+
+// ChannelDir is the buffer directory of the channel
+// The channel must be alphanumeric to stay within the directory.
+func ChannelDir(dir, channel string) (string, error) {
+	if err := recording.ValidateChannel(channel); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, channel), nil
+}
+
+// Segments lists the buffered segments of the channel by fetched time
+func Segments(dir, channel string) ([]Segment, error) {
+	chDir, err := ChannelDir(dir, channel)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(chDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, entry := range entries {
+		seg, ok := parseSegment(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // pruned meanwhile
+		}
+		seg.Path = filepath.Join(chDir, entry.Name())
+		seg.Size = info.Size()
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Fetched.Before(segments[j].Fetched)
+	})
+	return segments, nil
+}
+
+// parseSegment parses the segment file name
+func parseSegment(name string) (Segment, bool) {
+	if !strings.HasSuffix(name, SegmentExtension) {
+		return Segment{}, false
+	}
+	fields := strings.Split(strings.TrimSuffix(name, SegmentExtension), "_")
+	if len(fields) != 3 {
+		return Segment{}, false
+	}
+	var values [3]int64
+	for i, field := range fields {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return Segment{}, false
+		}
+		values[i] = v
+	}
+	return Segment{
+		Fetched:  time.UnixMilli(values[0]),
+		Sequence: values[1],
+		Duration: time.Duration(values[2]) * time.Millisecond,
+	}, true
+}
+
+// Export the buffered segments of the channel between from and to into
+// a recording file with the sidecar metadata
+func Export(dir, channel string, from, to time.Time, mediaPath string) (*recording.Metadata, error) {
+	if !from.Before(to) {
+		return nil, errors.New("export range is empty")
+	}
+	segments, err := Segments(dir, channel)
+	if err != nil {
+		return nil, err
+	}
+	var selected []Segment
+	for _, seg := range segments {
+		if seg.Fetched.After(from) && seg.Start().Before(to) {
+			selected = append(selected, seg)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrEmptyRange
+	}
+
+	if err := os.MkdirAll(filepath.Dir(mediaPath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(mediaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	meta := &recording.Metadata{
+		Channel:        channel,
+		File:           filepath.Base(mediaPath),
+		ScheduledStart: from,
+		ScheduledEnd:   to,
+		Started:        selected[0].Start(),
+	}
+	var lastSequence int64
+	for _, seg := range selected {
+		data, err := os.ReadFile(seg.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if lastSequence > 0 && seg.Sequence > lastSequence+1 {
+			meta.Gaps++
+			meta.MissingSegments += int(seg.Sequence - lastSequence - 1)
+		}
+		if seg.Sequence > 0 {
+			lastSequence = seg.Sequence
+		}
+		meta.Segments++
+		meta.Bytes += int64(len(data))
+		meta.Duration += seg.Duration
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	meta.Finish(nil)
+	meta.Stopped = selected[len(selected)-1].Fetched
+	if err := meta.Save(mediaPath); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,121 @@
+package timeshift
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/stream/fetcher/fetchertest"
+)
+
+// writeSegment writes a buffered segment fetched at the given time
+func writeSegment(t *testing.T, dir string, fetched time.Time, sequence int64, data string) {
+	name := fmt.Sprintf("%d_%d_%d.aac", fetched.UnixMilli(), sequence, (10 * time.Second).Milliseconds())
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "881"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "881", name), []byte(data), 0644))
+}
+
+func TestBuffer_Run(t *testing.T) {
+	pool := fetchertest.NewPool(0)
+	dir := t.TempDir()
+	b := NewBuffer(dir, "881", time.Hour)
+	b.Pool = pool
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		segments, err := Segments(dir, "881")
+		return err == nil && len(segments) >= 2
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	segments, err := Segments(dir, "881")
+	assert.NoError(t, err)
+	assert.Less(t, segments[0].Sequence, segments[1].Sequence)
+	assert.Equal(t, int64(len("l_46_1.aac")), segments[0].Size)
+}
+
+func TestBuffer_prune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeSegment(t, dir, now.Add(-3*time.Hour), 1, "a")
+	writeSegment(t, dir, now.Add(-90*time.Minute), 2, "b")
+	writeSegment(t, dir, now.Add(-time.Minute), 3, "c")
+
+	b := NewBuffer(dir, "881", 2*time.Hour)
+	assert.NoError(t, b.prune(now))
+	segments, err := Segments(dir, "881")
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 2) {
+		assert.Equal(t, int64(2), segments[0].Sequence)
+		assert.Equal(t, int64(3), segments[1].Sequence)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	dir := t.TempDir()
+	segments, err := Segments(dir, "881")
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	now := time.Now()
+	writeSegment(t, dir, now, 2, "b")
+	writeSegment(t, dir, now.Add(-10*time.Second), 1, "a")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "881", "unknown.aac"), nil, 0644))
+
+	segments, err = Segments(dir, "881")
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 2) {
+		assert.Equal(t, int64(1), segments[0].Sequence)
+		assert.Equal(t, now.UnixMilli(), segments[1].Fetched.UnixMilli())
+		assert.Equal(t, 10*time.Second, segments[1].Duration)
+	}
+}
+
+func TestSegments_InvalidChannel(t *testing.T) {
+	_, err := Segments(t.TempDir(), "../881")
+	assert.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	writeSegment(t, dir, now.Add(-40*time.Minute), 1, "a")
+	writeSegment(t, dir, now.Add(-20*time.Minute), 2, "b")
+	writeSegment(t, dir, now.Add(-10*time.Minute), 5, "c")
+	writeSegment(t, dir, now, 6, "d")
+
+	mediaPath := filepath.Join(t.TempDir(), "881-export.aac")
+	meta, err := Export(dir, "881", now.Add(-30*time.Minute), now.Add(-time.Minute), mediaPath)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	content, err := os.ReadFile(mediaPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "bc", string(content))
+	assert.Equal(t, recording.StatusCompleted, meta.Status)
+	assert.Equal(t, 2, meta.Segments)
+	assert.Equal(t, 1, meta.Gaps)
+	assert.Equal(t, 2, meta.MissingSegments)
+	assert.Equal(t, 20*time.Second, meta.Duration)
+
+	saved, err := recording.Load(mediaPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "881-export.aac", saved.File)
+	assert.Equal(t, "881", saved.Channel)
+
+	_, err = Export(dir, "881", now.Add(-2*time.Hour), now.Add(-time.Hour), mediaPath)
+	assert.ErrorIs(t, err, ErrEmptyRange)
+	_, err = Export(dir, "881", now, now.Add(-time.Hour), mediaPath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// HeaderSize is the size of the WAV header
+const HeaderSize = 44
+
+// ErrTooLarge is the error of samples over the 4 GiB limit of WAV
+var ErrTooLarge = errors.New("WAV data is larger than 4 GiB")
+
+// unknownSize is the chunk size of a stream of unknown length
+const unknownSize = math.MaxUint32
+
+// maxData is the most bytes of samples in a WAV file
+const maxData = math.MaxUint32 - (HeaderSize - 8)
+
+// Writer writes 16-bit PCM samples in a WAV file
+// The header is written with an unknown size first, which is
+// fixed on Close when the output can seek, e.g. a file. A stream,
+// e.g. a pipe, keeps the unknown size.
+type Writer struct {
+	w          io.Writer
+	sampleRate int
+	channels   int
+	size       int64 // bytes of samples
+}
+
+// NewWriter writes the header of the format at the start of the output
+func NewWriter(w io.Writer, sampleRate, channels int) (*Writer, error) {
+	wr := &Writer{w: w, sampleRate: sampleRate, channels: channels}
+	if _, err := w.Write(wr.header(unknownSize)); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// Write interleaved little-endian samples
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.size+int64(len(p)) > maxData {
+		return 0, ErrTooLarge
+	}
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Size is the number of bytes of samples written
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+// Close fixes the size in the header of a seekable output
+// The output is not closed.
+func (w *Writer) Close() error {
+	s, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return nil // a pipe
+	}
+	if _, err := s.Write(w.header(uint32(w.size))); err != nil {
+		return err
+	}
+	_, err := s.Seek(0, io.SeekEnd)
+	return err
+}
+
+// header of the data size
+func (w *Writer) header(dataSize uint32) []byte {
+	riffSize := uint32(unknownSize)
+	if dataSize != unknownSize {
+		riffSize = dataSize + HeaderSize - 8
+	}
+	blockAlign := w.channels * 2
+	h := make([]byte, 0, HeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, riffSize)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, 1) // PCM
+	h = binary.LittleEndian.AppendUint16(h, uint16(w.channels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.sampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(w.sampleRate*blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, 16) // bits per sample
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	return h
+}
@@ -0,0 +1,65 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "881.wav")
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	w, err := NewWriter(f, 44100, 2)
+	assert.NoError(t, err)
+	w.Write([]byte{1, 0, 2, 0})
+	w.Write([]byte{3, 0, 4, 0, 5, 0, 6, 0})
+	assert.NoError(t, w.Close())
+	assert.Equal(t, int64(12), w.Size())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	if !assert.Len(t, data, HeaderSize+12) {
+		return
+	}
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(36+12), binary.LittleEndian.Uint32(data[4:8]))
+	assert.Equal(t, "WAVEfmt ", string(data[8:16]))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(data[20:22]))
+	assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(data[22:24]))
+	assert.Equal(t, uint32(44100), binary.LittleEndian.Uint32(data[24:28]))
+	assert.Equal(t, uint32(44100*4), binary.LittleEndian.Uint32(data[28:32]))
+	assert.Equal(t, uint16(4), binary.LittleEndian.Uint16(data[32:34]))
+	assert.Equal(t, uint16(16), binary.LittleEndian.Uint16(data[34:36]))
+	assert.Equal(t, "data", string(data[36:40]))
+	assert.Equal(t, uint32(12), binary.LittleEndian.Uint32(data[40:44]))
+	assert.Equal(t, []byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0}, data[HeaderSize:])
+}
+
+func TestWriter_Stream(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, 48000, 1)
+	assert.NoError(t, err)
+	w.Write([]byte{1, 0})
+	assert.NoError(t, w.Close())
+
+	data := b.Bytes()
+	assert.Len(t, data, HeaderSize+2)
+	assert.Equal(t, uint32(unknownSize), binary.LittleEndian.Uint32(data[4:8]))
+	assert.Equal(t, uint32(unknownSize), binary.LittleEndian.Uint32(data[40:44]))
+}
+
+func TestWriter_TooLarge(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, 48000, 1)
+	assert.NoError(t, err)
+	w.size = maxData - 1
+	_, err = w.Write([]byte{1, 0})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
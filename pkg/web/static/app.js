@@ -0,0 +1,218 @@
+'use strict';
+
+const DAY = 24 * 60 * 60 * 1000;
+const REFRESH_INTERVAL = 5000;
+
+let token = localStorage.getItem('token') || '';
+let weekStart = startOfWeek(new Date());
+
+function startOfWeek(date) {
+  const d = new Date(date);
+  d.setHours(0, 0, 0, 0);
+  d.setDate(d.getDate() - ((d.getDay() + 6) % 7)); // Monday
+  return d;
+}
+
+async function api(method, path, body) {
+  const options = { method, headers: { Authorization: 'Bearer ' + token } };
+  if (body !== undefined) {
+    options.headers['Content-Type'] = 'application/json';
+    options.body = JSON.stringify(body);
+  }
+  const resp = await fetch('/api' + path, options);
+  if (resp.status === 401) {
+    login();
+    throw new Error('unauthorized');
+  }
+  if (resp.status === 204) {
+    return null;
+  }
+  const result = await resp.json();
+  if (!resp.ok) {
+    throw new Error(result.error || resp.statusText);
+  }
+  return result;
+}
+
+function login() {
+  const dialog = document.getElementById('login');
+  if (!dialog.open) {
+    dialog.showModal();
+  }
+}
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, attrs);
+  e.append(...children);
+  return e;
+}
+
+function formatBytes(bytes) {
+  const units = ['B', 'KB', 'MB', 'GB'];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return bytes.toFixed(i ? 1 : 0) + ' ' + units[i];
+}
+
+function formatDuration(seconds) {
+  const h = Math.floor(seconds / 3600);
+  const m = Math.floor(seconds % 3600 / 60);
+  const s = Math.floor(seconds % 60);
+  return (h ? h + 'h ' : '') + m + 'm ' + s + 's';
+}
+
+function formatTime(value) {
+  return new Date(value).toLocaleString([], { dateStyle: 'medium', timeStyle: 'short' });
+}
+
+function fileURL(file, download) {
+  const params = new URLSearchParams({ token });
+  if (download) {
+    params.set('download', '');
+  }
+  return '/api/recordings/files/' + encodeURIComponent(file) + '?' + params;
+}
+
+async function loadSchedule() {
+  const from = weekStart.toISOString().replace(/\.\d+Z$/, 'Z');
+  const occurrences = await api('GET', '/schedule?days=7&from=' + from);
+  const calendar = document.getElementById('calendar');
+  const today = new Date().toDateString();
+  calendar.replaceChildren();
+  document.getElementById('week-label').textContent =
+    weekStart.toLocaleDateString() + ' - ' + new Date(weekStart.getTime() + 6 * DAY).toLocaleDateString();
+
+  for (let i = 0; i < 7; i++) {
+    const dayStart = new Date(weekStart.getTime() + i * DAY);
+    const dayEnd = new Date(dayStart.getTime() + DAY);
+    const day = el('div', { className: 'day' + (dayStart.toDateString() === today ? ' today' : '') },
+      el('h3', { textContent: dayStart.toLocaleDateString([], { weekday: 'short', day: 'numeric' }) }));
+
+    for (const o of occurrences) {
+      const start = new Date(Math.max(new Date(o.start), dayStart));
+      const end = new Date(Math.min(new Date(o.end), dayEnd));
+      if (start >= end) {
+        continue;
+      }
+      const slot = el('div', {
+        className: 'slot',
+        title: `${o.job} (${o.channel}) ${formatTime(o.start)} - ${formatTime(o.end)}`,
+        textContent: `${start.toLocaleTimeString([], { timeStyle: 'short' })} ${o.job}`,
+      });
+      slot.style.top = ((start - dayStart) / DAY * 100) + '%';
+      slot.style.height = ((end - start) / DAY * 100) + '%';
+      day.append(slot);
+    }
+    calendar.append(day);
+  }
+}
+
+async function loadActive() {
+  const active = await api('GET', '/recordings/active');
+  const container = document.getElementById('active');
+  container.replaceChildren();
+  if (active.recordings.length === 0) {
+    container.append(el('p', { textContent: 'No recording in progress.' }));
+  }
+  for (const r of active.recordings) {
+    const start = new Date(r.start);
+    const end = new Date(r.end);
+    const elapsed = Math.min(Date.now(), end) - start;
+    const name = r.job || r.channel;
+    const stop = el('button', { type: 'button', textContent: 'Stop' });
+    stop.onclick = async () => {
+      await api('DELETE', '/recordings/active/' + encodeURIComponent(name));
+      refresh();
+    };
+    container.append(el('div', { className: 'recording' },
+      el('strong', { textContent: `${name} (${r.channel})` }), ' ',
+      `${formatTime(r.start)} - ${formatTime(r.end)}`, ' ', stop,
+      el('progress', { max: end - start, value: Math.max(elapsed, 0) }),
+      el('div', {},
+        `${formatDuration(r.duration_seconds)} captured, ${r.segments} segments, ${formatBytes(r.bytes)}, `,
+        el('span', { className: r.gaps ? 'gaps' : '', textContent: `${r.gaps} gaps (${r.missing_segments} segments missing)` }),
+        r.retries ? `, ${r.retries} retries` : '')));
+  }
+}
+
+async function loadRecordings() {
+  const recordings = await api('GET', '/recordings');
+  const tbody = document.getElementById('recordings');
+  tbody.replaceChildren();
+  for (const r of recordings) {
+    const play = el('button', { type: 'button', textContent: 'Play' });
+    play.onclick = () => {
+      const player = document.getElementById('player');
+      player.src = fileURL(r.file, false);
+      player.play();
+    };
+    tbody.append(el('tr', {},
+      el('td', { textContent: formatTime(r.scheduled_start) }),
+      el('td', { textContent: r.channel }),
+      el('td', { textContent: r.job || '' }),
+      el('td', { className: 'status-' + r.status, textContent: r.status, title: r.error || '' }),
+      el('td', { textContent: formatDuration(r.duration / 1e9) }),
+      el('td', { textContent: formatBytes(r.bytes) }),
+      el('td', { textContent: r.gaps }),
+      el('td', {}, play, ' ', el('a', { href: fileURL(r.file, true), textContent: 'Download' }))));
+  }
+}
+
+async function refresh() {
+  try {
+    await Promise.all([loadSchedule(), loadActive(), loadRecordings()]);
+  } catch (err) {
+    console.error(err);
+  }
+}
+
+document.getElementById('login').addEventListener('close', () => {
+  token = document.getElementById('token').value;
+  localStorage.setItem('token', token);
+  refresh();
+});
+
+document.getElementById('logout').onclick = () => {
+  token = '';
+  localStorage.removeItem('token');
+  login();
+};
+
+document.getElementById('prev-week').onclick = () => {
+  weekStart = new Date(weekStart.getTime() - 7 * DAY);
+  loadSchedule();
+};
+
+document.getElementById('next-week').onclick = () => {
+  weekStart = new Date(weekStart.getTime() + 7 * DAY);
+  loadSchedule();
+};
+
+document.getElementById('start').onsubmit = async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  try {
+    await api('POST', '/recordings/active', {
+      channel: form.channel.value,
+      duration: form.minutes.value + 'm',
+    });
+    refresh();
+  } catch (err) {
+    alert(err.message);
+  }
+};
+
+if (token) {
+  refresh();
+} else {
+  login();
+}
+setInterval(() => {
+  if (token) {
+    loadActive().catch(console.error);
+  }
+}, REFRESH_INTERVAL);
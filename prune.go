@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/recording"
+	"github.com/antonyho/crhk-recorder/pkg/retention"
+)
+
+// runPrune removes the old recordings in a directory by the retention limits
+// The dry run only lists the recordings which would be removed.
+func runPrune(args []string) {
+	var (
+		dir     string
+		policy  retention.Policy
+		maxSize string
+		dryRun  bool
+	)
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.StringVar(&dir, "dir", ".", "directory of the recordings")
+	flags.StringVar(&policy.Channel, "c", "", "limit the recordings of the channel only")
+	flags.StringVar(&policy.Job, "job", "", "limit the recordings of the job only")
+	flags.IntVar(&policy.KeepDays, "keep-days", 0, "remove the recordings started more than the days ago")
+	flags.IntVar(&policy.KeepLast, "keep-last", 0, "keep the latest recordings")
+	flags.StringVar(&maxSize, "max-size", "", "maximum total size of the recordings [e.g. 20GB]")
+	flags.BoolVar(&dryRun, "dry-run", false, "list the recordings which would be removed")
+	logOpts := logFlags(flags)
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	if maxSize != "" {
+		size, err := diskspace.ParseSize(maxSize)
+		if err != nil {
+			panic(err)
+		}
+		policy.MaxSize = size
+	}
+	entries, err := recording.List(dir)
+	if err != nil {
+		panic(err)
+	}
+	report, err := retention.Enforce(entries, []retention.Policy{policy}, time.Now(), dryRun)
+	for _, e := range report.Removed {
+		fmt.Println(e.Path)
+	}
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d recordings of %d bytes\n", verb, len(report.Removed), report.Bytes)
+	if err != nil {
+		panic(err)
+	}
+}
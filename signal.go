@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// gracefulShutdown returns a context which is cancelled on the first
+// SIGINT or SIGTERM, so that recordings are flushed and finalised.
+// A second signal exits immediately.
+// The returned function gives the exit code for the received signal,
+// or 0 when no signal was received.
+func gracefulShutdown() (context.Context, func() int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var code int32
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		slog.Info("Stopping the recordings, repeat the signal to exit immediately", "signal", sig.String())
+		atomic.StoreInt32(&code, int32(signalExitCode(sig)))
+		cancel()
+
+		sig = <-signals
+		slog.Warn("Exiting immediately", "signal", sig.String())
+		os.Exit(signalExitCode(sig))
+	}()
+
+	return ctx, func() int {
+		return int(atomic.LoadInt32(&code))
+	}
+}
+
+// signalExitCode follows the shell convention of 128 + signal number
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
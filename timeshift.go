@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/antonyho/crhk-recorder/pkg/logging"
+	"github.com/antonyho/crhk-recorder/pkg/stream/recorder"
+	"github.com/antonyho/crhk-recorder/pkg/timeshift"
+)
+
+// runTimeshift keeps a rolling buffer of the channels until interrupted
+// The save subcommand saves a range of the buffer as a recording.
+func runTimeshift(args []string) {
+	if len(args) > 0 && args[0] == "save" {
+		saveTimeshift(args[1:])
+		return
+	}
+
+	var channel, dir string
+	var window time.Duration
+	flags := flag.NewFlagSet("timeshift", flag.ExitOnError)
+	flags.StringVar(&channel, "c", "881", "channel name in abbreviation [comma seperated for simultaneous buffering]")
+	flags.StringVar(&dir, "dir", "timeshift", "buffer directory")
+	flags.DurationVar(&window, "window", timeshift.DefaultWindow, "how long the buffered segments are kept")
+	logOpts := logFlags(flags)
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	ctx, exitCode := gracefulShutdown()
+	done := make(chan error)
+	channels := strings.Split(channel, ",")
+	for _, ch := range channels {
+		b := timeshift.NewBuffer(dir, strings.TrimSpace(ch), window)
+		go func() {
+			done <- b.Run(ctx)
+		}()
+	}
+	for range channels {
+		if err := <-done; err != nil && ctx.Err() == nil {
+			panic(err)
+		}
+	}
+	os.Exit(exitCode())
+}
+
+// saveTimeshift saves a range of the buffer as a recording with sidecar metadata
+func saveTimeshift(args []string) {
+	var channel, dir, output, from, to string
+	var last time.Duration
+	flags := flag.NewFlagSet("timeshift save", flag.ExitOnError)
+	flags.StringVar(&channel, "c", "881", "channel name in abbreviation")
+	flags.StringVar(&dir, "dir", "timeshift", "buffer directory")
+	flags.DurationVar(&last, "last", 0, "save the last duration of the buffer [e.g. 30m]")
+	flags.StringVar(&from, "from", "", "start of the saved range in RFC 3339 [instead of -last]")
+	flags.StringVar(&to, "to", "", "end of the saved range in RFC 3339 [defaults to now]")
+	flags.StringVar(&output, "o", "", "directory of the saved recording [defaults to the working directory]")
+	logOpts := logFlags(flags)
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	end := time.Now()
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			panic(err)
+		}
+		end = t
+	}
+	var start time.Time
+	switch {
+	case last > 0:
+		start = end.Add(-last)
+	case from != "":
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			panic(err)
+		}
+		start = t
+	default:
+		panic(errors.New("-last or -from must be provided"))
+	}
+
+	r := recorder.Recorder{Channel: channel, OutputDir: output}
+	path, err := r.OutputPath(start)
+	if err != nil {
+		panic(err)
+	}
+	meta, err := timeshift.Export(dir, channel, start, end, path)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Timeshift saved", logging.KeyChannel, channel, logging.KeyFile, path,
+		"segments", meta.Segments, "duration", meta.Duration, "gaps", meta.Gaps)
+	fmt.Println(path)
+}
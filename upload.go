@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/antonyho/crhk-recorder/pkg/diskspace"
+	"github.com/antonyho/crhk-recorder/pkg/storage/s3"
+)
+
+// S3 credentials environment variables
+const (
+	S3AccessKeyEnv = "CRHK_S3_ACCESS_KEY"
+	S3SecretKeyEnv = "CRHK_S3_SECRET_KEY"
+)
+
+// runUpload uploads the recordings with their sidecars to an S3-compatible bucket
+func runUpload(args []string) {
+	var cfg s3.Config
+	var partSize string
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	flags.StringVar(&cfg.Endpoint, "endpoint", "", "host[:port] of the S3 API [e.g. s3.amazonaws.com]")
+	flags.BoolVar(&cfg.Insecure, "insecure", false, "plain HTTP instead of HTTPS")
+	flags.StringVar(&cfg.Region, "region", s3.DefaultRegion, "bucket region")
+	flags.StringVar(&cfg.Bucket, "bucket", "", "bucket of the recordings")
+	flags.StringVar(&cfg.KeyTemplate, "key", s3.DefaultKeyTemplate, "object key template of the recording metadata and the file Name")
+	flags.StringVar(&cfg.StorageClass, "storage-class", "", "storage class of the objects [e.g. STANDARD_IA]")
+	flags.StringVar(&partSize, "part-size", "16MB", "size of the multipart upload parts")
+	flags.BoolVar(&cfg.DeleteLocal, "delete", false, "delete the local files after a verified upload")
+	logOpts := logFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s upload [flags] recording.aac...\n"+
+			"Credentials in %s and %s environment variables\n", os.Args[0], S3AccessKeyEnv, S3SecretKeyEnv)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	setupLogging(logOpts)
+
+	size, err := diskspace.ParseSize(partSize)
+	if err != nil {
+		panic(err)
+	}
+	cfg.PartSize = uint64(size)
+	cfg.AccessKey = os.Getenv(S3AccessKeyEnv)
+	cfg.SecretKey = os.Getenv(S3SecretKeyEnv)
+	uploader, err := s3.New(cfg)
+	if err != nil {
+		panic(err)
+	}
+	for _, path := range flags.Args() {
+		objects, err := uploader.Upload(context.Background(), path)
+		if err != nil {
+			panic(err)
+		}
+		for _, o := range objects {
+			fmt.Printf("%s => s3://%s/%s\n", o.Path, cfg.Bucket, o.Key)
+		}
+	}
+}